@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxSuggestions is the most suggestions a request can ask for
+const maxSuggestions = 20
+
+// maxAutocompleteQuery is the longest query autocomplete accepts, in
+// characters; a longer one is a search, not something being typed
+const maxAutocompleteQuery = 100
+
+// AutocompleteHandler suggests movie titles and people's names for ?q= as
+// it is typed, at most ?limit= (8 by default). Matching ignores case and
+// accents and tolerates typos; titles starting with q come first.
+func (app *application) AutocompleteHandler(w http.ResponseWriter, r *http.Request) {
+	q := strings.TrimSpace(r.URL.Query().Get("q"))
+	if q == "" || utf8.RuneCountInString(q) > maxAutocompleteQuery {
+		app.WriteJSONError(w, fmt.Errorf("q parameter must be 1 to %d characters", maxAutocompleteQuery))
+		return
+	}
+
+	limit := 8
+	if v := r.URL.Query().Get("limit"); v != "" {
+		var err error
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxSuggestions {
+			app.WriteJSONError(w, fmt.Errorf("invalid limit parameter"))
+			return
+		}
+	}
+
+	suggestions, err := app.autocomplete.Suggest(r.Context(), q, limit)
+	if err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	if err := app.WriteJSON(w, http.StatusOK, suggestions); err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/iamYole/go-movies/internal/models"
+)
+
+// ListCommentsHandler returns a movie's comment threads, newest first,
+// paged by top level comment with ?limit=&offset=
+func (app *application) ListCommentsHandler(w http.ResponseWriter, r *http.Request) {
+	movieID, err := readIDParam(r, "id")
+	if err != nil {
+		app.WriteJSONError(w, err)
+		return
+	}
+
+	limit, offset, err := readPage(r, 100)
+	if err != nil {
+		app.WriteJSONError(w, err)
+		return
+	}
+
+	threads, err := app.repo.Comments.GetCommentThreads(r.Context(), models.CommentFilter{
+		MovieID: movieID,
+		Limit:   limit,
+		Offset:  offset,
+	})
+	if err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	if err := app.WriteJSON(w, http.StatusOK, threads); err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+	}
+}
+
+// InsertCommentHandler posts a comment, or a reply when parent_id is set.
+// Comments matching the word list are held for a moderator, which the
+// returned status shows.
+func (app *application) InsertCommentHandler(w http.ResponseWriter, r *http.Request) {
+	movieID, err := readIDParam(r, "id")
+	if err != nil {
+		app.WriteJSONError(w, err)
+		return
+	}
+
+	if !app.requireActiveUser(w, r) {
+		return
+	}
+
+	var input struct {
+		ParentID *int   `json:"parent_id"`
+		Body     string `json:"body"`
+	}
+	if err := app.ReadJSON(w, r, &input); err != nil {
+		app.WriteJSONError(w, err)
+		return
+	}
+
+	comment := models.Comment{
+		MovieID:  movieID,
+		UserID:   contextUserID(r),
+		ParentID: input.ParentID,
+		Body:     strings.TrimSpace(input.Body),
+		Status:   models.CommentVisible,
+	}
+
+	fieldErrors, err := validateStruct(comment)
+	if err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+	if len(fieldErrors) > 0 {
+		app.failedValidation(w, fieldErrors)
+		return
+	}
+
+	var queueReason string
+	if word, ok := app.comments.words.Match(comment.Body); ok {
+		log.Printf("comment on movie %d by user %d queued, matched %q", movieID, comment.UserID, word)
+		comment.Status = models.CommentPending
+		queueReason = models.QueuedByWordList
+	}
+
+	commentID, err := app.repo.Comments.InsertComment(r.Context(), comment, queueReason)
+	if err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	saved, err := app.repo.Comments.GetComment(r.Context(), commentID)
+	if err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	if err := app.WriteJSON(w, http.StatusCreated, saved); err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+	}
+}
+
+// ReportCommentHandler reports a comment for a reason. A comment reaching
+// the report threshold goes to the moderation queue.
+func (app *application) ReportCommentHandler(w http.ResponseWriter, r *http.Request) {
+	movieID, err := readIDParam(r, "id")
+	if err != nil {
+		app.WriteJSONError(w, err)
+		return
+	}
+	commentID, err := readIDParam(r, "commentID")
+	if err != nil {
+		app.WriteJSONError(w, err)
+		return
+	}
+
+	if !app.requireActiveUser(w, r) {
+		return
+	}
+
+	var input struct {
+		Reason  string `json:"reason" validate:"required,report_reason"`
+		Details string `json:"details" validate:"max=1000"`
+	}
+	if err := app.ReadJSON(w, r, &input); err != nil {
+		app.WriteJSONError(w, err)
+		return
+	}
+	input.Details = strings.TrimSpace(input.Details)
+
+	fieldErrors, err := validateStruct(input)
+	if err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+	if len(fieldErrors) > 0 {
+		app.failedValidation(w, fieldErrors)
+		return
+	}
+
+	queued, err := app.repo.Comments.ReportComment(r.Context(), movieID, commentID, contextUserID(r),
+		input.Reason, input.Details, app.comments.reportThreshold)
+	if err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	res := struct {
+		CommentID int  `json:"comment_id"`
+		Queued    bool `json:"queued"`
+	}{commentID, queued}
+	if err := app.WriteJSON(w, http.StatusCreated, res); err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"context"
+	"net/http"
+)
+
+type contextKey string
+
+const userIDContextKey = contextKey("userID")
+
+// contextSetUserID returns r carrying the id of the authenticated user
+func contextSetUserID(r *http.Request, userID int) *http.Request {
+	ctx := context.WithValue(r.Context(), userIDContextKey, userID)
+	return r.WithContext(ctx)
+}
+
+// contextUserID returns the id of the authenticated user, or zero outside
+// authRequired
+func contextUserID(r *http.Request) int {
+	userID, _ := r.Context().Value(userIDContextKey).(int)
+	return userID
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/iamYole/go-movies/internal/models"
+	"github.com/iamYole/go-movies/internal/repository"
+)
+
+// Problem is an RFC 7807 problem details body
+type Problem struct {
+	Type   string       `json:"type"`
+	Title  string       `json:"title"`
+	Status int          `json:"status"`
+	Detail string       `json:"detail,omitempty"`
+	Errors []FieldError `json:"errors,omitempty"`
+}
+
+// problemTypes are the stable slugs of the type URIs, by status code
+var problemTypes = map[int]string{
+	http.StatusBadRequest:            "bad-request",
+	http.StatusUnauthorized:          "unauthorized",
+	http.StatusForbidden:             "forbidden",
+	http.StatusNotFound:              "not-found",
+	http.StatusConflict:              "conflict",
+	http.StatusPreconditionFailed:    "precondition-failed",
+	http.StatusRequestEntityTooLarge: "too-large",
+	http.StatusUnsupportedMediaType:  "unsupported-media-type",
+	http.StatusUnprocessableEntity:   "validation",
+	http.StatusPreconditionRequired:  "precondition-required",
+	http.StatusInternalServerError:   "internal",
+}
+
+// domainStatus maps a domain error to its status code, or returns 0
+func domainStatus(err error) int {
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, repository.ErrEditConflict):
+		return http.StatusPreconditionFailed
+	case errors.Is(err, repository.ErrConflict):
+		return http.StatusConflict
+	case errors.Is(err, repository.ErrValidation):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, repository.ErrUnauthorized):
+		return http.StatusUnauthorized
+	case errors.Is(err, repository.ErrForbidden):
+		return http.StatusForbidden
+	}
+	return 0
+}
+
+// newProblem builds the problem for err. Domain errors choose their own
+// status and message; server errors are logged and replaced by a generic
+// detail so internals never reach the client.
+func (app *application) newProblem(err error, status int) Problem {
+	detail := err.Error()
+
+	if s := domainStatus(err); s != 0 {
+		status = s
+		var domainErr *models.Error
+		if errors.As(err, &domainErr) {
+			if domainErr.Err != nil {
+				log.Println(domainErr)
+			}
+			detail = domainErr.Message
+		}
+	}
+
+	if status >= http.StatusInternalServerError {
+		log.Println(err)
+		detail = "the server encountered a problem and could not process your request"
+	}
+
+	return Problem{
+		Type:   app.problemType(status),
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+	}
+}
+
+func (app *application) problemType(status int) string {
+	slug, ok := problemTypes[status]
+	if !ok {
+		return "about:blank"
+	}
+	return fmt.Sprintf("https://%s/problems/%s", app.Domain, slug)
+}
+
+func (app *application) writeProblem(w http.ResponseWriter, problem Problem) error {
+	headers := http.Header{}
+	headers.Set("Content-Type", "application/problem+json")
+	return app.WriteJSON(w, problem.Status, problem, headers)
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/iamYole/go-movies/internal/models"
+)
+
+var (
+	errPreconditionRequired = errors.New("If-Match header is required")
+	errPreconditionFailed   = errors.New("movie has been modified")
+)
+
+// movieETag is "id-version", suffixed with a hash of the ratings, cast and
+// watchlist flag when present. If-Match compares only the id and version.
+func movieETag(movie *models.Movie) string {
+	if movie.RatingCount == 0 && movie.Cast == nil && movie.InWatchlist == nil {
+		return fmt.Sprintf(`"%d-%d"`, movie.ID, movie.Version)
+	}
+
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%d|%g\n", movie.RatingCount, movie.AverageRating)
+	if movie.InWatchlist != nil {
+		fmt.Fprintf(h, "watchlist|%t\n", *movie.InWatchlist)
+	}
+	for _, c := range movie.Cast {
+		fmt.Fprintf(h, "%d|%d|%s|%s|%d|%s\n", c.ID, c.PersonID, c.Role, c.Character, c.BillingOrder, c.PersonName)
+	}
+	return fmt.Sprintf(`"%d-%d-%x"`, movie.ID, movie.Version, h.Sum64())
+}
+
+// parseMovieETag reads the id and version out of a movie ETag
+func parseMovieETag(tag string) (int, int, bool) {
+	if len(tag) < 2 || tag[0] != '"' || tag[len(tag)-1] != '"' {
+		return 0, 0, false
+	}
+	parts := strings.SplitN(tag[1:len(tag)-1], "-", 3)
+	if len(parts) < 2 {
+		return 0, 0, false
+	}
+	id, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, 0, false
+	}
+	version, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return 0, 0, false
+	}
+	return id, version, true
+}
+
+// ifMatchVersion returns the version the client expects from If-Match. A
+// wildcard matches any stored version and is reported as zero.
+func ifMatchVersion(r *http.Request, movieID int) (int, error) {
+	header := strings.TrimSpace(r.Header.Get("If-Match"))
+	if header == "" {
+		return 0, errPreconditionRequired
+	}
+	if header == "*" {
+		return 0, nil
+	}
+
+	for _, tag := range strings.Split(header, ",") {
+		//weak tags never match under strong comparison
+		tag = strings.TrimSpace(tag)
+		if strings.HasPrefix(tag, "W/") {
+			continue
+		}
+
+		id, version, ok := parseMovieETag(tag)
+		if !ok {
+			continue
+		}
+		if id == movieID && version > 0 {
+			return version, nil
+		}
+	}
+
+	return 0, errPreconditionFailed
+}
+
+// notModified reports whether If-None-Match matches etag, using weak comparison
+func notModified(r *http.Request, etag string) bool {
+	header := r.Header.Get("If-None-Match")
+	if header == "" {
+		return false
+	}
+
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == "*" || tag == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// requireIfMatch reads the expected version of a movie from If-Match and
+// answers 428 or 412 itself when the precondition cannot be satisfied
+func (app *application) requireIfMatch(w http.ResponseWriter, r *http.Request, movieID int) (int, bool) {
+	version, err := ifMatchVersion(r, movieID)
+	switch {
+	case errors.Is(err, errPreconditionRequired):
+		app.WriteJSONError(w, err, http.StatusPreconditionRequired)
+		return 0, false
+	case errors.Is(err, errPreconditionFailed):
+		app.preconditionFailed(w, r, movieID)
+		return 0, false
+	}
+	return version, true
+}
+
+// preconditionFailed answers a stale write with 412 and the current movie
+func (app *application) preconditionFailed(w http.ResponseWriter, r *http.Request, movieID int) {
+	movie, err := app.repo.Movies.GetMovieByID(r.Context(), int64(movieID))
+	if err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("ETag", movieETag(movie))
+	if err := app.WriteJSON(w, http.StatusPreconditionFailed, movie); err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+	}
+}
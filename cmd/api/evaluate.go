@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/iamYole/go-movies/internal/models"
+	"github.com/iamYole/go-movies/internal/recommend"
+)
+
+const evaluateUsage = "usage: api evaluate [-k 10] [-holdout 0.2] [-seed 1] [-min-common 2]"
+
+// runEvaluate implements the evaluate subcommand, which reports the
+// precision@k of recommendations on a held out split of the local thumbs
+func runEvaluate(conn *sql.DB, args []string) error {
+	fs := flag.NewFlagSet("evaluate", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	k := fs.Int("k", 10, "recommendations per user")
+	holdout := fs.Float64("holdout", 0.2, "fraction of each user's thumbs up held out")
+	seed := fs.Int64("seed", 1, "seed of the held out split")
+	minCommon := fs.Int("min-common", 2, "users two movies need in common to be neighbors")
+	if err := fs.Parse(args); err != nil || fs.NArg() > 0 {
+		return errors.New(evaluateUsage)
+	}
+	if *k < 1 || *holdout <= 0 || *holdout >= 1 {
+		return errors.New(evaluateUsage)
+	}
+
+	repo := &models.RecommendRepo{DB: conn}
+	ctx := context.Background()
+	var data recommend.EvalData
+	var err error
+	if data.Thumbs, err = repo.AllThumbs(ctx); err != nil {
+		return err
+	}
+	if data.Viewings, err = repo.AllViewings(ctx); err != nil {
+		return err
+	}
+	if data.Catalog, err = repo.CatalogCandidates(ctx); err != nil {
+		return err
+	}
+
+	ev, err := recommend.Evaluate(ctx, data, recommend.EvalOptions{
+		K:         *k,
+		Holdout:   *holdout,
+		Seed:      *seed,
+		MinCommon: *minCommon,
+	})
+	if err != nil {
+		return err
+	}
+	if ev.Users == 0 {
+		return errors.New("evaluate: no user has enough thumbs up to hold any out")
+	}
+
+	fmt.Printf("users evaluated   %d\n", ev.Users)
+	fmt.Printf("held out          %d\n", ev.HeldOut)
+	fmt.Printf("precision@%-7d %.4f\n", ev.K, ev.Precision)
+	fmt.Printf("popularity@%-6d %.4f\n", ev.K, ev.PopularityPrecision)
+	return nil
+}
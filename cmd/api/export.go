@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/iamYole/go-movies/internal/models"
+)
+
+// exportRow is the flat shape of an exported movie. Its columns are exactly
+// the ones the importer reads, so an export can be loaded back in and, by its
+// external ids, update the movies it came from.
+type exportRow struct {
+	Title       string            `json:"title"`
+	ReleaseDate string            `json:"release_date"`
+	Runtime     int               `json:"runtime"`
+	MPAARating  string            `json:"mpaa_rating"`
+	Description string            `json:"description"`
+	Genres      []string          `json:"genres"`
+	ExternalIDs map[string]string `json:"external_ids,omitempty"`
+}
+
+// exportColumns is the csv header, with a <source>_id column per catalog
+var exportColumns = func() []string {
+	columns := []string{"title", "release_date", "runtime", "mpaa_rating", "description", "genres"}
+	for _, source := range models.ExternalSources {
+		columns = append(columns, source+"_id")
+	}
+	return columns
+}()
+
+func newExportRow(movie *models.Movie) exportRow {
+	row := exportRow{
+		Title:       movie.Title,
+		ReleaseDate: movie.ReleaseDate.Format(time.DateOnly),
+		Runtime:     movie.Runtime,
+		MPAARating:  movie.MPAARating,
+		Description: movie.Description,
+		Genres:      []string{},
+		ExternalIDs: movie.ExternalIDs,
+	}
+	for _, g := range movie.Genres {
+		row.Genres = append(row.Genres, g.Genre)
+	}
+	return row
+}
+
+// record is the row as csv fields in exportColumns order
+func (row exportRow) record() []string {
+	record := []string{
+		row.Title, row.ReleaseDate, strconv.Itoa(row.Runtime),
+		row.MPAARating, row.Description, strings.Join(row.Genres, "|"),
+	}
+	for _, source := range models.ExternalSources {
+		record = append(record, row.ExternalIDs[source])
+	}
+	return record
+}
+
+// ExportMoviesHandler streams the catalog as ?format=csv|ndjson|json, taking
+// the same filters as the movie listing
+func (app *application) ExportMoviesHandler(w http.ResponseWriter, r *http.Request) {
+	filter, err := readMovieFilter(r)
+	if err != nil {
+		app.WriteJSONError(w, err)
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "csv"
+	}
+
+	var contentType string
+	switch format {
+	case "csv":
+		contentType = "text/csv; charset=utf-8"
+	case "ndjson":
+		contentType = "application/x-ndjson"
+	case "json":
+		contentType = "application/json"
+	default:
+		app.WriteJSONError(w, errors.New("format must be csv, ndjson or json"))
+		return
+	}
+
+	filename := fmt.Sprintf("movies-%s.%s", time.Now().UTC().Format("20060102"), format)
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+
+	var write func(*models.Movie) error
+	var finish func() error
+
+	//sep is empty until the first row has been written
+	var sep string
+
+	switch format {
+	case "csv":
+		cw := csv.NewWriter(w)
+		header := func() error {
+			if sep == "" {
+				sep = ","
+				return cw.Write(exportColumns)
+			}
+			return nil
+		}
+		write = func(movie *models.Movie) error {
+			if err := header(); err != nil {
+				return err
+			}
+			return cw.Write(newExportRow(movie).record())
+		}
+		finish = func() error {
+			if err := header(); err != nil {
+				return err
+			}
+			cw.Flush()
+			return cw.Error()
+		}
+	case "ndjson":
+		enc := json.NewEncoder(w)
+		write = func(movie *models.Movie) error {
+			sep = "\n"
+			return enc.Encode(newExportRow(movie))
+		}
+		finish = func() error { return nil }
+	case "json":
+		enc := json.NewEncoder(w)
+		write = func(movie *models.Movie) error {
+			if sep == "" {
+				sep = "["
+			} else {
+				sep = ","
+			}
+			if _, err := w.Write([]byte(sep)); err != nil {
+				return err
+			}
+			return enc.Encode(newExportRow(movie))
+		}
+		finish = func() error {
+			if sep == "" {
+				_, err := w.Write([]byte("[]\n"))
+				return err
+			}
+			_, err := w.Write([]byte("]\n"))
+			return err
+		}
+	}
+
+	//once rows are written the status line is gone, so later failures can
+	//only be logged and the response cut short
+	if err := app.repo.Movies.StreamMovies(r.Context(), filter, write); err != nil {
+		if sep == "" {
+			w.Header().Del("Content-Disposition")
+			w.Header().Del("Content-Type")
+			app.WriteJSONError(w, err, http.StatusInternalServerError)
+			return
+		}
+		log.Println("export:", err)
+		return
+	}
+	if err := finish(); err != nil {
+		log.Println("export:", err)
+	}
+}
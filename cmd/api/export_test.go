@@ -0,0 +1,66 @@
+package main
+
+import (
+	"database/sql/driver"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/iamYole/go-movies/internal/importer"
+	"github.com/iamYole/go-movies/internal/repository"
+)
+
+func TestExportImportRoundTrip(t *testing.T) {
+	released := time.Date(2016, 11, 11, 0, 0, 0, 0, time.UTC)
+	conn := newFakeDB(t, func(query string, args []driver.Value) (*fakeRows, error) {
+		if !strings.HasPrefix(query, "fetch") {
+			return nil, nil
+		}
+		return &fakeRows{
+			columns: []string{"id", "title", "release_date", "runtime", "mpaa_rating", "description",
+				"image", "created_at", "updated_at", "version", "genres", "external_ids"},
+			rows: [][]driver.Value{{
+				int64(7), "Arrival", released, int64(116), "PG13", "Linguist, meet heptapods",
+				"/arrival.jpg", released, released, int64(3), "Drama|Science Fiction",
+				[]byte(`{"imdb": "tt2543164", "tmdb": "329865"}`),
+			}},
+		}, nil
+	})
+	app := &application{repo: repository.NewDbConn(conn)}
+
+	for _, format := range []string{importer.FormatCSV, importer.FormatNDJSON} {
+		req := httptest.NewRequest(http.MethodGet, "/admin/movies/export?format="+format, nil)
+		rec := httptest.NewRecorder()
+		app.ExportMoviesHandler(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: status = %d, body %s", format, rec.Code, rec.Body)
+		}
+
+		rows, err := importer.Parse(rec.Body, format)
+		if err != nil {
+			t.Fatalf("%s: Parse: %v", format, err)
+		}
+		if len(rows) != 1 {
+			t.Fatalf("%s: got %d rows, want 1", format, len(rows))
+		}
+		if rows[0].Err != nil {
+			t.Fatalf("%s: row rejected: %v", format, rows[0].Err)
+		}
+
+		got := rows[0].Movie
+		if got.Movie.Title != "Arrival" || !got.Movie.ReleaseDate.Equal(released) || got.Movie.Runtime != 116 ||
+			got.Movie.MPAARating != "PG13" || got.Movie.Description != "Linguist, meet heptapods" {
+			t.Errorf("%s: movie = %+v", format, got.Movie)
+		}
+		if want := []string{"Drama", "Science Fiction"}; !slices.Equal(got.Genres, want) {
+			t.Errorf("%s: genres = %q, want %q", format, got.Genres, want)
+		}
+		if want := map[string]string{"imdb": "tt2543164", "tmdb": "329865"}; !maps.Equal(got.ExternalIDs, want) {
+			t.Errorf("%s: external ids = %v, want %v", format, got.ExternalIDs, want)
+		}
+	}
+}
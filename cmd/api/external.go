@@ -0,0 +1,146 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/iamYole/go-movies/internal/models"
+	"github.com/iamYole/go-movies/internal/repository"
+)
+
+// readExternalID reads the {source} and {id} route params of an external id
+func readExternalID(r *http.Request) (string, string, error) {
+	source := strings.ToLower(chi.URLParam(r, "source"))
+	if !models.IsExternalSource(source) {
+		return "", "", fmt.Errorf("source must be one of %s", strings.Join(models.ExternalSources, ", "))
+	}
+
+	externalID := strings.TrimSpace(chi.URLParam(r, "id"))
+	if externalID == "" {
+		return "", "", errors.New("external id is required")
+	}
+	return source, externalID, nil
+}
+
+// GetMovieByExternalIDHandler looks a movie up by its id in an outside catalog
+func (app *application) GetMovieByExternalIDHandler(w http.ResponseWriter, r *http.Request) {
+	source, externalID, err := readExternalID(r)
+	if err != nil {
+		app.WriteJSONError(w, err)
+		return
+	}
+
+	movie, err := app.repo.Movies.GetMovieByExternalID(r.Context(), source, externalID)
+	if err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	etag := movieETag(movie)
+	w.Header().Set("ETag", etag)
+	if notModified(r, etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	if err := app.WriteJSON(w, http.StatusOK, movie); err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+	}
+}
+
+// UpsertMovieByExternalIDHandler replaces the movie linked to an external id,
+// creating and linking it when there is none yet. If-Match is optional here
+// since a sync job has no ETag for a movie it has never seen, but it is
+// honoured when sent.
+func (app *application) UpsertMovieByExternalIDHandler(w http.ResponseWriter, r *http.Request) {
+	source, externalID, err := readExternalID(r)
+	if err != nil {
+		app.WriteJSONError(w, err)
+		return
+	}
+
+	var movie models.Movie
+	if err := app.ReadJSON(w, r, &movie); err != nil {
+		app.WriteJSONError(w, err)
+		return
+	}
+
+	existing, err := app.repo.Movies.GetMovieByExternalID(r.Context(), source, externalID)
+	switch {
+	case err == nil:
+		if r.Header.Get("If-Match") != "" {
+			version, ok := app.requireIfMatch(w, r, existing.ID)
+			if !ok {
+				return
+			}
+			movie.Version = version
+		}
+		movie.ID = existing.ID
+		if movie.Image == "" {
+			movie.Image = existing.Image
+		}
+	case errors.Is(err, repository.ErrNotFound):
+		movie.ID = 0
+	default:
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	if existing != nil {
+		current, _, err := app.repo.Movies.EditMovie(r.Context(), int64(existing.ID))
+		if err != nil {
+			app.WriteJSONError(w, err, http.StatusInternalServerError)
+			return
+		}
+		keepSyncedFields(&movie, current)
+		movie.LockChanged(*current)
+	} else {
+		movie.LockOptional()
+	}
+
+	fieldErrors, err := app.validateMovie(r.Context(), movie)
+	if err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+	if len(fieldErrors) > 0 {
+		app.failedValidation(w, fieldErrors)
+		return
+	}
+
+	created, movieID, revision, version, err := app.repo.Movies.UpsertMovieByExternalID(r.Context(), source, externalID, movie)
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrEditConflict):
+			app.preconditionFailed(w, r, movie.ID)
+		default:
+			app.WriteJSONError(w, err, http.StatusInternalServerError)
+		}
+		return
+	}
+	movie.ID = movieID
+	movie.Version = version
+	if created || existing == nil || movie.Title != existing.Title {
+		app.enqueueEnrichment(r.Context(), movieID, !created)
+	}
+	app.enqueueSimilar(r.Context(), movieID)
+
+	status, message := http.StatusOK, "Movie Updated"
+	if created {
+		status, message = http.StatusCreated, "Movie Created"
+		w.Header().Set("Location", fmt.Sprintf("/movies/%d", movieID))
+	}
+
+	res := JSONResponse{
+		Error:   false,
+		Message: message,
+		Data:    map[string]int{"id": movieID, "revision": revision, "version": version},
+	}
+	w.Header().Set("ETag", movieETag(&movie))
+	if err := app.WriteJSON(w, status, res); err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+	}
+}
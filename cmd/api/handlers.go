@@ -1,17 +1,15 @@
 package main
 
 import (
-	"encoding/json"
 	"errors"
-	"io"
 	"log"
 	"net/http"
-	"net/url"
 	"strconv"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/iamYole/go-movies/internal/models"
+	"github.com/iamYole/go-movies/internal/repository"
 	//"github.com/iamYole/go-movies/internal/models"
 )
 
@@ -33,11 +31,45 @@ func (app *application) Home(w http.ResponseWriter, r *http.Request) {
 }
 
 func (app *application) AllMovies(w http.ResponseWriter, r *http.Request) {
-	movies, err := app.repo.Movies.GetMovies(r.Context())
+	filter, err := readMovieFilter(r)
+	if err != nil {
+		app.WriteJSONError(w, err)
+		return
+	}
+	facets, err := readFacets(r)
+	if err != nil {
+		app.WriteJSONError(w, err)
+		return
+	}
+
+	movies, err := app.repo.Movies.GetMovies(r.Context(), filter)
 	if err != nil {
 		app.WriteJSONError(w, err,http.StatusInternalServerError)
 		return
 	}
+	app.recordListing(r, filter, movies)
+
+	if err := app.markWatchlist(r, movies...); err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	//facets wrap the listing, so plain listings keep their shape
+	if len(facets) > 0 {
+		counts, err := app.repo.Movies.GetFacets(r.Context(), filter, facets)
+		if err != nil {
+			app.WriteJSONError(w, err, http.StatusInternalServerError)
+			return
+		}
+		res := struct {
+			Movies []*models.Movie                  `json:"movies"`
+			Facets map[string][]*models.FacetBucket `json:"facets"`
+		}{movies, counts}
+		if err := app.WriteJSON(w, http.StatusOK, res); err != nil {
+			app.WriteJSONError(w, err, http.StatusInternalServerError)
+		}
+		return
+	}
 
 	err = app.WriteJSON(w, http.StatusOK, movies)
 	if err != nil {
@@ -72,24 +104,34 @@ func (app *application) authenticate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := Validate.Struct(loginPayload);err!=nil{
-		app.WriteJSONError(w,errors.New("please fill in all required fields"))
+	fieldErrors, err := validateStruct(loginPayload)
+	if err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+	if len(fieldErrors) > 0 {
+		app.failedValidation(w, fieldErrors)
 		return
 	}
 
 	//validate user against the database
 	user, err := app.repo.Users.GetUserByEmail(r.Context(), loginPayload.Email)
 	if err != nil {
-		app.WriteJSONError(w, errors.New("invalid credentials"))
+		app.WriteJSONError(w, models.Unauthorized("invalid credentials"))
 		return
 	}
 	valid, err := user.Password.ValidatePassword(loginPayload.Password)
 	if err != nil || !valid {
-		app.WriteJSONError(w, errors.New("invalid credentials"))
+		app.WriteJSONError(w, models.Unauthorized("invalid credentials"))
 		log.Println(err)
 		return
 	}
 
+	if user.DisabledAt != nil {
+		app.WriteJSONError(w, models.Forbidden("account disabled"))
+		return
+	}
+
 	//generate tokens
 	tokens := app.generateAndSendToken(w,user)
 
@@ -111,8 +153,14 @@ func (app *application) Register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err:=Validate.Struct(payload);err!=nil{
-		app.WriteJSONError(w,errors.New("please fill in all required fields"))
+	fieldErrors, err := validateStruct(payload)
+	if err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+	if len(fieldErrors) > 0 {
+		app.failedValidation(w, fieldErrors)
+		return
 	}
 
 	user := &models.User{
@@ -126,10 +174,12 @@ func (app *application) Register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := app.repo.Users.CreateUser(r.Context(), *user); err != nil {
-		app.WriteJSONError(w, err)
+	id, err := app.repo.Users.CreateUser(r.Context(), *user)
+	if err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
 		return
 	}
+	user.ID = id
 
 	tokens := app.generateAndSendToken(w,user)
 	
@@ -161,21 +211,29 @@ func (app *application) InsertMovieHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	// get image
-	movie = app.getPoster(movie)
-
-	newID,err := app.repo.Movies.InsertMovie(r.Context(),movie)
-	if err!=nil{
-		app.WriteJSONError(w,err,http.StatusInternalServerError)
+	fieldErrors, err := app.validateMovie(r.Context(), movie)
+	if err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+	if len(fieldErrors) > 0 {
+		app.failedValidation(w, fieldErrors)
 		return
 	}
 
-	//handle genre
-	err = app.repo.Movies.UpdateMovieGenres(r.Context(),int(newID),movie.GenresArray)
+	//optional fields the editor filled in are theirs, TMDB only fills the gaps
+	movie.LockOptional()
+
+	//the genres and first revision are saved along with the movie
+	newID,err := app.repo.Movies.InsertMovie(r.Context(),movie)
 	if err!=nil{
 		app.WriteJSONError(w,err,http.StatusInternalServerError)
 		return
 	}
+	movie.ID = int(newID)
+
+	app.enqueueEnrichment(r.Context(), movie.ID, false)
+	app.enqueueSimilar(r.Context(), movie.ID)
 
 	res := JSONResponse{
 		Error: false,
@@ -187,13 +245,135 @@ func (app *application) InsertMovieHandler(w http.ResponseWriter, r *http.Reques
 	}
 }
 
+func (app *application) UpdateMovieHandler(w http.ResponseWriter, r *http.Request) {
+	movieID, err := readIDParam(r, "id")
+	if err != nil {
+		app.WriteJSONError(w, err)
+		return
+	}
+
+	version, ok := app.requireIfMatch(w, r, movieID)
+	if !ok {
+		return
+	}
+
+	var movie models.Movie
+	if err := app.ReadJSON(w, r, &movie); err != nil {
+		app.WriteJSONError(w, err)
+		return
+	}
+	movie.ID = movieID
+	movie.Version = version
+
+	fieldErrors, err := app.validateMovie(r.Context(), movie)
+	if err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+	if len(fieldErrors) > 0 {
+		app.failedValidation(w, fieldErrors)
+		return
+	}
+
+	current, _, err := app.repo.Movies.EditMovie(r.Context(), int64(movieID))
+	if err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+	keepSyncedFields(&movie, current)
+	movie.LockChanged(*current)
+
+	revision, version, err := app.repo.Movies.UpdateMovie(r.Context(), movie)
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrEditConflict):
+			app.preconditionFailed(w, r, movieID)
+		default:
+			app.WriteJSONError(w, err, http.StatusInternalServerError)
+		}
+		return
+	}
+	movie.Version = version
+
+	if movie.Title != current.Title {
+		app.enqueueEnrichment(r.Context(), movieID, true)
+	}
+	app.enqueueSimilar(r.Context(), movieID)
+
+	res := JSONResponse{
+		Error:   false,
+		Message: "Movie Updated",
+		Data:    map[string]int{"revision": revision, "version": version},
+	}
+	w.Header().Set("ETag", movieETag(&movie))
+	if err := app.WriteJSON(w, http.StatusOK, res); err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+	}
+}
+
+// keepSyncedFields carries stored values over into a full replacement of a
+// movie for the fields only TMDB sync fills in. Edit forms that predate
+// them send them empty, which would otherwise wipe and lock them.
+func keepSyncedFields(movie, current *models.Movie) {
+	if movie.Backdrop == "" {
+		movie.Backdrop = current.Backdrop
+	}
+	if movie.OriginalLanguage == "" {
+		movie.OriginalLanguage = current.OriginalLanguage
+	}
+	if movie.Tagline == "" {
+		movie.Tagline = current.Tagline
+	}
+	if movie.LockedFields == nil {
+		movie.LockedFields = current.LockedFields
+	}
+}
+
+func (app *application) DeleteMovieHandler(w http.ResponseWriter, r *http.Request) {
+	movieID, err := readIDParam(r, "id")
+	if err != nil {
+		app.WriteJSONError(w, err)
+		return
+	}
+
+	version, ok := app.requireIfMatch(w, r, movieID)
+	if !ok {
+		return
+	}
+
+	err = app.repo.Movies.DeleteMovie(r.Context(), int64(movieID), version)
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrEditConflict):
+			app.preconditionFailed(w, r, movieID)
+		default:
+			app.WriteJSONError(w, err, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	res := JSONResponse{
+		Error:   false,
+		Message: "Movie Deleted",
+	}
+	if err := app.WriteJSON(w, http.StatusOK, res); err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+	}
+}
+
 func (app *application) MovieCatalog(w http.ResponseWriter, r *http.Request){
-	movies, err := app.repo.Movies.GetMovies(r.Context())
+	filter, err := readMovieFilter(r)
 	if err != nil {
 		app.WriteJSONError(w, err)
 		return
 	}
 
+	movies, err := app.repo.Movies.GetMovies(r.Context(), filter)
+	if err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+
 	err = app.WriteJSON(w, http.StatusOK, movies)
 	if err != nil {
 		app.WriteJSONError(w, err, http.StatusInternalServerError)
@@ -210,7 +390,25 @@ func (app *application) GetMovieHandler(w http.ResponseWriter, r *http.Request)
 
 	movie, err := app.repo.Movies.GetMovieByID(r.Context(),int64(movieID))
 	if err != nil {
-		app.WriteJSONError(w, err)
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	if err := app.embedCast(r, movie); err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	if err := app.markWatchlist(r, movie); err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+	app.events.Record(models.Event{Kind: models.EventView, MovieID: movie.ID, UserID: contextUserID(r)})
+
+	etag := movieETag(movie)
+	w.Header().Set("ETag", etag)
+	if notModified(r, etag) {
+		w.WriteHeader(http.StatusNotModified)
 		return
 	}
 
@@ -229,7 +427,14 @@ func (app *application) EditMovieHandler(w http.ResponseWriter, r *http.Request)
 
 	movie, genres, err := app.repo.Movies.EditMovie(r.Context(), int64(movieID))
 	if err != nil {
-		app.WriteJSONError(w, err)
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	etag := movieETag(movie)
+	w.Header().Set("ETag", etag)
+	if notModified(r, etag) {
+		w.WriteHeader(http.StatusNotModified)
 		return
 	}
 
@@ -258,14 +463,14 @@ func (app *application)refreshToken(w http.ResponseWriter, r *http.Request){
 				return []byte(app.cfg.authCfg.JWTSecret), nil
 			})
 			if err !=nil{
-				app.WriteJSONError(w,errors.New("unauthorised"),http.StatusUnauthorized)
+				app.WriteJSONError(w,models.Unauthorized("unauthorised"))
 				return
 			}
 
 			//get userid from token claims
 			userID,err := strconv.Atoi(claims.Subject)
 			if err !=nil{
-				app.WriteJSONError(w,errors.New("unknown user"),http.StatusUnauthorized)
+				app.WriteJSONError(w,models.Unauthorized("unknown user"))
 				return
 			}
 
@@ -276,6 +481,11 @@ func (app *application)refreshToken(w http.ResponseWriter, r *http.Request){
 				return
 			}
 
+			if user.DisabledAt != nil {
+				app.WriteJSONError(w, models.Forbidden("account disabled"))
+				return
+			}
+
 			tokens := app.generateAndSendToken(w,user)
 
 			if err := app.WriteJSON(w, http.StatusOK, tokens); err != nil {
@@ -311,48 +521,3 @@ func(app *application) logout(w http.ResponseWriter, r *http.Request){
 	http.SetCookie(w,app.auth.GetExpiredRefereshToken())
 	w.WriteHeader(http.StatusAccepted)
 }
-
-func (app *application)getPoster(movie models.Movie)models.Movie{
-	type TheMovieDB struct{
-		Page int `json:"page"`
-		Results []struct{
-			PosterPath string `json:"poster_path"`
-		}`json:"results"`
-		TotalPages int `json:"total_pages"`
-	}
-
-	client := &http.Client{}
-	theURL := app.imdb.search_url
-
-	req, err := http.NewRequest("GET",theURL+"&query="+url.QueryEscape(movie.Title),nil)
-	if err!=nil{
-		//log.Println(theURL+"&query="+url.QueryEscape(movie.Title))
-		log.Println(err)
-		return movie
-	}
-
-	req.Header.Add("Accept","application/json")
-	req.Header.Add("Content-Type","application/json")
-
-	res, err := client.Do(req)
-	if err!=nil{
-		log.Println(err)
-		return movie
-	}
-	defer res.Body.Close()
-
-	bodyBytes, err := io.ReadAll(res.Body)
-	if err!=nil{
-		log.Println(err)
-		return movie
-	}
-
-	var responseObj TheMovieDB
-	json.Unmarshal(bodyBytes,&responseObj)
-
-	if len(responseObj.Results) > 0{
-		movie.Image = responseObj.Results[0].PosterPath
-	}
-
-	return movie
-}
\ No newline at end of file
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/iamYole/go-movies/internal/repository"
+)
+
+func TestRegisterTokenNamesTheNewUser(t *testing.T) {
+	conn := newFakeDB(t, func(query string, args []driver.Value) (*fakeRows, error) {
+		if strings.Contains(query, "insert into users") {
+			return &fakeRows{columns: []string{"id"}, rows: [][]driver.Value{{int64(9)}}}, nil
+		}
+		return nil, nil
+	})
+	app := &application{
+		repo: repository.NewDbConn(conn),
+		auth: Authentication{Secret: "secret", TokenExpiry: time.Minute, RefreshExpiry: time.Hour},
+	}
+
+	body := `{"first_name": "Ada", "last_name": "Lovelace", "email": "ada@example.com", "password": "analytical"}`
+	req := httptest.NewRequest(http.MethodPost, "/register", strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	app.Register(rec, req)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("status = %d, body %s", rec.Code, rec.Body)
+	}
+
+	var signed string
+	if err := json.NewDecoder(rec.Body).Decode(&signed); err != nil {
+		t.Fatal(err)
+	}
+	claims := jwt.MapClaims{}
+	if _, err := jwt.ParseWithClaims(signed, claims, func(*jwt.Token) (any, error) {
+		return []byte("secret"), nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if sub, _ := claims.GetSubject(); sub != "9" {
+		t.Errorf("sub = %q, want %q", sub, "9")
+	}
+}
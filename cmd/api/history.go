@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/iamYole/go-movies/internal/models"
+)
+
+// AddWatchHandler logs a viewing on watched_on, today when missing,
+// optionally rating the movie at the same time
+func (app *application) AddWatchHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		MovieID   int    `json:"movie_id" validate:"gt=0"`
+		WatchedOn string `json:"watched_on"`
+		Rating    int    `json:"rating" validate:"omitempty,gte=1,lte=10"`
+	}
+	if err := app.ReadJSON(w, r, &input); err != nil {
+		app.WriteJSONError(w, err)
+		return
+	}
+
+	fieldErrors, err := validateStruct(input)
+	if err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	//dates are calendar days; a day ahead allows for time zones east of UTC
+	watchedOn := time.Now().UTC().Truncate(24 * time.Hour)
+	if input.WatchedOn != "" {
+		watchedOn, err = time.Parse(time.DateOnly, input.WatchedOn)
+		switch {
+		case err != nil:
+			fieldErrors = append(fieldErrors, FieldError{Field: "watched_on", Rule: "date", Message: "must be a date such as 2024-01-31"})
+		case watchedOn.After(time.Now().AddDate(0, 0, 1)):
+			fieldErrors = append(fieldErrors, FieldError{Field: "watched_on", Rule: "past", Message: "must not be in the future"})
+		}
+	}
+	if len(fieldErrors) > 0 {
+		app.failedValidation(w, fieldErrors)
+		return
+	}
+
+	userID := contextUserID(r)
+	watchID, err := app.repo.History.AddWatch(r.Context(), userID, input.MovieID, watchedOn, input.Rating)
+	if err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	watch, err := app.repo.History.GetWatch(r.Context(), userID, watchID)
+	if err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Location", fmt.Sprintf("/me/history/%d", watchID))
+	if err := app.WriteJSON(w, http.StatusCreated, watch); err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+	}
+}
+
+// HistoryHandler lists the caller's viewings, newest first and grouped by
+// month, optionally within ?year= or ?year=&month=, paged with
+// ?limit=&offset=
+func (app *application) HistoryHandler(w http.ResponseWriter, r *http.Request) {
+	limit, offset, err := readPage(r, 500)
+	if err != nil {
+		app.WriteJSONError(w, err)
+		return
+	}
+
+	filter := models.HistoryFilter{UserID: contextUserID(r), Limit: limit, Offset: offset}
+	qs := r.URL.Query()
+	ints := []struct {
+		name     string
+		dest     *int
+		min, max int
+	}{
+		{"year", &filter.Year, 1888, 9999},
+		{"month", &filter.Month, 1, 12},
+	}
+	for _, p := range ints {
+		if v := qs.Get(p.name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < p.min || n > p.max {
+				app.WriteJSONError(w, fmt.Errorf("invalid %s parameter", p.name))
+				return
+			}
+			*p.dest = n
+		}
+	}
+	if filter.Month > 0 && filter.Year == 0 {
+		app.WriteJSONError(w, fmt.Errorf("month requires a year parameter"))
+		return
+	}
+
+	months, err := app.repo.History.GetHistory(r.Context(), filter)
+	if err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	if err := app.WriteJSON(w, http.StatusOK, months); err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+	}
+}
+
+// DeleteWatchHandler removes a viewing from the caller's history
+func (app *application) DeleteWatchHandler(w http.ResponseWriter, r *http.Request) {
+	watchID, err := readIDParam(r, "id")
+	if err != nil {
+		app.WriteJSONError(w, err)
+		return
+	}
+
+	if err := app.repo.History.DeleteWatch(r.Context(), contextUserID(r), watchID); err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	res := JSONResponse{
+		Error:   false,
+		Message: "Watch Deleted",
+	}
+	if err := app.WriteJSON(w, http.StatusOK, res); err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+	}
+}
+
+// HistoryStatsHandler returns the caller's viewing totals, top genres and
+// viewing by year
+func (app *application) HistoryStatsHandler(w http.ResponseWriter, r *http.Request) {
+	stats, err := app.repo.History.GetWatchStats(r.Context(), contextUserID(r))
+	if err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	if err := app.WriteJSON(w, http.StatusOK, stats); err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+	}
+}
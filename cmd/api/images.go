@@ -0,0 +1,161 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/iamYole/go-movies/internal/artwork"
+	"github.com/iamYole/go-movies/internal/blob"
+	"github.com/iamYole/go-movies/internal/imaging"
+	"github.com/iamYole/go-movies/internal/models"
+	"github.com/iamYole/go-movies/internal/repository"
+)
+
+// UploadPosterHandler replaces a movie's poster with an uploaded image
+func (app *application) UploadPosterHandler(w http.ResponseWriter, r *http.Request) {
+	app.uploadArtwork(w, r, models.ImagePoster)
+}
+
+// UploadBackdropHandler replaces a movie's backdrop with an uploaded image
+func (app *application) UploadBackdropHandler(w http.ResponseWriter, r *http.Request) {
+	app.uploadArtwork(w, r, models.ImageBackdrop)
+}
+
+// uploadArtwork stores the "file" part of a multipart form as the movie's
+// artwork of kind. Uploaded artwork is never replaced by a TMDB download.
+func (app *application) uploadArtwork(w http.ResponseWriter, r *http.Request, kind string) {
+	movieID, err := readIDParam(r, "id")
+	if err != nil {
+		app.WriteJSONError(w, err)
+		return
+	}
+
+	version, ok := app.requireIfMatch(w, r, movieID)
+	if !ok {
+		return
+	}
+
+	current, _, err := app.repo.Movies.EditMovie(r.Context(), int64(movieID))
+	if err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+	if version != 0 && version != current.Version {
+		app.preconditionFailed(w, r, movieID)
+		return
+	}
+
+	//room for the multipart framing around the file
+	r.Body = http.MaxBytesReader(w, r.Body, artwork.MaxSize+1<<20)
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			app.WriteJSONError(w, fmt.Errorf("image must be at most %d bytes", artwork.MaxSize), http.StatusRequestEntityTooLarge)
+			return
+		}
+		app.WriteJSONError(w, errors.New("multipart form must include a file part"))
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, artwork.MaxSize+1))
+	if err != nil {
+		app.WriteJSONError(w, err)
+		return
+	}
+	if len(data) > artwork.MaxSize {
+		app.WriteJSONError(w, fmt.Errorf("image must be at most %d bytes", artwork.MaxSize), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	image, err := app.artwork.Save(r.Context(), movieID, kind, models.ImageSourceUpload, "", data)
+	if err != nil {
+		if errors.Is(err, imaging.ErrUnsupported) {
+			app.WriteJSONError(w, err, http.StatusUnsupportedMediaType)
+			return
+		}
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	if _, err := app.repo.Movies.SetMovieImage(r.Context(), movieID, kind, image.ID, current.Version); err != nil {
+		switch {
+		case errors.Is(err, repository.ErrEditConflict):
+			app.preconditionFailed(w, r, movieID)
+		default:
+			app.WriteJSONError(w, err, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	movie, err := app.repo.Movies.GetMovieByID(r.Context(), int64(movieID))
+	if err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("ETag", movieETag(movie))
+	if err := app.WriteJSON(w, http.StatusOK, movie); err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+	}
+}
+
+// ImageHandler serves a variant of stored artwork. An image id never changes
+// content, since new artwork always gets a new id, so responses are cached
+// for a year; the ETag is built from the content hash.
+func (app *application) ImageHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := readIDParam(r, "id")
+	if err != nil {
+		app.WriteJSONError(w, err)
+		return
+	}
+
+	variant := chi.URLParam(r, "variant")
+	if !models.IsImageVariant(variant) {
+		app.WriteJSONError(w, fmt.Errorf("unknown image variant %q", variant), http.StatusNotFound)
+		return
+	}
+
+	image, err := app.repo.Images.GetImage(r.Context(), int64(id))
+	if err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	etag := fmt.Sprintf(`"%s-%s"`, image.Hash, variant)
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	if notModified(r, etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	body, obj, err := app.artwork.Store.Get(r.Context(), image.Key(variant))
+	if err != nil {
+		w.Header().Del("Cache-Control")
+		w.Header().Del("ETag")
+		if errors.Is(err, blob.ErrNotFound) {
+			app.WriteJSONError(w, errors.New("image not found"), http.StatusNotFound)
+			return
+		}
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+	defer body.Close()
+
+	w.Header().Set("Content-Type", obj.ContentType)
+	if obj.Size > 0 {
+		w.Header().Set("Content-Length", strconv.FormatInt(obj.Size, 10))
+	}
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusOK)
+	if _, err := io.Copy(w, body); err != nil {
+		log.Printf("serving image %d %s: %v", id, variant, err)
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+
+	"github.com/iamYole/go-movies/internal/enrich"
+	"github.com/iamYole/go-movies/internal/importer"
+	"github.com/iamYole/go-movies/internal/models"
+	"github.com/iamYole/go-movies/internal/similar"
+)
+
+// maxImportBytes bounds a catalog upload
+const maxImportBytes = 32 << 20
+
+type RowError struct {
+	Row int `json:"row"`
+	FieldError
+}
+
+type importResult struct {
+	DryRun   bool       `json:"dry_run"`
+	Total    int        `json:"total"`
+	Valid    int        `json:"valid"`
+	Imported int        `json:"imported"`
+	Updated  int        `json:"updated"`
+	IDs      []int      `json:"ids,omitempty"`
+	Errors   []RowError `json:"errors"`
+}
+
+// ImportMoviesHandler loads a CSV or NDJSON catalog, either as the raw body
+// or as the "file" part of a multipart form. Nothing is written unless every
+// row is valid, and nothing at all with ?dry_run=true.
+func (app *application) ImportMoviesHandler(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportBytes)
+
+	body, format, err := importSource(r)
+	if err != nil {
+		app.WriteJSONError(w, err)
+		return
+	}
+	defer body.Close()
+
+	if f := r.URL.Query().Get("format"); f != "" {
+		format = f
+	}
+
+	rows, err := importer.Parse(body, format)
+	if err != nil {
+		if errors.Is(err, importer.ErrUnknownFormat) {
+			app.WriteJSONError(w, errors.New("upload must be csv or ndjson"), http.StatusUnsupportedMediaType)
+			return
+		}
+		app.WriteJSONError(w, err)
+		return
+	}
+
+	dryRun, _ := strconv.ParseBool(r.URL.Query().Get("dry_run"))
+	res := importResult{
+		DryRun: dryRun,
+		Total:  len(rows),
+		Errors: []RowError{},
+	}
+
+	var movies []models.ImportMovie
+	for _, row := range rows {
+		if row.Err != nil {
+			res.Errors = append(res.Errors, RowError{
+				Row:        row.Line,
+				FieldError: FieldError{Rule: "parse", Message: row.Err.Error()},
+			})
+			continue
+		}
+
+		fieldErrors, err := validateStruct(row.Movie.Movie)
+		if err != nil {
+			app.WriteJSONError(w, err, http.StatusInternalServerError)
+			return
+		}
+		for _, fe := range fieldErrors {
+			res.Errors = append(res.Errors, RowError{Row: row.Line, FieldError: fe})
+		}
+		if len(fieldErrors) == 0 {
+			movies = append(movies, row.Movie)
+		}
+	}
+	res.Valid = len(movies)
+
+	if dryRun {
+		if err := app.WriteJSON(w, http.StatusOK, res); err != nil {
+			app.WriteJSONError(w, err, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if len(res.Errors) > 0 {
+		if err := app.WriteJSON(w, http.StatusUnprocessableEntity, res); err != nil {
+			app.WriteJSONError(w, err, http.StatusInternalServerError)
+		}
+		return
+	}
+
+	ids, inserted, updated, err := app.repo.Movies.ImportMovies(r.Context(), movies)
+	if err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+	res.Imported = inserted
+	res.Updated = updated
+	res.IDs = ids
+
+	if app.tmdb.Configured() {
+		if err := enrich.EnqueueMany(r.Context(), app.repo.Jobs, ids); err != nil {
+			log.Println("enqueue enrichment of imported movies:", err)
+		}
+	}
+	if inserted+updated > 0 {
+		if err := similar.EnqueueRebuild(r.Context(), app.repo.Jobs); err != nil {
+			log.Println("enqueue similar movies rebuild after import:", err)
+		}
+	}
+
+	if err := app.WriteJSON(w, http.StatusCreated, res); err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+	}
+}
+
+// importSource finds the uploaded file and guesses its format from the
+// content type or file name
+func importSource(r *http.Request) (io.ReadCloser, string, error) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+	if mediaType != "multipart/form-data" {
+		return r.Body, importer.FormatFor(mediaType, ""), nil
+	}
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		return nil, "", errors.New("multipart upload must include a file field")
+	}
+
+	partType, _, _ := mime.ParseMediaType(header.Header.Get("Content-Type"))
+	return file, importer.FormatFor(partType, header.Filename), nil
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"database/sql/driver"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/iamYole/go-movies/internal/enrich"
+	"github.com/iamYole/go-movies/internal/repository"
+	"github.com/iamYole/go-movies/internal/tmdb"
+	"github.com/lib/pq"
+)
+
+func TestImportRepeatedRowEnqueuesOneEnrichment(t *testing.T) {
+	var enqueued []string
+	conn := newFakeDB(t, func(query string, args []driver.Value) (*fakeRows, error) {
+		switch {
+		case strings.Contains(query, "from genres g"):
+			return &fakeRows{columns: []string{"id", "genre"}, rows: [][]driver.Value{{int64(1), "drama"}}}, nil
+		case strings.Contains(query, "nextval"):
+			return &fakeRows{columns: []string{"nextval"}, rows: [][]driver.Value{{int64(42)}}}, nil
+		case strings.Contains(query, "insert into jobs") && strings.Contains(query, "unnest"):
+			var kinds, keys pq.StringArray
+			if err := kinds.Scan(args[0]); err != nil {
+				return nil, err
+			}
+			if err := keys.Scan(args[1]); err != nil {
+				return nil, err
+			}
+			//as postgres does for an upsert touching one row twice
+			var batch []string
+			for i := range kinds {
+				k := kinds[i] + "/" + keys[i]
+				if slices.Contains(batch, k) {
+					return nil, errors.New("pq: ON CONFLICT DO UPDATE command cannot affect row a second time")
+				}
+				batch = append(batch, k)
+			}
+			enqueued = append(enqueued, batch...)
+		case strings.Contains(query, "insert into jobs"):
+			return &fakeRows{columns: []string{"id"}, rows: [][]driver.Value{{int64(1)}}}, nil
+		}
+		return nil, nil
+	})
+
+	client, err := tmdb.New(tmdb.Config{APIKey: "key"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := &application{repo: repository.NewDbConn(conn), tmdb: client}
+
+	body := "title,release_date,runtime,mpaa_rating,genres,imdb_id\n" +
+		"Arrival,2016-11-11,116,PG13,Drama,tt2543164\n" +
+		"Arrival,2016-11-11,116,PG13,Drama,tt2543164\n"
+	req := httptest.NewRequest(http.MethodPost, "/admin/movies/import", strings.NewReader(body))
+	req.Header.Set("Content-Type", "text/csv")
+	rec := httptest.NewRecorder()
+
+	app.ImportMoviesHandler(rec, req)
+
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("status = %d, body %s", rec.Code, rec.Body)
+	}
+	want := enrich.JobKind + "/movie:42"
+	if len(enqueued) != 1 || enqueued[0] != want {
+		t.Errorf("enqueued %q, want [%s]", enqueued, want)
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/iamYole/go-movies/internal/enrich"
+	"github.com/iamYole/go-movies/internal/models"
+	"github.com/iamYole/go-movies/internal/similar"
+)
+
+// enqueueEnrichment queues a TMDB lookup for a movie. The movie is already
+// saved by the time this runs, so a failure is logged rather than returned.
+func (app *application) enqueueEnrichment(ctx context.Context, movieID int, titleChanged bool) {
+	if !app.tmdb.Configured() {
+		return
+	}
+	if err := enrich.Enqueue(ctx, app.repo.Jobs, movieID, titleChanged); err != nil {
+		log.Printf("enqueue enrichment of movie %d: %v", movieID, err)
+	}
+}
+
+// enqueueSimilar queues a refresh of a movie's similar movies after it, its
+// genres or its credits change. Like enrichment, a failure is only logged.
+func (app *application) enqueueSimilar(ctx context.Context, movieID int) {
+	if err := similar.Enqueue(ctx, app.repo.Jobs, movieID); err != nil {
+		log.Printf("enqueue similar movies of movie %d: %v", movieID, err)
+	}
+}
+
+// ListJobsHandler lists queued jobs, newest first, filtered by
+// ?status=&kind= and paged with ?limit=&offset=
+func (app *application) ListJobsHandler(w http.ResponseWriter, r *http.Request) {
+	limit, offset, err := readPage(r, 500)
+	if err != nil {
+		app.WriteJSONError(w, err)
+		return
+	}
+
+	qs := r.URL.Query()
+	filter := models.JobFilter{
+		Status: qs.Get("status"),
+		Kind:   qs.Get("kind"),
+		Limit:  limit,
+		Offset: offset,
+	}
+
+	if filter.Status != "" && !contains(models.JobStatuses, filter.Status) {
+		app.WriteJSONError(w, fmt.Errorf("invalid status parameter"))
+		return
+	}
+
+	jobs, err := app.repo.Jobs.GetJobs(r.Context(), filter)
+	if err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+	if jobs == nil {
+		jobs = []*models.Job{}
+	}
+
+	if err := app.WriteJSON(w, http.StatusOK, jobs); err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+	}
+}
+
+func (app *application) GetJobHandler(w http.ResponseWriter, r *http.Request) {
+	jobID, err := readIDParam(r, "id")
+	if err != nil {
+		app.WriteJSONError(w, err)
+		return
+	}
+
+	job, err := app.repo.Jobs.GetJob(r.Context(), int64(jobID))
+	if err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	if err := app.WriteJSON(w, http.StatusOK, job); err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+	}
+}
+
+// RetryJobHandler queues a failed or finished job to run again now
+func (app *application) RetryJobHandler(w http.ResponseWriter, r *http.Request) {
+	jobID, err := readIDParam(r, "id")
+	if err != nil {
+		app.WriteJSONError(w, err)
+		return
+	}
+
+	job, err := app.repo.Jobs.RetryJob(r.Context(), int64(jobID))
+	if err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	if err := app.WriteJSON(w, http.StatusAccepted, job); err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+	}
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
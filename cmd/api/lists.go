@@ -0,0 +1,329 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/iamYole/go-movies/internal/models"
+)
+
+// readListID reads the {listID} route param, which is a list id or
+// "watchlist" for the caller's watchlist
+func (app *application) readListID(r *http.Request) (int, error) {
+	if chi.URLParam(r, "listID") == "watchlist" {
+		return app.repo.Lists.WatchlistID(r.Context(), contextUserID(r))
+	}
+	return readIDParam(r, "listID")
+}
+
+// MyListsHandler returns the caller's lists, watchlist first
+func (app *application) MyListsHandler(w http.ResponseWriter, r *http.Request) {
+	lists, err := app.repo.Lists.GetLists(r.Context(), contextUserID(r))
+	if err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	if err := app.WriteJSON(w, http.StatusOK, lists); err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+	}
+}
+
+// GetMyListHandler returns one of the caller's lists with its items
+func (app *application) GetMyListHandler(w http.ResponseWriter, r *http.Request) {
+	listID, err := app.readListID(r)
+	if err != nil {
+		app.WriteJSONError(w, err)
+		return
+	}
+
+	list, err := app.repo.Lists.GetList(r.Context(), contextUserID(r), listID)
+	if err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	if err := app.WriteJSON(w, http.StatusOK, list); err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+	}
+}
+
+// PublicListHandler returns an unlisted or public list by its slug
+func (app *application) PublicListHandler(w http.ResponseWriter, r *http.Request) {
+	list, err := app.repo.Lists.GetListBySlug(r.Context(), chi.URLParam(r, "slug"))
+	if err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	if err := app.WriteJSON(w, http.StatusOK, list); err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+	}
+}
+
+// readList decodes and validates a list body, answering the request itself
+// when that fails. Lists are private unless a visibility is given.
+func (app *application) readList(w http.ResponseWriter, r *http.Request) (models.List, bool) {
+	var input struct {
+		Name        string `json:"name"`
+		Description string `json:"description"`
+		Visibility  string `json:"visibility"`
+	}
+	if err := app.ReadJSON(w, r, &input); err != nil {
+		app.WriteJSONError(w, err)
+		return models.List{}, false
+	}
+
+	list := models.List{
+		UserID:      contextUserID(r),
+		Name:        strings.TrimSpace(input.Name),
+		Description: strings.TrimSpace(input.Description),
+		Visibility:  input.Visibility,
+	}
+	if list.Visibility == "" {
+		list.Visibility = models.ListPrivate
+	}
+
+	fieldErrors, err := validateStruct(list)
+	if err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+		return list, false
+	}
+	if len(fieldErrors) > 0 {
+		app.failedValidation(w, fieldErrors)
+		return list, false
+	}
+	return list, true
+}
+
+func (app *application) InsertListHandler(w http.ResponseWriter, r *http.Request) {
+	list, ok := app.readList(w, r)
+	if !ok {
+		return
+	}
+
+	listID, err := app.repo.Lists.InsertList(r.Context(), list)
+	if err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	app.writeList(w, r, listID, http.StatusCreated)
+}
+
+// UpdateListHandler renames a list or changes its description or visibility
+func (app *application) UpdateListHandler(w http.ResponseWriter, r *http.Request) {
+	listID, err := app.readListID(r)
+	if err != nil {
+		app.WriteJSONError(w, err)
+		return
+	}
+
+	list, ok := app.readList(w, r)
+	if !ok {
+		return
+	}
+	list.ID = listID
+
+	if err := app.repo.Lists.UpdateList(r.Context(), list); err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	app.writeList(w, r, listID, http.StatusOK)
+}
+
+// DeleteListHandler removes a custom list; the watchlist stays
+func (app *application) DeleteListHandler(w http.ResponseWriter, r *http.Request) {
+	listID, err := app.readListID(r)
+	if err != nil {
+		app.WriteJSONError(w, err)
+		return
+	}
+
+	if err := app.repo.Lists.DeleteList(r.Context(), contextUserID(r), listID); err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	res := JSONResponse{
+		Error:   false,
+		Message: "List Deleted",
+	}
+	if err := app.WriteJSON(w, http.StatusOK, res); err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+	}
+}
+
+// AddListItemHandler adds a movie to a list, at the end unless a position
+// is given
+func (app *application) AddListItemHandler(w http.ResponseWriter, r *http.Request) {
+	listID, err := app.readListID(r)
+	if err != nil {
+		app.WriteJSONError(w, err)
+		return
+	}
+
+	var input struct {
+		MovieID  int    `json:"movie_id"`
+		Position int    `json:"position"`
+		Note     string `json:"note"`
+	}
+	if err := app.ReadJSON(w, r, &input); err != nil {
+		app.WriteJSONError(w, err)
+		return
+	}
+
+	item := models.ListItem{MovieID: input.MovieID, Position: input.Position, Note: strings.TrimSpace(input.Note)}
+	fieldErrors, err := validateStruct(item)
+	if err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+	if item.MovieID < 1 {
+		fieldErrors = append(fieldErrors, FieldError{Field: "movie_id", Rule: "required", Message: "is required"})
+	}
+	if len(fieldErrors) > 0 {
+		app.failedValidation(w, fieldErrors)
+		return
+	}
+
+	if err := app.repo.Lists.AddListItem(r.Context(), contextUserID(r), listID, item); err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	app.writeList(w, r, listID, http.StatusCreated)
+}
+
+// UpdateListItemHandler changes the note on a movie in a list
+func (app *application) UpdateListItemHandler(w http.ResponseWriter, r *http.Request) {
+	listID, movieID, ok := app.readListItemParams(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Note string `json:"note" validate:"max=1000"`
+	}
+	if err := app.ReadJSON(w, r, &input); err != nil {
+		app.WriteJSONError(w, err)
+		return
+	}
+	input.Note = strings.TrimSpace(input.Note)
+
+	fieldErrors, err := validateStruct(input)
+	if err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+	if len(fieldErrors) > 0 {
+		app.failedValidation(w, fieldErrors)
+		return
+	}
+
+	if err := app.repo.Lists.UpdateListItem(r.Context(), contextUserID(r), listID, movieID, input.Note); err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	app.writeList(w, r, listID, http.StatusOK)
+}
+
+// RemoveListItemHandler takes a movie out of a list
+func (app *application) RemoveListItemHandler(w http.ResponseWriter, r *http.Request) {
+	listID, movieID, ok := app.readListItemParams(w, r)
+	if !ok {
+		return
+	}
+
+	if err := app.repo.Lists.RemoveListItem(r.Context(), contextUserID(r), listID, movieID); err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	app.writeList(w, r, listID, http.StatusOK)
+}
+
+// ReorderListHandler puts a list in the order of movie_ids, which must name
+// every movie in the list once
+func (app *application) ReorderListHandler(w http.ResponseWriter, r *http.Request) {
+	listID, err := app.readListID(r)
+	if err != nil {
+		app.WriteJSONError(w, err)
+		return
+	}
+
+	var input struct {
+		MovieIDs []int `json:"movie_ids"`
+	}
+	if err := app.ReadJSON(w, r, &input); err != nil {
+		app.WriteJSONError(w, err)
+		return
+	}
+	if input.MovieIDs == nil {
+		app.failedValidation(w, []FieldError{{Field: "movie_ids", Rule: "required", Message: "is required"}})
+		return
+	}
+
+	if err := app.repo.Lists.ReorderList(r.Context(), contextUserID(r), listID, input.MovieIDs); err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	app.writeList(w, r, listID, http.StatusOK)
+}
+
+func (app *application) readListItemParams(w http.ResponseWriter, r *http.Request) (int, int, bool) {
+	listID, err := app.readListID(r)
+	if err != nil {
+		app.WriteJSONError(w, err)
+		return 0, 0, false
+	}
+	movieID, err := readIDParam(r, "movieID")
+	if err != nil {
+		app.WriteJSONError(w, err)
+		return 0, 0, false
+	}
+	return listID, movieID, true
+}
+
+// writeList answers with the list as it now stands
+func (app *application) writeList(w http.ResponseWriter, r *http.Request, listID, status int) {
+	list, err := app.repo.Lists.GetList(r.Context(), contextUserID(r), listID)
+	if err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	if status == http.StatusCreated {
+		w.Header().Set("Location", fmt.Sprintf("/me/lists/%d", listID))
+	}
+	if err := app.WriteJSON(w, status, list); err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+	}
+}
+
+// markWatchlist sets in_watchlist on movies for a signed in caller
+func (app *application) markWatchlist(r *http.Request, movies ...*models.Movie) error {
+	userID := contextUserID(r)
+	if userID == 0 || len(movies) == 0 {
+		return nil
+	}
+
+	ids := make([]int, len(movies))
+	for i, m := range movies {
+		ids[i] = m.ID
+	}
+	flags, err := app.repo.Lists.WatchlistFlags(r.Context(), userID, ids)
+	if err != nil {
+		return err
+	}
+	for _, m := range movies {
+		in := flags[m.ID]
+		m.InWatchlist = &in
+	}
+	return nil
+}
@@ -1,34 +1,58 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 	"time"
 
+	"github.com/iamYole/go-movies/internal/artwork"
+	"github.com/iamYole/go-movies/internal/autocomplete"
+	"github.com/iamYole/go-movies/internal/blob"
 	"github.com/iamYole/go-movies/internal/db"
+	"github.com/iamYole/go-movies/internal/enrich"
 	"github.com/iamYole/go-movies/internal/env"
+	"github.com/iamYole/go-movies/internal/events"
+	"github.com/iamYole/go-movies/internal/jobs"
+	"github.com/iamYole/go-movies/internal/moderation"
+	"github.com/iamYole/go-movies/internal/recommend"
 	"github.com/iamYole/go-movies/internal/repository"
+	"github.com/iamYole/go-movies/internal/similar"
+	"github.com/iamYole/go-movies/internal/tmdb"
 )
 
 const port = 8080
 
 type application struct {
-	Domain string
-	cfg    config
-	repo   repository.Repository
-	auth   Authentication
-	imdb imdb_config
-}
-type imdb_config struct{
-	API_KEY string
-	search_url string
+	Domain       string
+	cfg          config
+	repo         repository.Repository
+	auth         Authentication
+	tmdb         *tmdb.Client
+	artwork      *artwork.Service
+	comments     commentConfig
+	recommend    *recommend.Service
+	events       *events.Recorder
+	autocomplete *autocomplete.Service
 }
 type config struct {
 	port    int
 	dsn     dbconnection
 	authCfg authConfig
 }
+type commentConfig struct {
+	//comments matching the word list wait for a moderator
+	words *moderation.WordList
+	//reports that send a visible comment to the queue, 0 never does
+	reportThreshold int
+}
 type dbconnection struct {
 	dsn string
 }
@@ -42,6 +66,9 @@ type authConfig struct {
 }
 
 func main() {
+	migrateOnStart := flag.Bool("migrate", env.GetBool("MIGRATE_ON_START", false), "apply pending database migrations before serving")
+	flag.Parse()
+
 	cfg := config{
 		port: env.GetInt("PORT", 8080),
 		dsn: dbconnection{
@@ -65,8 +92,59 @@ func main() {
 	defer db.Close()
 	log.Println("database connection established")
 
+	if flag.Arg(0) == "migrate" {
+		if err := runMigrate(db, flag.Args()[1:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if flag.Arg(0) == "evaluate" {
+		if err := runEvaluate(db, flag.Args()[1:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if *migrateOnStart {
+		if err := runMigrate(db, []string{"up"}); err != nil {
+			log.Fatal(err)
+		}
+	}
+
 	repo := repository.NewDbConn(db)
 
+	//TMDB_API_KEY replaces the older, misnamed IMDB_API_KEY
+	tmdbClient, err := tmdb.New(tmdb.Config{
+		APIKey:     env.GetString("TMDB_API_KEY", env.GetString("IMDB_API_KEY", "")),
+		BaseURL:    env.GetString("TMDB_BASE_URL", ""),
+		SearchURL:  env.GetString("SEARCH_URL", ""),
+		Timeout:    time.Duration(env.GetInt("TMDB_TIMEOUT_SECONDS", 5)) * time.Second,
+		MaxRetries: env.GetInt("TMDB_MAX_RETRIES", 3),
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	if !tmdbClient.Configured() {
+		log.Println("TMDB_API_KEY is not set, metadata enrichment is disabled")
+	}
+
+	store, err := imageStore()
+	if err != nil {
+		log.Fatal(err)
+	}
+	artworkService := &artwork.Service{
+		Movies: repo.Movies,
+		Images: repo.Images,
+		Store:  store,
+	}
+
+	words, err := moderation.LoadWordList(env.GetString("COMMENT_WORDLIST_FILE", ""),
+		strings.Split(env.GetString("COMMENT_BLOCKED_WORDS", ""), ","))
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	app := &application{
 		Domain: env.GetString("DOMAIN", "example.com"),
 		cfg:    cfg,
@@ -81,15 +159,131 @@ func main() {
 			CookieName:    env.GetString("COOKIE_NAME", "__HOST-referesh_teken"),
 			CookieDomain:  cfg.authCfg.CookieDomain,
 		},
-		imdb: imdb_config{
-			API_KEY: env.GetString("IMDB_API_KEY","12345"),
-			search_url: env.GetString("SEARCH_URL","url"),
+		tmdb:    tmdbClient,
+		artwork: artworkService,
+		comments: commentConfig{
+			words:           words,
+			reportThreshold: env.GetInt("COMMENT_REPORT_THRESHOLD", 3),
+		},
+		recommend: &recommend.Service{
+			Store:     repo.Recommendations,
+			MinCommon: env.GetInt("RECOMMEND_MIN_COMMON", 2),
+		},
+		events: events.NewRecorder(repo.Events, events.Options{
+			Buffer: env.GetInt("EVENT_BUFFER", 10000),
+			Batch:  env.GetInt("EVENT_BATCH", 500),
+			Flush:  time.Duration(env.GetInt("EVENT_FLUSH_SECONDS", 5)) * time.Second,
+		}),
+		autocomplete: &autocomplete.Service{
+			Store: repo.Autocomplete,
+			Cache: autocomplete.NewCache(env.GetInt("AUTOCOMPLETE_CACHE_SIZE", 5000),
+				time.Duration(env.GetInt("AUTOCOMPLETE_CACHE_SECONDS", 60))*time.Second),
 		},
 	}
 
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	//background workers; JOB_WORKERS=0 leaves the queue to other instances
+	workers := env.GetInt("JOB_WORKERS", 2)
+	runner := jobs.NewRunner(repo.Jobs, jobs.Options{Workers: workers})
+	if tmdbClient.Configured() && workers > 0 {
+		enricher := &enrich.Enricher{
+			Movies:      repo.Movies,
+			TMDB:        tmdbClient,
+			Jobs:        repo.Jobs,
+			MaxAge:      time.Duration(env.GetInt("TMDB_RESYNC_AFTER_DAYS", 30)) * 24 * time.Hour,
+			ResyncBatch: env.GetInt("TMDB_RESYNC_BATCH", 500),
+			//off by default, leaving the frontend to load posters from TMDB
+			DownloadArtwork: env.GetBool("TMDB_DOWNLOAD_ARTWORK", false),
+		}
+		runner.Handle(enrich.JobKind, enricher.Handle)
+		runner.Handle(artwork.JobKind, artworkService.Handle)
+		runner.Handle(enrich.ResyncJobKind, enricher.HandleResync)
+		if every := env.GetInt("TMDB_RESYNC_EVERY_HOURS", 24); every > 0 {
+			runner.Schedule(enrich.ResyncJobKind, time.Duration(every)*time.Hour)
+		}
+	}
+	if workers > 0 {
+		refresher := &similar.Refresher{
+			Store:  repo.Similar,
+			Scorer: similar.Default(),
+			Limit:  maxSimilar,
+			//above what release year and audience alone can reach
+			MinScore: 0.35,
+		}
+		runner.Handle(similar.JobKind, refresher.Handle)
+		runner.Handle(similar.RebuildJobKind, refresher.HandleRebuild)
+		if every := env.GetInt("SIMILAR_REBUILD_EVERY_HOURS", 24); every > 0 {
+			runner.Schedule(similar.RebuildJobKind, time.Duration(every)*time.Hour)
+		}
+
+		runner.Handle(recommend.JobKind, app.recommend.Handle)
+		if every := env.GetInt("RECOMMEND_REBUILD_EVERY_HOURS", 6); every > 0 {
+			runner.Schedule(recommend.JobKind, time.Duration(every)*time.Hour)
+		}
+
+		trending := &events.Trending{
+			Store:     repo.Events,
+			Retention: time.Duration(env.GetInt("EVENT_RETENTION_DAYS", 30)) * 24 * time.Hour,
+		}
+		runner.Handle(events.JobKind, trending.Handle)
+		if every := env.GetInt("TRENDING_EVERY_MINUTES", 10); every > 0 {
+			runner.Schedule(events.JobKind, time.Duration(every)*time.Minute)
+		}
+	}
+	workersDone := make(chan struct{})
+	go func() {
+		runner.Run(ctx)
+		close(workersDone)
+	}()
+
+	//events outlive ctx until the server has stopped taking requests
+	eventsCtx, stopEvents := context.WithCancel(context.Background())
+	eventsDone := make(chan struct{})
+	go func() {
+		app.events.Run(eventsCtx)
+		close(eventsDone)
+	}()
+
+	srv := &http.Server{
+		Addr:    fmt.Sprintf(":%d", app.cfg.port),
+		Handler: app.routes(),
+	}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdownCtx)
+		stopEvents()
+	}()
+
 	log.Println("Startng server on port ", port)
-	err = http.ListenAndServe(fmt.Sprintf(":%d", app.cfg.port), app.routes())
-	if err != nil {
+	err = srv.ListenAndServe()
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
 		log.Fatal(err)
 	}
+
+	<-workersDone
+	<-eventsDone
+	log.Println("server stopped")
+}
+
+// imageStore builds the blob store for artwork from IMAGE_STORE, which is
+// local (the default) or s3
+func imageStore() (blob.Store, error) {
+	switch kind := env.GetString("IMAGE_STORE", "local"); kind {
+	case "local":
+		return blob.NewLocal(env.GetString("IMAGE_DIR", "./data/images"))
+	case "s3":
+		return blob.NewS3(blob.S3Config{
+			Endpoint:  env.GetString("S3_ENDPOINT", ""),
+			Region:    env.GetString("S3_REGION", ""),
+			Bucket:    env.GetString("S3_BUCKET", ""),
+			AccessKey: env.GetString("S3_ACCESS_KEY", ""),
+			SecretKey: env.GetString("S3_SECRET_KEY", ""),
+		})
+	default:
+		return nil, fmt.Errorf("IMAGE_STORE must be local or s3, not %q", kind)
+	}
 }
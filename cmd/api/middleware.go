@@ -1,18 +1,102 @@
 package main
 
 import (
+	"errors"
 	"log"
 	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/iamYole/go-movies/internal/models"
 )
 
 func (app *application) authRequired(next http.Handler) http.Handler{
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		_,_,err := app.auth.GetTokenFromHeaderAndVerify(w,r)
+		_,claims,err := app.auth.GetTokenFromHeaderAndVerify(w,r)
 		if err!=nil{
-			w.WriteHeader(http.StatusUnauthorized)
 			log.Println(err)
+			app.WriteJSONError(w, models.Unauthorized("authentication required"))
+			return
+		}
+
+		userID, err := strconv.Atoi(claims.Subject)
+		if err != nil || userID < 1 {
+			app.WriteJSONError(w, models.Unauthorized("authentication required"))
+			return
+		}
+
+		//a token outlives the account it was issued for, so disabling a user
+		//must be checked on every request rather than at sign in only
+		user, err := app.repo.Users.GetUserByID(r.Context(), int64(userID))
+		if errors.Is(err, models.ErrNotFound) {
+			app.WriteJSONError(w, models.Unauthorized("authentication required"))
+			return
+		}
+		if err != nil {
+			app.WriteJSONError(w, err, http.StatusInternalServerError)
+			return
+		}
+		if user.DisabledAt != nil {
+			app.WriteJSONError(w, models.Forbidden("account disabled"))
+			return
+		}
+		next.ServeHTTP(w, contextSetUserID(r, userID))
+	})
+}
+
+// authOptional identifies the caller when a valid token is sent and lets
+// anonymous requests through, for public responses with per user details
+func (app *application) authOptional(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Authorization")
+		if r.Header.Get("Authorization") == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		_, claims, err := app.auth.GetTokenFromHeaderAndVerify(w, r)
+		if err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if userID, err := strconv.Atoi(claims.Subject); err == nil && userID > 0 {
+			r = contextSetUserID(r, userID)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// adminRequired lets through only administrators; it runs after authRequired
+func (app *application) adminRequired(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, err := app.repo.Users.GetUserByID(r.Context(), int64(contextUserID(r)))
+		if err != nil {
+			app.WriteJSONError(w, models.Unauthorized("authentication required"))
 			return
 		}
-		next.ServeHTTP(w,r)
+		if !user.IsAdmin || user.DisabledAt != nil {
+			app.WriteJSONError(w, models.Forbidden("administrator access required"))
+			return
+		}
+		next.ServeHTTP(w, r)
 	})
-}
\ No newline at end of file
+}
+
+// requireActiveUser answers 403 itself when the signed in user may not post,
+// because their account is disabled or suspended
+func (app *application) requireActiveUser(w http.ResponseWriter, r *http.Request) bool {
+	user, err := app.repo.Users.GetUserByID(r.Context(), int64(contextUserID(r)))
+	if err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+		return false
+	}
+	switch {
+	case user.DisabledAt != nil:
+		app.WriteJSONError(w, models.Forbidden("account disabled"))
+		return false
+	case user.Suspended():
+		app.WriteJSONError(w, models.Forbidden("account suspended until "+user.SuspendedUntil.UTC().Format(time.RFC3339)))
+		return false
+	}
+	return true
+}
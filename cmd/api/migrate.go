@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+
+	"github.com/iamYole/go-movies/internal/db"
+)
+
+const migrateUsage = "usage: api migrate up | down [steps] | status | to <version>"
+
+// runMigrate implements the migrate subcommand
+func runMigrate(conn *sql.DB, args []string) error {
+	migrator, err := db.NewMigrator(conn)
+	if err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+
+	ctx := context.Background()
+	var done []db.Migration
+
+	switch args[0] {
+	case "up":
+		done, err = migrator.Up(ctx)
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			if steps, err = strconv.Atoi(args[1]); err != nil || steps < 1 {
+				return errors.New(migrateUsage)
+			}
+		}
+		done, err = migrator.Down(ctx, steps)
+	case "to":
+		if len(args) < 2 {
+			return errors.New(migrateUsage)
+		}
+		version, convErr := strconv.Atoi(args[1])
+		if convErr != nil || version < 0 {
+			return errors.New(migrateUsage)
+		}
+		done, err = migrator.To(ctx, version)
+	case "status":
+		status, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		for _, s := range status {
+			applied := "pending"
+			if s.AppliedAt != nil {
+				applied = s.AppliedAt.Format("2006-01-02 15:04:05 MST")
+			}
+			fmt.Printf("%04d  %-30s  %s\n", s.Version, s.Name, applied)
+		}
+		return nil
+	default:
+		return errors.New(migrateUsage)
+	}
+
+	for _, m := range done {
+		log.Printf("migrated %04d_%s", m.Version, m.Name)
+	}
+	if err == nil && len(done) == 0 {
+		log.Println("no migrations to run")
+	}
+	return err
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/iamYole/go-movies/internal/models"
+)
+
+// ModerationQueueHandler lists the comments waiting for a moderator,
+// longest waiting first, paged with ?limit=&offset=
+func (app *application) ModerationQueueHandler(w http.ResponseWriter, r *http.Request) {
+	limit, offset, err := readPage(r, 200)
+	if err != nil {
+		app.WriteJSONError(w, err)
+		return
+	}
+
+	queue, err := app.repo.Comments.GetModerationQueue(r.Context(), limit, offset)
+	if err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	if err := app.WriteJSON(w, http.StatusOK, queue); err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+	}
+}
+
+// ModerationActionsHandler lists the moderation log, newest first, filtered
+// by ?comment_id=&user_id= and paged with ?limit=&offset=
+func (app *application) ModerationActionsHandler(w http.ResponseWriter, r *http.Request) {
+	limit, offset, err := readPage(r, 500)
+	if err != nil {
+		app.WriteJSONError(w, err)
+		return
+	}
+
+	filter := models.ActionFilter{Limit: limit, Offset: offset}
+	qs := r.URL.Query()
+	ints := []struct {
+		name string
+		dest *int
+	}{
+		{"comment_id", &filter.CommentID},
+		{"user_id", &filter.UserID},
+	}
+	for _, p := range ints {
+		if v := qs.Get(p.name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				app.WriteJSONError(w, fmt.Errorf("invalid %s parameter", p.name))
+				return
+			}
+			*p.dest = n
+		}
+	}
+
+	actions, err := app.repo.Comments.GetModerationActions(r.Context(), filter)
+	if err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	if err := app.WriteJSON(w, http.StatusOK, actions); err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+	}
+}
+
+// ModerateCommentHandler approves, hides or deletes a comment, whether or
+// not it is in the queue
+func (app *application) ModerateCommentHandler(w http.ResponseWriter, r *http.Request) {
+	commentID, err := readIDParam(r, "id")
+	if err != nil {
+		app.WriteJSONError(w, err)
+		return
+	}
+
+	action := chi.URLParam(r, "action")
+	if !contains(models.CommentActions, action) {
+		app.WriteJSONError(w, models.NotFound("moderation action"))
+		return
+	}
+
+	var input struct {
+		Reason string `json:"reason" validate:"max=1000"`
+	}
+	if !app.readModerationInput(w, r, &input) {
+		return
+	}
+
+	err = app.repo.Comments.ModerateComment(r.Context(), commentID, contextUserID(r), action, strings.TrimSpace(input.Reason))
+	if err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	comment, err := app.repo.Comments.GetComment(r.Context(), commentID)
+	if err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	if err := app.WriteJSON(w, http.StatusOK, comment); err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+	}
+}
+
+// WarnUserHandler records a warning against a comment's author, or any user
+func (app *application) WarnUserHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := readIDParam(r, "id")
+	if err != nil {
+		app.WriteJSONError(w, err)
+		return
+	}
+
+	var input struct {
+		Reason    string `json:"reason" validate:"required,max=1000"`
+		CommentID *int   `json:"comment_id"`
+	}
+	if !app.readModerationInput(w, r, &input) {
+		return
+	}
+
+	err = app.repo.Comments.WarnUser(r.Context(), userID, contextUserID(r), input.CommentID, strings.TrimSpace(input.Reason))
+	if err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	app.writeModeratedUser(w, r, userID)
+}
+
+// SuspendUserHandler stops a user commenting and reviewing for up to a year
+func (app *application) SuspendUserHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := readIDParam(r, "id")
+	if err != nil {
+		app.WriteJSONError(w, err)
+		return
+	}
+
+	var input struct {
+		Reason    string `json:"reason" validate:"required,max=1000"`
+		Days      int    `json:"days" validate:"gt=0,lte=365"`
+		CommentID *int   `json:"comment_id"`
+	}
+	if !app.readModerationInput(w, r, &input) {
+		return
+	}
+
+	until := time.Now().AddDate(0, 0, input.Days)
+	err = app.repo.Comments.SuspendUser(r.Context(), userID, contextUserID(r), input.CommentID, until,
+		strings.TrimSpace(input.Reason))
+	if err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	app.writeModeratedUser(w, r, userID)
+}
+
+// readModerationInput decodes and validates a moderation request body,
+// answering the request itself when that fails
+func (app *application) readModerationInput(w http.ResponseWriter, r *http.Request, input any) bool {
+	if err := app.ReadJSON(w, r, input); err != nil {
+		app.WriteJSONError(w, err)
+		return false
+	}
+
+	fieldErrors, err := validateStruct(input)
+	if err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+		return false
+	}
+	if len(fieldErrors) > 0 {
+		app.failedValidation(w, fieldErrors)
+		return false
+	}
+	return true
+}
+
+// writeModeratedUser answers with the user's standing after a sanction
+func (app *application) writeModeratedUser(w http.ResponseWriter, r *http.Request, userID int) {
+	user, err := app.repo.Users.GetUserByID(r.Context(), int64(userID))
+	if err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	res := struct {
+		UserID         int        `json:"user_id"`
+		WarningCount   int        `json:"warning_count"`
+		SuspendedUntil *time.Time `json:"suspended_until,omitempty"`
+	}{userID, user.WarningCount, user.SuspendedUntil}
+	if err := app.WriteJSON(w, http.StatusOK, res); err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+	}
+}
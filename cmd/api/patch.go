@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+
+	"github.com/iamYole/go-movies/internal/jsonpatch"
+	"github.com/iamYole/go-movies/internal/models"
+	"github.com/iamYole/go-movies/internal/repository"
+)
+
+// PatchMovieHandler applies a JSON Merge Patch or JSON Patch document to a
+// stored movie and writes back only the fields that changed
+func (app *application) PatchMovieHandler(w http.ResponseWriter, r *http.Request) {
+	movieID, err := readIDParam(r, "id")
+	if err != nil {
+		app.WriteJSONError(w, err)
+		return
+	}
+
+	version, ok := app.requireIfMatch(w, r, movieID)
+	if !ok {
+		return
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	var apply func(doc, patch []byte) ([]byte, error)
+	switch mediaType {
+	case jsonpatch.MergePatchType:
+		apply = jsonpatch.MergePatch
+	case jsonpatch.JSONPatchType:
+		apply = jsonpatch.Apply
+	default:
+		w.Header().Set("Accept-Patch", jsonpatch.MergePatchType+", "+jsonpatch.JSONPatchType)
+		app.WriteJSONError(w, errors.New("unsupported patch media type"), http.StatusUnsupportedMediaType)
+		return
+	}
+
+	current, _, err := app.repo.Movies.EditMovie(r.Context(), int64(movieID))
+	if err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+	if version != 0 && version != current.Version {
+		app.preconditionFailed(w, r, movieID)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, 1024*1024)
+	patch, err := io.ReadAll(r.Body)
+	if err != nil {
+		app.WriteJSONError(w, err)
+		return
+	}
+
+	//genres are expanded for display only, genres_array is the editable field
+	current.Genres = nil
+	doc, err := json.Marshal(current)
+	if err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	patched, err := apply(doc, patch)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, jsonpatch.ErrTestFailed) {
+			status = http.StatusConflict
+		}
+		app.WriteJSONError(w, err, status)
+		return
+	}
+
+	var movie models.Movie
+	decode := json.NewDecoder(bytes.NewReader(patched))
+	decode.DisallowUnknownFields()
+	if err := decode.Decode(&movie); err != nil {
+		app.WriteJSONError(w, err)
+		return
+	}
+	movie.ID = movieID
+	movie.Version = current.Version
+	movie.LockChanged(*current)
+
+	fieldErrors, err := app.validateMovie(r.Context(), movie)
+	if err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+	if len(fieldErrors) > 0 {
+		app.failedValidation(w, fieldErrors)
+		return
+	}
+
+	var fields []string
+	for _, change := range models.DiffMovies(*current, movie) {
+		fields = append(fields, change.Field)
+	}
+
+	if len(fields) > 0 {
+		_, version, err := app.repo.Movies.PatchMovie(r.Context(), movie, fields)
+		if err != nil {
+			switch {
+			case errors.Is(err, repository.ErrEditConflict):
+				app.preconditionFailed(w, r, movieID)
+			default:
+				app.WriteJSONError(w, err, http.StatusInternalServerError)
+			}
+			return
+		}
+		movie.Version = version
+
+		if movie.Title != current.Title {
+			app.enqueueEnrichment(r.Context(), movieID, true)
+		}
+		app.enqueueSimilar(r.Context(), movieID)
+	}
+
+	w.Header().Set("ETag", movieETag(&movie))
+	if err := app.WriteJSON(w, http.StatusOK, movie); err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,317 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/iamYole/go-movies/internal/models"
+)
+
+// castSize is how many of the top billed cast a movie embeds
+const castSize = 10
+
+// ListPeopleHandler searches people by name with ?q= and pages with
+// ?limit=&offset=
+func (app *application) ListPeopleHandler(w http.ResponseWriter, r *http.Request) {
+	limit, offset, err := readPage(r, 200)
+	if err != nil {
+		app.WriteJSONError(w, err)
+		return
+	}
+
+	people, err := app.repo.People.GetPeople(r.Context(), models.PersonFilter{
+		Name:   strings.TrimSpace(r.URL.Query().Get("q")),
+		Limit:  limit,
+		Offset: offset,
+	})
+	if err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	if err := app.WriteJSON(w, http.StatusOK, people); err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+	}
+}
+
+// GetPersonHandler returns a person with their filmography
+func (app *application) GetPersonHandler(w http.ResponseWriter, r *http.Request) {
+	personID, err := readIDParam(r, "id")
+	if err != nil {
+		app.WriteJSONError(w, err)
+		return
+	}
+
+	person, err := app.repo.People.GetPerson(r.Context(), personID)
+	if err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	if err := app.WriteJSON(w, http.StatusOK, person); err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+	}
+}
+
+// MovieCreditsHandler lists a movie's cast and crew in billing order,
+// optionally only one ?role=
+func (app *application) MovieCreditsHandler(w http.ResponseWriter, r *http.Request) {
+	movieID, err := readIDParam(r, "id")
+	if err != nil {
+		app.WriteJSONError(w, err)
+		return
+	}
+
+	role := r.URL.Query().Get("role")
+	if role != "" && !models.IsCreditRole(role) {
+		app.WriteJSONError(w, fmt.Errorf("role must be one of %s", strings.Join(models.CreditRoles, ", ")))
+		return
+	}
+
+	credits, err := app.repo.People.GetMovieCredits(r.Context(), movieID, role, 0)
+	if err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	if err := app.WriteJSON(w, http.StatusOK, credits); err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+	}
+}
+
+// validatePerson checks the person struct rules and that the dates are in order
+func validatePerson(person models.Person) ([]FieldError, error) {
+	fieldErrors, err := validateStruct(person)
+	if err != nil {
+		return nil, err
+	}
+	if person.BirthDate != nil && person.DeathDate != nil && person.DeathDate.Before(*person.BirthDate) {
+		fieldErrors = append(fieldErrors, FieldError{
+			Field:   "death_date",
+			Rule:    "after_birth",
+			Message: "must not be before birth_date",
+		})
+	}
+	return fieldErrors, nil
+}
+
+func (app *application) InsertPersonHandler(w http.ResponseWriter, r *http.Request) {
+	var person models.Person
+	if err := app.ReadJSON(w, r, &person); err != nil {
+		app.WriteJSONError(w, err)
+		return
+	}
+	person.Filmography = nil
+
+	fieldErrors, err := validatePerson(person)
+	if err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+	if len(fieldErrors) > 0 {
+		app.failedValidation(w, fieldErrors)
+		return
+	}
+
+	person.ID, err = app.repo.People.InsertPerson(r.Context(), person)
+	if err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Location", fmt.Sprintf("/people/%d", person.ID))
+	if err := app.WriteJSON(w, http.StatusCreated, person); err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+	}
+}
+
+func (app *application) UpdatePersonHandler(w http.ResponseWriter, r *http.Request) {
+	personID, err := readIDParam(r, "id")
+	if err != nil {
+		app.WriteJSONError(w, err)
+		return
+	}
+
+	var person models.Person
+	if err := app.ReadJSON(w, r, &person); err != nil {
+		app.WriteJSONError(w, err)
+		return
+	}
+	person.ID = personID
+	person.Filmography = nil
+
+	fieldErrors, err := validatePerson(person)
+	if err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+	if len(fieldErrors) > 0 {
+		app.failedValidation(w, fieldErrors)
+		return
+	}
+
+	if err := app.repo.People.UpdatePerson(r.Context(), person); err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	if err := app.WriteJSON(w, http.StatusOK, person); err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+	}
+}
+
+// DeletePersonHandler removes a person and all their credits
+func (app *application) DeletePersonHandler(w http.ResponseWriter, r *http.Request) {
+	personID, err := readIDParam(r, "id")
+	if err != nil {
+		app.WriteJSONError(w, err)
+		return
+	}
+
+	if err := app.repo.People.DeletePerson(r.Context(), personID); err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	res := JSONResponse{
+		Error:   false,
+		Message: "Person Deleted",
+	}
+	if err := app.WriteJSON(w, http.StatusOK, res); err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+	}
+}
+
+// readCredit decodes and validates a credit of the movie in the URL,
+// answering the request itself when that fails
+func (app *application) readCredit(w http.ResponseWriter, r *http.Request) (models.Credit, bool) {
+	var credit models.Credit
+
+	movieID, err := readIDParam(r, "id")
+	if err != nil {
+		app.WriteJSONError(w, err)
+		return credit, false
+	}
+
+	if err := app.ReadJSON(w, r, &credit); err != nil {
+		app.WriteJSONError(w, err)
+		return credit, false
+	}
+	credit.MovieID = movieID
+	credit.Character = strings.TrimSpace(credit.Character)
+	credit.PersonName, credit.MovieTitle, credit.ReleaseDate = "", "", nil
+
+	fieldErrors, err := validateStruct(credit)
+	if err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+		return credit, false
+	}
+	//only actors play characters
+	if credit.Character != "" && credit.Role != "actor" {
+		fieldErrors = append(fieldErrors, FieldError{
+			Field:   "character",
+			Rule:    "actor_only",
+			Message: "may only be set for actors",
+		})
+	}
+	if len(fieldErrors) > 0 {
+		app.failedValidation(w, fieldErrors)
+		return credit, false
+	}
+	return credit, true
+}
+
+func (app *application) InsertCreditHandler(w http.ResponseWriter, r *http.Request) {
+	credit, ok := app.readCredit(w, r)
+	if !ok {
+		return
+	}
+
+	id, err := app.repo.People.InsertCredit(r.Context(), credit)
+	if err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+	credit.ID = id
+	app.enqueueSimilar(r.Context(), credit.MovieID)
+
+	if err := app.WriteJSON(w, http.StatusCreated, credit); err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+	}
+}
+
+func (app *application) UpdateCreditHandler(w http.ResponseWriter, r *http.Request) {
+	creditID, err := readIDParam(r, "creditID")
+	if err != nil {
+		app.WriteJSONError(w, err)
+		return
+	}
+
+	credit, ok := app.readCredit(w, r)
+	if !ok {
+		return
+	}
+	credit.ID = creditID
+
+	if err := app.repo.People.UpdateCredit(r.Context(), credit); err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+	app.enqueueSimilar(r.Context(), credit.MovieID)
+
+	if err := app.WriteJSON(w, http.StatusOK, credit); err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+	}
+}
+
+func (app *application) DeleteCreditHandler(w http.ResponseWriter, r *http.Request) {
+	movieID, err := readIDParam(r, "id")
+	if err != nil {
+		app.WriteJSONError(w, err)
+		return
+	}
+	creditID, err := readIDParam(r, "creditID")
+	if err != nil {
+		app.WriteJSONError(w, err)
+		return
+	}
+
+	if err := app.repo.People.DeleteCredit(r.Context(), movieID, creditID); err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+	app.enqueueSimilar(r.Context(), movieID)
+
+	res := JSONResponse{
+		Error:   false,
+		Message: "Credit Deleted",
+	}
+	if err := app.WriteJSON(w, http.StatusOK, res); err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+	}
+}
+
+// embedCast adds the top billed cast to movie when the request asks for it
+// with ?include=cast
+func (app *application) embedCast(r *http.Request, movie *models.Movie) error {
+	if !includes(r, "cast") {
+		return nil
+	}
+	cast, err := app.repo.People.GetMovieCredits(r.Context(), movie.ID, "actor", castSize)
+	if err != nil {
+		return err
+	}
+	movie.Cast = cast
+	return nil
+}
+
+// includes reports whether the comma separated ?include= list names part
+func includes(r *http.Request, part string) bool {
+	for _, p := range strings.Split(r.URL.Query().Get("include"), ",") {
+		if strings.TrimSpace(p) == part {
+			return true
+		}
+	}
+	return false
+}
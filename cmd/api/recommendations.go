@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/iamYole/go-movies/internal/models"
+)
+
+// maxRecommendations is the most recommendations a request can ask for
+const maxRecommendations = 50
+
+// thumbValues maps the thumbs the API accepts to their stored values
+var thumbValues = map[string]int{"up": models.ThumbUp, "down": models.ThumbDown}
+
+type thumbResponse struct {
+	MovieID   int       `json:"movie_id"`
+	Thumb     string    `json:"thumb"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (app *application) writeThumb(w http.ResponseWriter, t *models.Thumb) {
+	res := thumbResponse{MovieID: t.MovieID, Thumb: "up", UpdatedAt: t.UpdatedAt}
+	if t.Value == models.ThumbDown {
+		res.Thumb = "down"
+	}
+	if err := app.WriteJSON(w, http.StatusOK, res); err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+	}
+}
+
+// GetThumbHandler returns the caller's thumb on a movie
+func (app *application) GetThumbHandler(w http.ResponseWriter, r *http.Request) {
+	movieID, err := readIDParam(r, "id")
+	if err != nil {
+		app.WriteJSONError(w, err)
+		return
+	}
+
+	thumb, err := app.repo.Recommendations.GetThumb(r.Context(), contextUserID(r), movieID)
+	if err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+	app.writeThumb(w, thumb)
+}
+
+// ThumbMovieHandler gives a movie the caller's thumbs up or down, replacing
+// any earlier one
+func (app *application) ThumbMovieHandler(w http.ResponseWriter, r *http.Request) {
+	movieID, err := readIDParam(r, "id")
+	if err != nil {
+		app.WriteJSONError(w, err)
+		return
+	}
+
+	var input struct {
+		Thumb string `json:"thumb" validate:"required,oneof=up down"`
+	}
+	if err := app.ReadJSON(w, r, &input); err != nil {
+		app.WriteJSONError(w, err)
+		return
+	}
+
+	fieldErrors, err := validateStruct(input)
+	if err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+	if len(fieldErrors) > 0 {
+		app.failedValidation(w, fieldErrors)
+		return
+	}
+
+	userID := contextUserID(r)
+	if err := app.repo.Recommendations.SetThumb(r.Context(), userID, movieID, thumbValues[input.Thumb]); err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	thumb, err := app.repo.Recommendations.GetThumb(r.Context(), userID, movieID)
+	if err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+	app.writeThumb(w, thumb)
+}
+
+// DeleteThumbHandler withdraws the caller's thumb on a movie
+func (app *application) DeleteThumbHandler(w http.ResponseWriter, r *http.Request) {
+	movieID, err := readIDParam(r, "id")
+	if err != nil {
+		app.WriteJSONError(w, err)
+		return
+	}
+
+	if err := app.repo.Recommendations.DeleteThumb(r.Context(), contextUserID(r), movieID); err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	res := JSONResponse{
+		Error:   false,
+		Message: "Thumb Deleted",
+	}
+	if err := app.WriteJSON(w, http.StatusOK, res); err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+	}
+}
+
+// RecommendationsHandler returns movies picked for the caller, best first,
+// at most ?limit= (20 by default). Thumbs count once the neighbors are
+// next rebuilt; until then, and for new users, picks lean on genres and
+// popularity.
+func (app *application) RecommendationsHandler(w http.ResponseWriter, r *http.Request) {
+	limit := 20
+	if v := r.URL.Query().Get("limit"); v != "" {
+		var err error
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxRecommendations {
+			app.WriteJSONError(w, fmt.Errorf("invalid limit parameter"))
+			return
+		}
+	}
+
+	recs, err := app.recommend.ForUser(r.Context(), contextUserID(r), limit)
+	if err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	if err := app.WriteJSON(w, http.StatusOK, recs); err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,323 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/iamYole/go-movies/internal/models"
+)
+
+// ListReviewsHandler lists a movie's reviews with ?sort=newest|helpful,
+// paged with ?limit=&offset=
+func (app *application) ListReviewsHandler(w http.ResponseWriter, r *http.Request) {
+	movieID, err := readIDParam(r, "id")
+	if err != nil {
+		app.WriteJSONError(w, err)
+		return
+	}
+
+	limit, offset, err := readPage(r, 100)
+	if err != nil {
+		app.WriteJSONError(w, err)
+		return
+	}
+
+	sort := r.URL.Query().Get("sort")
+	if sort != "" && !contains(models.ReviewSorts, sort) {
+		app.WriteJSONError(w, fmt.Errorf("sort must be one of %s", strings.Join(models.ReviewSorts, ", ")))
+		return
+	}
+
+	reviews, err := app.repo.Reviews.GetReviews(r.Context(), models.ReviewFilter{
+		MovieID: movieID,
+		Sort:    sort,
+		Limit:   limit,
+		Offset:  offset,
+	})
+	if err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	if err := app.WriteJSON(w, http.StatusOK, reviews); err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+	}
+}
+
+func (app *application) GetReviewHandler(w http.ResponseWriter, r *http.Request) {
+	movieID, reviewID, err := readReviewParams(r)
+	if err != nil {
+		app.WriteJSONError(w, err)
+		return
+	}
+
+	review, err := app.repo.Reviews.GetReview(r.Context(), movieID, reviewID)
+	if err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	if err := app.WriteJSON(w, http.StatusOK, review); err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+	}
+}
+
+// readReviewParams reads the {id} and {reviewID} route params
+func readReviewParams(r *http.Request) (int, int, error) {
+	movieID, err := readIDParam(r, "id")
+	if err != nil {
+		return 0, 0, err
+	}
+	reviewID, err := readIDParam(r, "reviewID")
+	if err != nil {
+		return 0, 0, err
+	}
+	return movieID, reviewID, nil
+}
+
+// readReview decodes and validates a review body, answering the request
+// itself when that fails
+func (app *application) readReview(w http.ResponseWriter, r *http.Request) (models.Review, bool) {
+	if !app.requireActiveUser(w, r) {
+		return models.Review{}, false
+	}
+
+	var input struct {
+		Rating  int    `json:"rating"`
+		Title   string `json:"title"`
+		Body    string `json:"body"`
+		Spoiler bool   `json:"spoiler"`
+	}
+	if err := app.ReadJSON(w, r, &input); err != nil {
+		app.WriteJSONError(w, err)
+		return models.Review{}, false
+	}
+
+	review := models.Review{
+		UserID:  contextUserID(r),
+		Rating:  input.Rating,
+		Title:   strings.TrimSpace(input.Title),
+		Body:    strings.TrimSpace(input.Body),
+		Spoiler: input.Spoiler,
+	}
+
+	fieldErrors, err := validateStruct(review)
+	if err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+		return review, false
+	}
+	if len(fieldErrors) > 0 {
+		app.failedValidation(w, fieldErrors)
+		return review, false
+	}
+	return review, true
+}
+
+// InsertReviewHandler posts the caller's review of a movie, which also
+// rates it. A user may review a movie once.
+func (app *application) InsertReviewHandler(w http.ResponseWriter, r *http.Request) {
+	movieID, err := readIDParam(r, "id")
+	if err != nil {
+		app.WriteJSONError(w, err)
+		return
+	}
+
+	review, ok := app.readReview(w, r)
+	if !ok {
+		return
+	}
+	review.MovieID = movieID
+
+	reviewID, err := app.repo.Reviews.InsertReview(r.Context(), review)
+	if err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	saved, err := app.repo.Reviews.GetReview(r.Context(), movieID, reviewID)
+	if err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Location", fmt.Sprintf("/movies/%d/reviews/%d", movieID, reviewID))
+	if err := app.WriteJSON(w, http.StatusCreated, saved); err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+	}
+}
+
+// UpdateReviewHandler edits the caller's own review
+func (app *application) UpdateReviewHandler(w http.ResponseWriter, r *http.Request) {
+	movieID, reviewID, err := readReviewParams(r)
+	if err != nil {
+		app.WriteJSONError(w, err)
+		return
+	}
+
+	review, ok := app.readReview(w, r)
+	if !ok {
+		return
+	}
+	review.ID = reviewID
+	review.MovieID = movieID
+
+	if err := app.repo.Reviews.UpdateReview(r.Context(), review); err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	saved, err := app.repo.Reviews.GetReview(r.Context(), movieID, reviewID)
+	if err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	if err := app.WriteJSON(w, http.StatusOK, saved); err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+	}
+}
+
+// DeleteReviewHandler removes the caller's own review, keeping their rating
+func (app *application) DeleteReviewHandler(w http.ResponseWriter, r *http.Request) {
+	movieID, reviewID, err := readReviewParams(r)
+	if err != nil {
+		app.WriteJSONError(w, err)
+		return
+	}
+
+	if err := app.repo.Reviews.DeleteReview(r.Context(), movieID, reviewID, contextUserID(r)); err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	res := JSONResponse{
+		Error:   false,
+		Message: "Review Deleted",
+	}
+	if err := app.WriteJSON(w, http.StatusOK, res); err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+	}
+}
+
+// VoteHelpfulHandler marks a review as helpful to the caller
+func (app *application) VoteHelpfulHandler(w http.ResponseWriter, r *http.Request) {
+	app.helpfulVote(w, r, true)
+}
+
+// UnvoteHelpfulHandler withdraws the caller's helpful vote
+func (app *application) UnvoteHelpfulHandler(w http.ResponseWriter, r *http.Request) {
+	app.helpfulVote(w, r, false)
+}
+
+func (app *application) helpfulVote(w http.ResponseWriter, r *http.Request, vote bool) {
+	movieID, reviewID, err := readReviewParams(r)
+	if err != nil {
+		app.WriteJSONError(w, err)
+		return
+	}
+
+	update := app.repo.Reviews.UnvoteHelpful
+	if vote {
+		update = app.repo.Reviews.VoteHelpful
+	}
+	count, err := update(r.Context(), movieID, reviewID, contextUserID(r))
+	if err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	res := struct {
+		ReviewID     int  `json:"review_id"`
+		Helpful      bool `json:"helpful"`
+		HelpfulCount int  `json:"helpful_count"`
+	}{reviewID, vote, count}
+	if err := app.WriteJSON(w, http.StatusOK, res); err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+	}
+}
+
+// GetRatingHandler returns the caller's rating of a movie
+func (app *application) GetRatingHandler(w http.ResponseWriter, r *http.Request) {
+	movieID, err := readIDParam(r, "id")
+	if err != nil {
+		app.WriteJSONError(w, err)
+		return
+	}
+
+	rating, err := app.repo.Reviews.GetRating(r.Context(), movieID, contextUserID(r))
+	if err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	if err := app.WriteJSON(w, http.StatusOK, rating); err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+	}
+}
+
+// RateMovieHandler sets the caller's rating of a movie, with or without a
+// review
+func (app *application) RateMovieHandler(w http.ResponseWriter, r *http.Request) {
+	movieID, err := readIDParam(r, "id")
+	if err != nil {
+		app.WriteJSONError(w, err)
+		return
+	}
+
+	var input struct {
+		Rating int `json:"rating"`
+	}
+	if err := app.ReadJSON(w, r, &input); err != nil {
+		app.WriteJSONError(w, err)
+		return
+	}
+
+	rating := models.Rating{MovieID: movieID, UserID: contextUserID(r), Rating: input.Rating}
+	fieldErrors, err := validateStruct(rating)
+	if err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+	if len(fieldErrors) > 0 {
+		app.failedValidation(w, fieldErrors)
+		return
+	}
+
+	if err := app.repo.Reviews.SetRating(r.Context(), movieID, rating.UserID, rating.Rating); err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	saved, err := app.repo.Reviews.GetRating(r.Context(), movieID, rating.UserID)
+	if err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	if err := app.WriteJSON(w, http.StatusOK, saved); err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+	}
+}
+
+// DeleteRatingHandler withdraws the caller's rating of a movie
+func (app *application) DeleteRatingHandler(w http.ResponseWriter, r *http.Request) {
+	movieID, err := readIDParam(r, "id")
+	if err != nil {
+		app.WriteJSONError(w, err)
+		return
+	}
+
+	if err := app.repo.Reviews.DeleteRating(r.Context(), movieID, contextUserID(r)); err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	res := JSONResponse{
+		Error:   false,
+		Message: "Rating Deleted",
+	}
+	if err := app.WriteJSON(w, http.StatusOK, res); err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+	}
+}
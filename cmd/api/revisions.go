@@ -0,0 +1,143 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/iamYole/go-movies/internal/models"
+	"github.com/iamYole/go-movies/internal/repository"
+)
+
+func (app *application) MovieRevisionsHandler(w http.ResponseWriter, r *http.Request) {
+	movieID, err := readIDParam(r, "id")
+	if err != nil {
+		app.WriteJSONError(w, err)
+		return
+	}
+
+	revisions, err := app.repo.Movies.GetMovieRevisions(r.Context(), int64(movieID))
+	if err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	if err := app.WriteJSON(w, http.StatusOK, revisions); err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+	}
+}
+
+// DiffMovieRevisionsHandler compares two revisions given as ?from=&to=
+func (app *application) DiffMovieRevisionsHandler(w http.ResponseWriter, r *http.Request) {
+	movieID, err := readIDParam(r, "id")
+	if err != nil {
+		app.WriteJSONError(w, err)
+		return
+	}
+
+	from, err := strconv.Atoi(r.URL.Query().Get("from"))
+	if err != nil {
+		app.WriteJSONError(w, errors.New("invalid from revision"))
+		return
+	}
+	to, err := strconv.Atoi(r.URL.Query().Get("to"))
+	if err != nil {
+		app.WriteJSONError(w, errors.New("invalid to revision"))
+		return
+	}
+
+	fromRev, ok := app.getRevision(w, r, movieID, from)
+	if !ok {
+		return
+	}
+	toRev, ok := app.getRevision(w, r, movieID, to)
+	if !ok {
+		return
+	}
+
+	var payload = struct {
+		From    int                  `json:"from"`
+		To      int                  `json:"to"`
+		Changes []models.FieldChange `json:"changes"`
+	}{
+		From:    from,
+		To:      to,
+		Changes: models.DiffMovies(fromRev.Snapshot, toRev.Snapshot),
+	}
+
+	if err := app.WriteJSON(w, http.StatusOK, payload); err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+	}
+}
+
+// RestoreMovieRevisionHandler writes an old revision back as a new revision
+func (app *application) RestoreMovieRevisionHandler(w http.ResponseWriter, r *http.Request) {
+	movieID, err := readIDParam(r, "id")
+	if err != nil {
+		app.WriteJSONError(w, err)
+		return
+	}
+	rev, err := readIDParam(r, "rev")
+	if err != nil {
+		app.WriteJSONError(w, err)
+		return
+	}
+
+	version, ok := app.requireIfMatch(w, r, movieID)
+	if !ok {
+		return
+	}
+
+	old, ok := app.getRevision(w, r, movieID, rev)
+	if !ok {
+		return
+	}
+
+	current, _, err := app.repo.Movies.EditMovie(r.Context(), int64(movieID))
+	if err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	movie := old.Snapshot
+	movie.ID = movieID
+	movie.Version = version
+	keepSyncedFields(&movie, current)
+	movie.LockChanged(*current)
+
+	revision, version, err := app.repo.Movies.UpdateMovie(r.Context(), movie)
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrEditConflict):
+			app.preconditionFailed(w, r, movieID)
+		default:
+			app.WriteJSONError(w, err, http.StatusInternalServerError)
+		}
+		return
+	}
+	movie.Version = version
+
+	if movie.Title != current.Title {
+		app.enqueueEnrichment(r.Context(), movieID, true)
+	}
+	app.enqueueSimilar(r.Context(), movieID)
+
+	res := JSONResponse{
+		Error:   false,
+		Message: "Movie Restored",
+		Data:    map[string]int{"revision": revision, "restored_from": rev, "version": version},
+	}
+	w.Header().Set("ETag", movieETag(&movie))
+	if err := app.WriteJSON(w, http.StatusOK, res); err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+	}
+}
+
+func (app *application) getRevision(w http.ResponseWriter, r *http.Request, movieID, rev int) (*models.MovieRevision, bool) {
+	revision, err := app.repo.Movies.GetMovieRevision(r.Context(), int64(movieID), rev)
+	if err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+		return nil, false
+	}
+	return revision, true
+}
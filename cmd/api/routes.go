@@ -17,17 +17,30 @@ func (app *application) routes() http.Handler {
 	mux.Use(cors.Handler(cors.Options{
 		AllowedOrigins: []string{env.GetString("FRONTEND_URL", "http://localhost:3000")}, // Use this to allow specific origin hosts
 		// AllowOriginFunc:  func(r *http.Request, origin string) bool { return true },
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
-		ExposedHeaders:   []string{"Link"},
+		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", "If-Match", "If-None-Match"},
+		ExposedHeaders:   []string{"Link", "ETag", "Content-Disposition"},
 		AllowCredentials: false,
 		MaxAge:           300, // Maximum value not ignored by any of major browsers
 	}))
 
 	mux.Get("/", app.Home)
-	mux.Get("/movies", app.AllMovies)
+	mux.With(app.authOptional).Get("/movies", app.AllMovies)
 	mux.Get("/genres",app.GetAllGenresHandle)
-	mux.Get("/movies/{id}",app.GetMovieHandler)
+	mux.With(app.authOptional).Get("/movies/{id}", app.GetMovieHandler)
+	mux.Get("/movies/by-external/{source}/{id}", app.GetMovieByExternalIDHandler)
+	mux.Get("/movies/{id}/credits", app.MovieCreditsHandler)
+	mux.Get("/movies/{id}/similar", app.SimilarMoviesHandler)
+	mux.Get("/movies/trending", app.TrendingHandler)
+	mux.Get("/movies/{id}/reviews", app.ListReviewsHandler)
+	mux.Get("/movies/{id}/reviews/{reviewID}", app.GetReviewHandler)
+	mux.Get("/movies/{id}/comments", app.ListCommentsHandler)
+	mux.Get("/lists/{slug}", app.PublicListHandler)
+	mux.Get("/people", app.ListPeopleHandler)
+	mux.Get("/people/{id}", app.GetPersonHandler)
+	mux.Get("/autocomplete", app.AutocompleteHandler)
+	mux.Get("/searches/trending", app.TrendingSearchesHandler)
+	mux.Get("/images/{id}/{variant}", app.ImageHandler)
 	mux.Get("/authenticate", app.authenticate)
 	
 	mux.Post("/authenticate", app.authenticate)
@@ -35,13 +48,88 @@ func (app *application) routes() http.Handler {
 	mux.Get("/logout",app.logout)
 	
 	mux.Post("/register", app.Register)
+
+	//signed in users
+	mux.Group(func(r chi.Router) {
+		r.Use(app.authRequired)
+
+		r.Get("/movies/{id}/rating", app.GetRatingHandler)
+		r.Put("/movies/{id}/rating", app.RateMovieHandler)
+		r.Delete("/movies/{id}/rating", app.DeleteRatingHandler)
+
+		r.Post("/movies/{id}/reviews", app.InsertReviewHandler)
+		r.Put("/movies/{id}/reviews/{reviewID}", app.UpdateReviewHandler)
+		r.Delete("/movies/{id}/reviews/{reviewID}", app.DeleteReviewHandler)
+		r.Put("/movies/{id}/reviews/{reviewID}/helpful", app.VoteHelpfulHandler)
+		r.Delete("/movies/{id}/reviews/{reviewID}/helpful", app.UnvoteHelpfulHandler)
+
+		r.Get("/movies/{id}/thumb", app.GetThumbHandler)
+		r.Put("/movies/{id}/thumb", app.ThumbMovieHandler)
+		r.Delete("/movies/{id}/thumb", app.DeleteThumbHandler)
+
+		r.Post("/movies/{id}/comments", app.InsertCommentHandler)
+		r.Post("/movies/{id}/comments/{commentID}/reports", app.ReportCommentHandler)
+
+		r.Get("/me/history", app.HistoryHandler)
+		r.Post("/me/history", app.AddWatchHandler)
+		r.Get("/me/history/stats", app.HistoryStatsHandler)
+		r.Delete("/me/history/{id}", app.DeleteWatchHandler)
+
+		r.Get("/me/recommendations", app.RecommendationsHandler)
+
+		//{listID} is a list id or "watchlist"
+		r.Route("/me/lists", func(r chi.Router) {
+			r.Get("/", app.MyListsHandler)
+			r.Post("/", app.InsertListHandler)
+			r.Get("/{listID}", app.GetMyListHandler)
+			r.Put("/{listID}", app.UpdateListHandler)
+			r.Delete("/{listID}", app.DeleteListHandler)
+			r.Post("/{listID}/items", app.AddListItemHandler)
+			r.Put("/{listID}/items/order", app.ReorderListHandler)
+			r.Put("/{listID}/items/{movieID}", app.UpdateListItemHandler)
+			r.Delete("/{listID}/items/{movieID}", app.RemoveListItemHandler)
+		})
+	})
 	
 	mux.Route("/admin",func(r chi.Router) {
-		//r.Use(app.authRequired)
-		
+		//everything under /admin is for signed in admins
+		r.Use(app.authRequired)
+		r.Use(app.adminRequired)
+
 		r.Get("/movies", app.MovieCatalog)
 		r.Get("/movies/{id}",app.EditMovieHandler)
 		r.Put("/movies/0", app.InsertMovieHandler)
+		r.Post("/movies/import", app.ImportMoviesHandler)
+		r.Get("/movies/export", app.ExportMoviesHandler)
+		r.Put("/movies/{id}", app.UpdateMovieHandler)
+		r.Patch("/movies/{id}", app.PatchMovieHandler)
+		r.Delete("/movies/{id}", app.DeleteMovieHandler)
+		r.Put("/movies/by-external/{source}/{id}", app.UpsertMovieByExternalIDHandler)
+		r.Post("/movies/{id}/poster", app.UploadPosterHandler)
+		r.Post("/movies/{id}/backdrop", app.UploadBackdropHandler)
+		r.Post("/movies/{id}/credits", app.InsertCreditHandler)
+		r.Put("/movies/{id}/credits/{creditID}", app.UpdateCreditHandler)
+		r.Delete("/movies/{id}/credits/{creditID}", app.DeleteCreditHandler)
+
+		r.Post("/people", app.InsertPersonHandler)
+		r.Put("/people/{id}", app.UpdatePersonHandler)
+		r.Delete("/people/{id}", app.DeletePersonHandler)
+
+		r.Get("/movies/{id}/revisions", app.MovieRevisionsHandler)
+		r.Get("/movies/{id}/revisions/diff", app.DiffMovieRevisionsHandler)
+		r.Post("/movies/{id}/revisions/{rev}/restore", app.RestoreMovieRevisionHandler)
+
+		r.Get("/jobs", app.ListJobsHandler)
+		r.Get("/jobs/{id}", app.GetJobHandler)
+		r.Post("/jobs/{id}/retry", app.RetryJobHandler)
+
+		r.Route("/moderation", func(r chi.Router) {
+			r.Get("/queue", app.ModerationQueueHandler)
+			r.Get("/actions", app.ModerationActionsHandler)
+			r.Post("/comments/{id}/{action}", app.ModerateCommentHandler)
+			r.Post("/users/{id}/warn", app.WarnUserHandler)
+			r.Post("/users/{id}/suspend", app.SuspendUserHandler)
+		})
 	})
 
 	return mux
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+// maxSimilar is the most similar movies a request can ask for, which is
+// also how many are precomputed per movie
+const maxSimilar = 20
+
+// SimilarMoviesHandler returns the movies most like a movie, best first,
+// at most ?limit= (10 by default). Matches are precomputed in the
+// background, so a movie just added may have none for a moment.
+func (app *application) SimilarMoviesHandler(w http.ResponseWriter, r *http.Request) {
+	movieID, err := readIDParam(r, "id")
+	if err != nil {
+		app.WriteJSONError(w, err)
+		return
+	}
+
+	limit := 10
+	if v := r.URL.Query().Get("limit"); v != "" {
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxSimilar {
+			app.WriteJSONError(w, fmt.Errorf("invalid limit parameter"))
+			return
+		}
+	}
+
+	movies, err := app.repo.Similar.GetSimilarMovies(r.Context(), movieID, limit)
+	if err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	if err := app.WriteJSON(w, http.StatusOK, movies); err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+	}
+}
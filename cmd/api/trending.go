@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/iamYole/go-movies/internal/models"
+)
+
+// maxTrending is the most trending movies or searches a request can ask for
+const maxTrending = 100
+
+// maxSearchQuery is how much of a search query is recorded
+const maxSearchQuery = 200
+
+// TrendingHandler returns the movies drawing the most attention lately,
+// over ?window=day (the default) or week, at most ?limit= (20 by default).
+// Scores are recomputed every few minutes in the background.
+func (app *application) TrendingHandler(w http.ResponseWriter, r *http.Request) {
+	window, limit, err := readTrending(r, 20)
+	if err != nil {
+		app.WriteJSONError(w, err)
+		return
+	}
+
+	movies, err := app.repo.Events.GetTrending(r.Context(), window, limit)
+	if err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	if err := app.WriteJSON(w, http.StatusOK, movies); err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+	}
+}
+
+// TrendingSearchesHandler returns the searches made most lately, like
+// TrendingHandler, with ?limit= 10 by default. Only queries several people
+// searched for are listed.
+func (app *application) TrendingSearchesHandler(w http.ResponseWriter, r *http.Request) {
+	window, limit, err := readTrending(r, 10)
+	if err != nil {
+		app.WriteJSONError(w, err)
+		return
+	}
+
+	searches, err := app.repo.Events.GetTrendingSearches(r.Context(), window, limit)
+	if err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	if err := app.WriteJSON(w, http.StatusOK, searches); err != nil {
+		app.WriteJSONError(w, err, http.StatusInternalServerError)
+	}
+}
+
+// readTrending reads the ?window=&limit= of a trending listing
+func readTrending(r *http.Request, defaultLimit int) (string, int, error) {
+	window := models.TrendingDay
+	if v := r.URL.Query().Get("window"); v != "" {
+		if !contains(models.TrendingWindows, v) {
+			return "", 0, fmt.Errorf("invalid window parameter, must be one of %s",
+				strings.Join(models.TrendingWindows, ", "))
+		}
+		window = v
+	}
+
+	limit := defaultLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		var err error
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxTrending {
+			return "", 0, fmt.Errorf("invalid limit parameter")
+		}
+	}
+	return window, limit, nil
+}
+
+// recordListing records a search when the listing was one, and an
+// impression of every movie listed
+func (app *application) recordListing(r *http.Request, filter models.MovieFilter, movies []*models.Movie) {
+	userID := contextUserID(r)
+	if filter.Title != "" {
+		query := strings.ToLower(filter.Title)
+		if len(query) > maxSearchQuery {
+			query = strings.ToValidUTF8(query[:maxSearchQuery], "")
+		}
+		app.events.Record(models.Event{Kind: models.EventSearch, UserID: userID, Query: query})
+	}
+	for _, m := range movies {
+		app.events.Record(models.Event{Kind: models.EventImpression, MovieID: m.ID, UserID: userID})
+	}
+}
@@ -3,18 +3,16 @@ package main
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"net/http"
+	"strconv"
+	"strings"
 
-	"github.com/go-playground/validator/v10"
+	"github.com/go-chi/chi/v5"
+	"github.com/iamYole/go-movies/internal/models"
 )
 
-var Validate *validator.Validate
-
-func init() {
-	Validate = validator.New((validator.WithRequiredStructEnabled()))
-}
-
 type JSONResponse struct {
 	Error   bool   `json:"error"`
 	Message string `json:"message"`
@@ -33,7 +31,9 @@ func (app *application) WriteJSON(w http.ResponseWriter, statusCode int, data an
 		}
 	}
 
-	w.Header().Set("Content-Type", "application/json")
+	if w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", "application/json")
+	}
 	w.WriteHeader(statusCode)
 	_, err = w.Write(out)
 	if err != nil {
@@ -64,6 +64,8 @@ func (app *application) ReadJSON(w http.ResponseWriter, r *http.Request, data an
 	return nil
 }
 
+// WriteJSONError answers with an application/problem+json body. Domain
+// errors override the status code, which defaults to 400.
 func (app *application) WriteJSONError(w http.ResponseWriter, err error, staus ...int) error {
 	statusCode := http.StatusBadRequest
 
@@ -71,9 +73,88 @@ func (app *application) WriteJSONError(w http.ResponseWriter, err error, staus .
 		statusCode = staus[0]
 	}
 
-	var payload JSONResponse
-	payload.Error = true
-	payload.Message = err.Error()
+	return app.writeProblem(w, app.newProblem(err, statusCode))
+}
+
+// readIDParam reads a positive integer URL parameter
+func readIDParam(r *http.Request, name string) (int, error) {
+	id, err := strconv.Atoi(chi.URLParam(r, name))
+	if err != nil || id < 1 {
+		return 0, fmt.Errorf("invalid %s parameter", name)
+	}
+	return id, nil
+}
+
+// readMovieFilter reads the listing filters
+// ?q=&genre=&rating=&year_from=&year_to=&runtime_min=&runtime_max=
+func readMovieFilter(r *http.Request) (models.MovieFilter, error) {
+	qs := r.URL.Query()
+	filter := models.MovieFilter{
+		Title:      strings.TrimSpace(qs.Get("q")),
+		MPAARating: qs.Get("rating"),
+	}
+
+	ints := []struct {
+		name string
+		dest *int
+	}{
+		{"genre", &filter.GenreID},
+		{"year_from", &filter.YearFrom},
+		{"year_to", &filter.YearTo},
+		{"runtime_min", &filter.RuntimeMin},
+		{"runtime_max", &filter.RuntimeMax},
+	}
+	for _, p := range ints {
+		if v := qs.Get(p.name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				return filter, fmt.Errorf("invalid %s parameter", p.name)
+			}
+			*p.dest = n
+		}
+	}
+
+	return filter, nil
+}
+
+// readFacets reads the comma separated ?facets= a listing asks for
+func readFacets(r *http.Request) ([]string, error) {
+	var facets []string
+	for _, name := range strings.Split(r.URL.Query().Get("facets"), ",") {
+		name = strings.TrimSpace(name)
+		if name == "" || contains(facets, name) {
+			continue
+		}
+		if !contains(models.MovieFacets, name) {
+			return nil, fmt.Errorf("invalid facets parameter, must be any of %s", strings.Join(models.MovieFacets, ", "))
+		}
+		facets = append(facets, name)
+	}
+	return facets, nil
+}
 
-	return app.WriteJSON(w, statusCode, payload)
+// readPage reads the ?limit=&offset= paging parameters. A missing limit is
+// reported as zero, leaving the default to the repository.
+func readPage(r *http.Request, maxLimit int) (int, int, error) {
+	qs := r.URL.Query()
+	var limit, offset int
+
+	ints := []struct {
+		name string
+		dest *int
+		max  int
+	}{
+		{"limit", &limit, maxLimit},
+		{"offset", &offset, 0},
+	}
+	for _, p := range ints {
+		if v := qs.Get(p.name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 || (p.max > 0 && n > p.max) {
+				return 0, 0, fmt.Errorf("invalid %s parameter", p.name)
+			}
+			*p.dest = n
+		}
+	}
+	return limit, offset, nil
 }
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/iamYole/go-movies/internal/models"
+	"github.com/iamYole/go-movies/internal/validation"
+)
+
+type FieldError = validation.FieldError
+
+// validateStruct runs the struct tags of data, see validation.Struct
+func validateStruct(data any) ([]FieldError, error) {
+	return validation.Struct(data)
+}
+
+// validateMovie checks the movie struct rules and that every genre exists
+func (app *application) validateMovie(ctx context.Context, movie models.Movie) ([]FieldError, error) {
+	fieldErrors, err := validateStruct(movie)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(movie.GenresArray) == 0 {
+		return fieldErrors, nil
+	}
+
+	genres, err := app.repo.Movies.GetAllGenres(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	known := make(map[int]bool, len(genres))
+	for _, g := range genres {
+		known[g.ID] = true
+	}
+	for _, id := range movie.GenresArray {
+		if !known[id] {
+			fieldErrors = append(fieldErrors, FieldError{
+				Field:   "genres_array",
+				Rule:    "genre",
+				Message: fmt.Sprintf("genre %d does not exist", id),
+			})
+		}
+	}
+
+	return fieldErrors, nil
+}
+
+// failedValidation answers with a 422 problem listing the field errors
+func (app *application) failedValidation(w http.ResponseWriter, fieldErrors []FieldError) {
+	problem := Problem{
+		Type:   app.problemType(http.StatusUnprocessableEntity),
+		Title:  http.StatusText(http.StatusUnprocessableEntity),
+		Status: http.StatusUnprocessableEntity,
+		Detail: "one or more fields are invalid",
+		Errors: fieldErrors,
+	}
+	if err := app.writeProblem(w, problem); err != nil {
+		log.Println(err)
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log"
+	"time"
+
+	"github.com/iamYole/go-movies/internal/imdb"
+	"github.com/iamYole/go-movies/internal/models"
+)
+
+// importIMDb upserts movies from local copies of title.basics.tsv.gz and,
+// optionally, title.ratings.tsv.gz used to skip obscure titles
+func importIMDb(app *application, args []string) error {
+	fs := flag.NewFlagSet("import-imdb", flag.ExitOnError)
+	basicsPath := fs.String("basics", "", "path to title.basics.tsv(.gz)")
+	ratingsPath := fs.String("ratings", "", "optional path to title.ratings.tsv(.gz)")
+	minVotes := fs.Int("min-votes", 0, "skip titles with fewer votes, needs -ratings")
+	batchSize := fs.Int("batch", 1000, "rows written per transaction")
+	limit := fs.Int("limit", 0, "stop after this many movies, 0 for all")
+	fs.Parse(args)
+
+	if *basicsPath == "" {
+		return errors.New("-basics is required")
+	}
+	if *minVotes > 0 && *ratingsPath == "" {
+		return errors.New("-min-votes needs -ratings")
+	}
+	if *batchSize < 1 {
+		return errors.New("-batch must be at least 1")
+	}
+
+	var ratings map[string]imdb.Rating
+	if *ratingsPath != "" {
+		f, err := imdb.Open(*ratingsPath)
+		if err != nil {
+			return err
+		}
+		ratings, err = imdb.ReadRatings(f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+		log.Printf("loaded %d ratings", len(ratings))
+	}
+
+	f, err := imdb.Open(*basicsPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	ctx := context.Background()
+	batch := make([]models.ImportMovie, 0, *batchSize)
+	seen, inserted, updated := 0, 0, 0
+	started := time.Now()
+
+	flush := func() error {
+		ins, upd, err := app.repo.Movies.UpsertMoviesByExternalID(ctx, "imdb", batch)
+		if err != nil {
+			return err
+		}
+		inserted += ins
+		updated += upd
+		batch = batch[:0]
+		log.Printf("%d movies read, %d inserted, %d updated", seen, inserted, updated)
+		return nil
+	}
+
+	err = imdb.ReadBasics(f, func(t imdb.Title) error {
+		if t.TitleType != "movie" || t.IsAdult || t.StartYear == 0 || t.RuntimeMinutes <= 0 {
+			return nil
+		}
+		if ratings != nil && ratings[t.TConst].NumVotes < *minVotes {
+			return nil
+		}
+
+		seen++
+		batch = append(batch, movieFromIMDb(t))
+		if len(batch) == *batchSize {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+		if *limit > 0 && seen >= *limit {
+			return imdb.ErrStop
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if err := flush(); err != nil {
+		return err
+	}
+
+	log.Printf("imdb import finished in %s", time.Since(started).Round(time.Second))
+	return nil
+}
+
+// movieFromIMDb maps a basics row onto a movie. The datasets only carry the
+// release year and no certificate, so movies start on 1 January and NR.
+func movieFromIMDb(t imdb.Title) models.ImportMovie {
+	return models.ImportMovie{
+		Movie: models.Movie{
+			Title:       t.PrimaryTitle,
+			ReleaseDate: time.Date(t.StartYear, time.January, 1, 0, 0, 0, 0, time.UTC),
+			Runtime:     t.RuntimeMinutes,
+			MPAARating:  "NR",
+		},
+		Genres:      t.Genres,
+		ExternalIDs: map[string]string{"imdb": t.TConst},
+	}
+}
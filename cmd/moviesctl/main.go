@@ -0,0 +1,113 @@
+// Command moviesctl runs operational tasks against the movies database
+// without going through the HTTP API.
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/iamYole/go-movies/internal/db"
+	"github.com/iamYole/go-movies/internal/env"
+	"github.com/iamYole/go-movies/internal/repository"
+	"github.com/iamYole/go-movies/internal/tmdb"
+)
+
+type application struct {
+	repo repository.Repository
+	tmdb *tmdb.Client
+}
+
+type command struct {
+	usage string
+	run   func(app *application, args []string) error
+}
+
+var commands = map[string]command{
+	"create-admin":   {"-email addr -first name -last name [-password pw]", createAdmin},
+	"reset-password": {"-email addr [-password pw]", resetPassword},
+	"list-users":     {"", listUsers},
+	"disable-user":   {"-email addr [-enable]", disableUser},
+	"export-movies":  {"[-o file]", exportMovies},
+	"import-movies":  {"[-i file] [-format json|csv|ndjson]", importMovies},
+	"import-imdb":    {"-basics file [-ratings file -min-votes n] [-batch n] [-limit n]", importIMDb},
+	"enrich-posters": {"[-all]", enrichPosters},
+	"seed":           {"[-force]", seed},
+}
+
+func main() {
+	log.SetFlags(0)
+
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	cmd, ok := commands[os.Args[1]]
+	if !ok {
+		usage()
+		os.Exit(2)
+	}
+
+	conn, err := db.New(env.GetString("DSN", "dsn"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer conn.Close()
+
+	tmdbClient, err := tmdb.New(tmdb.Config{
+		APIKey:     env.GetString("TMDB_API_KEY", env.GetString("IMDB_API_KEY", "")),
+		BaseURL:    env.GetString("TMDB_BASE_URL", ""),
+		SearchURL:  env.GetString("SEARCH_URL", ""),
+		MaxRetries: env.GetInt("TMDB_MAX_RETRIES", 3),
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	app := &application{
+		repo: repository.NewDbConn(conn),
+		tmdb: tmdbClient,
+	}
+
+	if err := cmd.run(app, os.Args[2:]); err != nil {
+		log.Fatalf("%s: %v", os.Args[1], err)
+	}
+}
+
+func usage() {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintln(os.Stderr, "usage: moviesctl <command> [flags]")
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-15s %s\n", name, commands[name].usage)
+	}
+}
+
+// readPassword falls back to the first line of stdin when no password flag
+// was given, so it does not have to appear in the shell history
+func readPassword(flagValue string) (string, error) {
+	if flagValue != "" {
+		return flagValue, nil
+	}
+
+	fmt.Fprint(os.Stderr, "password: ")
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return "", err
+	}
+
+	password := strings.TrimRight(line, "\r\n")
+	if len(password) < 3 {
+		return "", errors.New("password must be at least 3 characters")
+	}
+	return password, nil
+}
@@ -0,0 +1,290 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"github.com/iamYole/go-movies/internal/importer"
+	"github.com/iamYole/go-movies/internal/models"
+	"github.com/iamYole/go-movies/internal/tmdb"
+	"github.com/iamYole/go-movies/internal/validation"
+)
+
+// exportMovies writes every movie with its genre ids as a JSON array that
+// import-movies reads back
+func exportMovies(app *application, args []string) error {
+	fs := flag.NewFlagSet("export-movies", flag.ExitOnError)
+	out := fs.String("o", "", "output file, stdout when empty")
+	fs.Parse(args)
+
+	ctx := context.Background()
+	movies, err := app.repo.Movies.GetMovies(ctx, models.MovieFilter{})
+	if err != nil {
+		return err
+	}
+
+	full := make([]*models.Movie, 0, len(movies))
+	for _, m := range movies {
+		movie, _, err := app.repo.Movies.EditMovie(ctx, int64(m.ID))
+		if err != nil {
+			return err
+		}
+		full = append(full, movie)
+	}
+
+	var w io.Writer = os.Stdout
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(full); err != nil {
+		return err
+	}
+
+	log.Printf("exported %d movies", len(full))
+	return nil
+}
+
+// importMovies reads the JSON written by export-movies, or a CSV or NDJSON
+// catalog with genres given by name
+func importMovies(app *application, args []string) error {
+	fs := flag.NewFlagSet("import-movies", flag.ExitOnError)
+	in := fs.String("i", "", "input file, stdin when empty")
+	format := fs.String("format", "", "json, csv or ndjson, guessed from the file name when empty")
+	fs.Parse(args)
+
+	var r io.Reader = os.Stdin
+	if *in != "" {
+		f, err := os.Open(*in)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	if *format == "" {
+		*format = importer.FormatFor("", *in)
+	}
+	if *format == importer.FormatCSV || *format == importer.FormatNDJSON {
+		return app.importCatalog(r, *format)
+	}
+
+	var movies []models.Movie
+	if err := json.NewDecoder(r).Decode(&movies); err != nil {
+		return err
+	}
+
+	//the same rules as the catalog formats, checked before anything is written
+	failed := 0
+	for i, movie := range movies {
+		fieldErrors, err := validation.Struct(movie)
+		if err != nil {
+			return err
+		}
+		for _, fe := range fieldErrors {
+			log.Printf("movie %d %q: %s %s", i+1, movie.Title, fe.Field, fe.Message)
+		}
+		if len(fieldErrors) > 0 {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d movies are invalid, nothing imported", failed)
+	}
+
+	ctx := context.Background()
+	for _, movie := range movies {
+		id, err := app.insertMovie(ctx, movie)
+		if err != nil {
+			return fmt.Errorf("%q: %w", movie.Title, err)
+		}
+		log.Printf("imported %q as %d", movie.Title, id)
+	}
+	return nil
+}
+
+func (app *application) importCatalog(r io.Reader, format string) error {
+	rows, err := importer.Parse(r, format)
+	if err != nil {
+		return err
+	}
+
+	movies := make([]models.ImportMovie, 0, len(rows))
+	failed := 0
+	for _, row := range rows {
+		if row.Err != nil {
+			log.Printf("line %d: %v", row.Line, row.Err)
+			failed++
+			continue
+		}
+
+		//the same rules as an import through the API
+		fieldErrors, err := validation.Struct(row.Movie.Movie)
+		if err != nil {
+			return err
+		}
+		for _, fe := range fieldErrors {
+			log.Printf("line %d: %s %s", row.Line, fe.Field, fe.Message)
+		}
+		if len(fieldErrors) > 0 {
+			failed++
+			continue
+		}
+		movies = append(movies, row.Movie)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d rows are invalid, nothing imported", failed)
+	}
+
+	_, inserted, updated, err := app.repo.Movies.ImportMovies(context.Background(), movies)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("imported %d movies, updated %d", inserted, updated)
+	return nil
+}
+
+// enrichPosters looks up posters for movies without one, or for every movie
+// with -all. Posters an editor has locked are skipped.
+func enrichPosters(app *application, args []string) error {
+	fs := flag.NewFlagSet("enrich-posters", flag.ExitOnError)
+	all := fs.Bool("all", false, "refresh movies that already have a poster")
+	fs.Parse(args)
+
+	ctx := context.Background()
+	movies, err := app.repo.Movies.GetMovies(ctx, models.MovieFilter{})
+	if err != nil {
+		return err
+	}
+
+	updated := 0
+	for _, m := range movies {
+		if m.Image != "" && !*all {
+			continue
+		}
+
+		movie, _, err := app.repo.Movies.EditMovie(ctx, int64(m.ID))
+		if err != nil {
+			return err
+		}
+		if movie.IsLocked("image") {
+			continue
+		}
+
+		poster, err := app.tmdb.Poster(ctx, movie.Title, movie.ReleaseDate.Year(), movie.ExternalIDs)
+		switch {
+		case errors.Is(err, tmdb.ErrNotConfigured), errors.Is(err, tmdb.ErrUnauthorized):
+			return err
+		case err != nil:
+			log.Printf("%q: %v", m.Title, err)
+			continue
+		}
+		if poster == "" || poster == movie.Image {
+			continue
+		}
+
+		movie.Image = poster
+		if _, _, err := app.repo.Movies.PatchMovie(ctx, *movie, []string{"image"}); err != nil {
+			return fmt.Errorf("%q: %w", m.Title, err)
+		}
+		updated++
+	}
+
+	log.Printf("updated %d posters", updated)
+	return nil
+}
+
+var demoMovies = []struct {
+	title       string
+	released    string
+	runtime     int
+	rating      string
+	description string
+	genres      []string
+}{
+	{"Highlander", "1986-03-07", 116, "R", "He fought his first battle on the Scottish Highlands in 1536. He will fight his greatest battle on the streets of New York City in 1986.", []string{"Action", "Fantasy"}},
+	{"Raiders of the Lost Ark", "1981-06-12", 115, "PG13", "Archaeology professor Indiana Jones ventures to seize a biblical artefact known as the Ark of the Covenant.", []string{"Action", "Adventure"}},
+	{"The Godfather", "1972-03-24", 175, "18A", "The aging patriarch of an organized crime dynasty transfers control of his empire to his son.", []string{"Crime", "Drama"}},
+	{"Alien", "1979-05-25", 117, "R", "The crew of a commercial spacecraft encounter a deadly lifeform after investigating an unknown transmission.", []string{"Horror", "Sci-Fi"}},
+	{"Toy Story", "1995-11-22", 81, "G", "A cowboy doll is threatened when a new spaceman figure supplants him as top toy in a boy's room.", []string{"Animation", "Comedy"}},
+}
+
+// seed inserts a few well known movies so a fresh database has something to
+// show
+func seed(app *application, args []string) error {
+	fs := flag.NewFlagSet("seed", flag.ExitOnError)
+	force := fs.Bool("force", false, "seed even if movies already exist")
+	fs.Parse(args)
+
+	ctx := context.Background()
+	existing, err := app.repo.Movies.GetMovies(ctx, models.MovieFilter{})
+	if err != nil {
+		return err
+	}
+	if len(existing) > 0 && !*force {
+		log.Printf("database already has %d movies, use -force to seed anyway", len(existing))
+		return nil
+	}
+
+	genres, err := app.repo.Movies.GetAllGenres(ctx)
+	if err != nil {
+		return err
+	}
+	genreIDs := make(map[string]int, len(genres))
+	for _, g := range genres {
+		genreIDs[g.Genre] = g.ID
+	}
+
+	for _, d := range demoMovies {
+		released, err := time.Parse("2006-01-02", d.released)
+		if err != nil {
+			return err
+		}
+
+		movie := models.Movie{
+			Title:       d.title,
+			ReleaseDate: released,
+			Runtime:     d.runtime,
+			MPAARating:  d.rating,
+			Description: d.description,
+		}
+		for _, name := range d.genres {
+			if id, ok := genreIDs[name]; ok {
+				movie.GenresArray = append(movie.GenresArray, id)
+			}
+		}
+
+		if _, err := app.insertMovie(ctx, movie); err != nil {
+			return fmt.Errorf("%q: %w", d.title, err)
+		}
+	}
+
+	log.Printf("seeded %d movies", len(demoMovies))
+	return nil
+}
+
+// insertMovie saves a new movie with its genres and first revision, the same
+// way the admin API does
+func (app *application) insertMovie(ctx context.Context, movie models.Movie) (int, error) {
+	newID, err := app.repo.Movies.InsertMovie(ctx, movie)
+	if err != nil {
+		return 0, err
+	}
+	return int(newID), nil
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/iamYole/go-movies/internal/models"
+)
+
+func createAdmin(app *application, args []string) error {
+	fs := flag.NewFlagSet("create-admin", flag.ExitOnError)
+	email := fs.String("email", "", "email address")
+	first := fs.String("first", "", "first name")
+	last := fs.String("last", "", "last name")
+	pw := fs.String("password", "", "password, read from stdin when empty")
+	fs.Parse(args)
+
+	if *email == "" || *first == "" || *last == "" {
+		return errors.New("-email, -first and -last are required")
+	}
+
+	password, err := readPassword(*pw)
+	if err != nil {
+		return err
+	}
+
+	user := models.User{
+		FirstName: *first,
+		LastName:  *last,
+		Email:     *email,
+		IsAdmin:   true,
+	}
+	if err := user.Password.Set(password); err != nil {
+		return err
+	}
+
+	if _, err := app.repo.Users.CreateUser(context.Background(), user); err != nil {
+		return err
+	}
+
+	fmt.Printf("created admin %s\n", *email)
+	return nil
+}
+
+func resetPassword(app *application, args []string) error {
+	fs := flag.NewFlagSet("reset-password", flag.ExitOnError)
+	email := fs.String("email", "", "email address")
+	pw := fs.String("password", "", "new password, read from stdin when empty")
+	fs.Parse(args)
+
+	if *email == "" {
+		return errors.New("-email is required")
+	}
+
+	ctx := context.Background()
+	user, err := app.repo.Users.GetUserByEmail(ctx, *email)
+	if err != nil {
+		return err
+	}
+
+	password, err := readPassword(*pw)
+	if err != nil {
+		return err
+	}
+	if err := user.Password.Set(password); err != nil {
+		return err
+	}
+
+	if err := app.repo.Users.UpdatePassword(ctx, *user); err != nil {
+		return err
+	}
+
+	fmt.Printf("password reset for %s\n", *email)
+	return nil
+}
+
+func listUsers(app *application, args []string) error {
+	users, err := app.repo.Users.GetUsers(context.Background())
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tEMAIL\tNAME\tADMIN\tDISABLED")
+	for _, u := range users {
+		disabled := ""
+		if u.DisabledAt != nil {
+			disabled = u.DisabledAt.Format("2006-01-02")
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s %s\t%t\t%s\n", u.ID, u.Email, u.FirstName, u.LastName, u.IsAdmin, disabled)
+	}
+	return tw.Flush()
+}
+
+func disableUser(app *application, args []string) error {
+	fs := flag.NewFlagSet("disable-user", flag.ExitOnError)
+	email := fs.String("email", "", "email address")
+	enable := fs.Bool("enable", false, "enable the user again instead")
+	fs.Parse(args)
+
+	if *email == "" {
+		return errors.New("-email is required")
+	}
+
+	ctx := context.Background()
+	user, err := app.repo.Users.GetUserByEmail(ctx, *email)
+	if err != nil {
+		return err
+	}
+
+	if err := app.repo.Users.SetUserDisabled(ctx, int64(user.ID), !*enable); err != nil {
+		return err
+	}
+
+	state := "disabled"
+	if *enable {
+		state = "enabled"
+	}
+	fmt.Printf("%s %s\n", state, *email)
+	return nil
+}
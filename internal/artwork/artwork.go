@@ -0,0 +1,214 @@
+// Package artwork stores movie posters and backdrops in a blob store, with
+// resized variants, whether uploaded by an editor or downloaded from TMDB.
+package artwork
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/iamYole/go-movies/internal/blob"
+	"github.com/iamYole/go-movies/internal/imaging"
+	"github.com/iamYole/go-movies/internal/jobs"
+	"github.com/iamYole/go-movies/internal/models"
+	"github.com/iamYole/go-movies/internal/tmdb"
+)
+
+// JobKind is the job kind handled by Service.Handle
+const JobKind = "fetch_artwork"
+
+// MaxSize bounds the size of an uploaded or downloaded original
+const MaxSize = 10 << 20
+
+// widths are the widths of the resized variants of each kind of artwork,
+// matching the sizes TMDB itself serves
+var widths = map[string]map[string]int{
+	models.ImagePoster:   {"thumb": 185, "medium": 500},
+	models.ImageBackdrop: {"thumb": 300, "medium": 780},
+}
+
+// Payload is the job payload for downloading one piece of TMDB artwork
+type Payload struct {
+	MovieID int    `json:"movie_id"`
+	Kind    string `json:"kind"`
+}
+
+// Movies is the part of the movie repository the service needs
+type Movies interface {
+	EditMovie(context.Context, int64) (*models.Movie, []*models.Genre, error)
+	SetMovieImage(ctx context.Context, movieID int, kind string, imageID int64, version int) (int, error)
+}
+
+// Images is the image repository
+type Images interface {
+	InsertImage(context.Context, models.Image) (int64, error)
+	GetImage(context.Context, int64) (*models.Image, error)
+}
+
+type Service struct {
+	Movies Movies
+	Images Images
+	Store  blob.Store
+
+	// ImageURL is the TMDB image root, tmdb.DefaultImageURL when empty
+	ImageURL string
+	HTTP     *http.Client
+}
+
+// Enqueue queues the download of a movie's TMDB poster or backdrop
+func Enqueue(ctx context.Context, store jobs.Store, movieID int, kind string) error {
+	key := kind + ":" + strconv.Itoa(movieID)
+	return jobs.Enqueue(ctx, store, JobKind, key, Payload{MovieID: movieID, Kind: kind})
+}
+
+// Save stores data and its variants and records it as an image of the movie.
+// It fails with imaging.ErrUnsupported when data is not a usable image.
+func (s *Service) Save(ctx context.Context, movieID int, kind, source, sourcePath string, data []byte) (*models.Image, error) {
+	sizes, ok := widths[kind]
+	if !ok {
+		return nil, fmt.Errorf("unknown image kind %q", kind)
+	}
+
+	src, err := imaging.Decode(data)
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha256.Sum256(data)
+	image := models.Image{
+		MovieID:     movieID,
+		Kind:        kind,
+		Source:      source,
+		SourcePath:  sourcePath,
+		Hash:        hex.EncodeToString(sum[:]),
+		ContentType: src.ContentType,
+		Width:       src.Width,
+		Height:      src.Height,
+		Size:        int64(len(data)),
+	}
+
+	if err := s.Store.Put(ctx, image.Key("original"), data, image.ContentType); err != nil {
+		return nil, err
+	}
+	for variant, width := range sizes {
+		resized, err := imaging.JPEG(src, width)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.Store.Put(ctx, image.Key(variant), resized, "image/jpeg"); err != nil {
+			return nil, err
+		}
+	}
+
+	image.ID, err = s.Images.InsertImage(ctx, image)
+	if err != nil {
+		return nil, err
+	}
+	return &image, nil
+}
+
+// Handle is the jobs.Handler for JobKind
+func (s *Service) Handle(ctx context.Context, job *models.Job) error {
+	var p Payload
+	if err := json.Unmarshal(job.Payload, &p); err != nil {
+		return jobs.Permanent(fmt.Errorf("decoding payload: %w", err))
+	}
+
+	err := s.Fetch(ctx, p.MovieID, p.Kind)
+	switch {
+	case errors.Is(err, models.ErrNotFound):
+		//deleted since it was queued
+		return nil
+	case errors.Is(err, tmdb.ErrNotFound), errors.Is(err, imaging.ErrUnsupported):
+		return jobs.Permanent(err)
+	}
+	return err
+}
+
+// Fetch downloads the TMDB artwork a movie points at into the store. Artwork
+// an editor uploaded is never replaced, and a path already downloaded is not
+// fetched again.
+func (s *Service) Fetch(ctx context.Context, movieID int, kind string) error {
+	movie, _, err := s.Movies.EditMovie(ctx, int64(movieID))
+	if err != nil {
+		return err
+	}
+
+	path, current := movie.Image, movie.PosterImageID
+	if kind == models.ImageBackdrop {
+		path, current = movie.Backdrop, movie.BackdropImageID
+	}
+	//anything but a TMDB path was set by hand and is left alone
+	if !strings.HasPrefix(path, "/") {
+		return nil
+	}
+
+	if current != nil {
+		image, err := s.Images.GetImage(ctx, *current)
+		if err != nil && !errors.Is(err, models.ErrNotFound) {
+			return err
+		}
+		if image != nil && (image.Source == models.ImageSourceUpload || image.SourcePath == path) {
+			return nil
+		}
+	}
+
+	data, err := s.download(ctx, path)
+	if err != nil {
+		return err
+	}
+	image, err := s.Save(ctx, movie.ID, kind, models.ImageSourceTMDB, path, data)
+	if err != nil {
+		return err
+	}
+
+	//set at the version read above, so an upload racing the download wins
+	//and the retry sees it
+	_, err = s.Movies.SetMovieImage(ctx, movie.ID, kind, image.ID, movie.Version)
+	return err
+}
+
+func (s *Service) download(ctx context.Context, path string) ([]byte, error) {
+	base := s.ImageURL
+	if base == "" {
+		base = tmdb.DefaultImageURL
+	}
+	client := s.HTTP
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimRight(base, "/")+"/original"+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	switch {
+	case res.StatusCode == http.StatusNotFound:
+		return nil, fmt.Errorf("artwork %s: %w", path, tmdb.ErrNotFound)
+	case res.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("artwork %s: %s", path, res.Status)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(res.Body, MaxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > MaxSize {
+		return nil, jobs.Permanent(fmt.Errorf("artwork %s is larger than %d bytes", path, MaxSize))
+	}
+	return data, nil
+}
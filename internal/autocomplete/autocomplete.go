@@ -0,0 +1,45 @@
+// Package autocomplete suggests titles and names as a user types. Each
+// keystroke is a request, so recent queries are answered from memory.
+package autocomplete
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"github.com/iamYole/go-movies/internal/models"
+)
+
+// Store is the part of the autocomplete repository the service needs
+type Store interface {
+	Autocomplete(ctx context.Context, q string, limit int) ([]*models.Suggestion, error)
+}
+
+type Service struct {
+	Store Store
+	// Cache may be nil, which sends every query to the store
+	Cache *Cache
+}
+
+// Suggest returns the best limit matches for q. Queries differing only in
+// case or spacing share a cache entry; edits to titles and names show up
+// once the entries they touch expire.
+func (s *Service) Suggest(ctx context.Context, q string, limit int) ([]*models.Suggestion, error) {
+	q = strings.Join(strings.Fields(strings.ToLower(q)), " ")
+	key := strconv.Itoa(limit) + ":" + q
+
+	if s.Cache != nil {
+		if suggestions, ok := s.Cache.Get(key); ok {
+			return suggestions, nil
+		}
+	}
+
+	suggestions, err := s.Store.Autocomplete(ctx, q, limit)
+	if err != nil {
+		return nil, err
+	}
+	if s.Cache != nil {
+		s.Cache.Put(key, suggestions)
+	}
+	return suggestions, nil
+}
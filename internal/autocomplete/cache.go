@@ -0,0 +1,72 @@
+package autocomplete
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"github.com/iamYole/go-movies/internal/models"
+)
+
+// Cache keeps the suggestions of recent queries, evicting the least
+// recently used beyond its size and any older than its TTL
+type Cache struct {
+	size int
+	ttl  time.Duration
+
+	mu    sync.Mutex
+	order *list.List
+	items map[string]*list.Element
+}
+
+type cacheEntry struct {
+	key         string
+	suggestions []*models.Suggestion
+	expires     time.Time
+}
+
+func NewCache(size int, ttl time.Duration) *Cache {
+	return &Cache{size: size, ttl: ttl, order: list.New(), items: map[string]*list.Element{}}
+}
+
+func (c *Cache) Get(key string) ([]*models.Suggestion, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	entry := el.Value.(*cacheEntry)
+	if time.Now().After(entry.expires) {
+		c.order.Remove(el)
+		delete(c.items, key)
+		return nil, false
+	}
+	c.order.MoveToFront(el)
+	return entry.suggestions, true
+}
+
+func (c *Cache) Put(key string, suggestions []*models.Suggestion) {
+	if c.size <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	expires := time.Now().Add(c.ttl)
+	if el, ok := c.items[key]; ok {
+		entry := el.Value.(*cacheEntry)
+		entry.suggestions, entry.expires = suggestions, expires
+		c.order.MoveToFront(el)
+		return
+	}
+
+	c.items[key] = c.order.PushFront(&cacheEntry{key: key, suggestions: suggestions, expires: expires})
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*cacheEntry).key)
+	}
+}
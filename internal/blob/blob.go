@@ -0,0 +1,26 @@
+// Package blob stores opaque objects by key. The interface follows the S3
+// object model, so the local filesystem store used in development and the
+// S3 store used in production are interchangeable.
+package blob
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+var ErrNotFound = errors.New("blob: object not found")
+
+// Object describes a stored object
+type Object struct {
+	Size        int64
+	ContentType string
+}
+
+type Store interface {
+	// Put stores data under key, replacing any object already there
+	Put(ctx context.Context, key string, data []byte, contentType string) error
+	// Get opens the object under key. The caller closes the reader.
+	Get(ctx context.Context, key string) (io.ReadCloser, *Object, error)
+	Delete(ctx context.Context, key string) error
+}
@@ -0,0 +1,162 @@
+package blob
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type S3Config struct {
+	// Endpoint is the service root, such as https://s3.eu-west-1.amazonaws.com
+	// or the address of a MinIO server
+	Endpoint  string
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+}
+
+// S3 stores objects in a bucket of any S3 compatible service. Requests are
+// signed with AWS Signature Version 4 and use path style addressing, which
+// every compatible service understands.
+type S3 struct {
+	cfg  S3Config
+	base *url.URL
+	http *http.Client
+}
+
+func NewS3(cfg S3Config) (*S3, error) {
+	base, err := url.Parse(strings.TrimRight(cfg.Endpoint, "/"))
+	if err != nil || base.Scheme == "" || base.Host == "" {
+		return nil, fmt.Errorf("blob: invalid s3 endpoint %q", cfg.Endpoint)
+	}
+	if cfg.Bucket == "" {
+		return nil, fmt.Errorf("blob: s3 bucket is required")
+	}
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+	return &S3{cfg: cfg, base: base, http: &http.Client{Timeout: 30 * time.Second}}, nil
+}
+
+func (s *S3) objectURL(key string) *url.URL {
+	segments := strings.Split(key, "/")
+	for i, seg := range segments {
+		segments[i] = url.PathEscape(seg)
+	}
+	//Path holds the key as is and RawPath its escaped form, which String
+	//and the signature then use instead of escaping Path a second time
+	u := *s.base
+	u.Path = s.base.Path + "/" + s.cfg.Bucket + "/" + key
+	u.RawPath = s.base.EscapedPath() + "/" + url.PathEscape(s.cfg.Bucket) + "/" + strings.Join(segments, "/")
+	return &u
+}
+
+func (s *S3) do(ctx context.Context, method, key string, body []byte, contentType string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, s.objectURL(key).String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	req.ContentLength = int64(len(body))
+
+	sum := sha256.Sum256(body)
+	s.sign(req, hex.EncodeToString(sum[:]), time.Now().UTC())
+	return s.http.Do(req)
+}
+
+func (s *S3) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	res, err := s.do(ctx, http.MethodPut, key, data, contentType)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	return s.check(res, key)
+}
+
+func (s *S3) Get(ctx context.Context, key string) (io.ReadCloser, *Object, error) {
+	res, err := s.do(ctx, http.MethodGet, key, nil, "")
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := s.check(res, key); err != nil {
+		res.Body.Close()
+		return nil, nil, err
+	}
+
+	size, _ := strconv.ParseInt(res.Header.Get("Content-Length"), 10, 64)
+	return res.Body, &Object{Size: size, ContentType: res.Header.Get("Content-Type")}, nil
+}
+
+func (s *S3) Delete(ctx context.Context, key string) error {
+	res, err := s.do(ctx, http.MethodDelete, key, nil, "")
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	return s.check(res, key)
+}
+
+func (s *S3) check(res *http.Response, key string) error {
+	switch {
+	case res.StatusCode == http.StatusNotFound:
+		return ErrNotFound
+	case res.StatusCode >= 300:
+		msg, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+		return fmt.Errorf("blob: s3 %s %s: %s %s", res.Request.Method, key, res.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
+
+// sign adds a Signature Version 4 Authorization header to req
+func (s *S3) sign(req *http.Request, payloadHash string, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	day := now.Format("20060102")
+
+	req.Header.Set("x-amz-date", amzDate)
+	req.Header.Set("x-amz-content-sha256", payloadHash)
+
+	signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+	canonicalHeaders := "host:" + req.URL.Host + "\n" +
+		"x-amz-content-sha256:" + payloadHash + "\n" +
+		"x-amz-date:" + amzDate + "\n"
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders,
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := day + "/" + s.cfg.Region + "/s3/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+s.cfg.SecretKey), day)
+	key = hmacSHA256(key, s.cfg.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.cfg.AccessKey, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
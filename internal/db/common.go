@@ -4,4 +4,5 @@ import "time"
 
 var (
 	QueryTimeoutDuration = 5 * time.Second
+	BulkTimeoutDuration  = 2 * time.Minute
 )
@@ -0,0 +1,49 @@
+-- base schema, written with "if not exists" so databases created before
+-- migrations existed can adopt it
+create table if not exists genres (
+    id serial primary key,
+    genre varchar(255) not null unique,
+    created_at timestamp without time zone not null default now(),
+    updated_at timestamp without time zone not null default now()
+);
+
+create table if not exists movies (
+    id serial primary key,
+    title varchar(512) not null,
+    release_date date not null,
+    runtime integer not null,
+    mpaa_rating varchar(10) not null,
+    description text not null default '',
+    image varchar(255),
+    created_at timestamp without time zone not null default now(),
+    updated_at timestamp without time zone not null default now()
+);
+
+create table if not exists movies_genres (
+    id serial primary key,
+    movie_id integer not null references movies (id) on delete cascade,
+    genre_id integer not null references genres (id) on delete cascade
+);
+
+create index if not exists movies_genres_movie_id_idx on movies_genres (movie_id);
+
+create table if not exists users (
+    id serial primary key,
+    first_name varchar(255) not null,
+    last_name varchar(255) not null,
+    email varchar(255) not null unique,
+    password varchar(255) not null,
+    created_at timestamp without time zone not null default now(),
+    updated_at timestamp without time zone not null default now()
+);
+
+-- a genres table that predates migrations may lack the unique constraint
+-- "on conflict (genre)" relies on; the index takes the name the constraint
+-- has on new databases, so it is only built where it is missing
+create unique index if not exists genres_genre_key on genres (genre);
+
+insert into genres (genre) values
+    ('Comedy'), ('Sci-Fi'), ('Horror'), ('Romance'), ('Action'), ('Thriller'),
+    ('Drama'), ('Mystery'), ('Crime'), ('Animation'), ('Adventure'), ('Fantasy'),
+    ('Superhero')
+on conflict (genre) do nothing;
@@ -0,0 +1,9 @@
+-- full snapshots of a movie, numbered per movie, written on every change
+create table if not exists movie_revisions (
+    id serial primary key,
+    movie_id integer not null references movies (id) on delete cascade,
+    revision integer not null,
+    snapshot jsonb not null,
+    created_at timestamp without time zone not null default now(),
+    unique (movie_id, revision)
+);
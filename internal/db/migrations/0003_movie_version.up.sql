@@ -0,0 +1,2 @@
+-- optimistic concurrency: bumped on every write, exposed as the movie ETag
+alter table movies add column if not exists version integer not null default 1;
@@ -0,0 +1,3 @@
+alter table users
+    drop column if exists disabled_at,
+    drop column if exists is_admin;
@@ -0,0 +1,3 @@
+alter table users
+    add column is_admin boolean not null default false,
+    add column disabled_at timestamp without time zone;
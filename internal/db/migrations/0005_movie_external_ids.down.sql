@@ -0,0 +1 @@
+drop table if exists movie_external_ids;
@@ -0,0 +1,11 @@
+-- links to outside catalogs, one id per source per movie; an IMDb title id
+-- (tconst) is the imdb source
+create table movie_external_ids (
+    id serial primary key,
+    movie_id integer not null references movies (id) on delete cascade,
+    source varchar(32) not null,
+    external_id varchar(64) not null,
+    created_at timestamp without time zone not null default now(),
+    unique (source, external_id),
+    unique (movie_id, source)
+);
@@ -0,0 +1,23 @@
+-- background work, claimed by workers with for update skip locked
+create table jobs (
+    id bigserial primary key,
+    kind varchar(64) not null,
+    key varchar(128),
+    payload jsonb not null default '{}',
+    status varchar(16) not null default 'pending'
+        check (status in ('pending', 'running', 'done', 'dead')),
+    attempts integer not null default 0,
+    max_attempts integer not null default 5,
+    run_at timestamp with time zone not null default now(),
+    locked_at timestamp with time zone,
+    locked_by varchar(128),
+    last_error text,
+    created_at timestamp with time zone not null default now(),
+    updated_at timestamp with time zone not null default now()
+);
+
+create index jobs_ready_idx on jobs (run_at, id) where status = 'pending';
+create index jobs_status_idx on jobs (status, updated_at);
+
+-- at most one pending job per key, so repeated edits collapse into one run
+create unique index jobs_pending_key_idx on jobs (kind, key) where status = 'pending';
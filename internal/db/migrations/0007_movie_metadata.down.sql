@@ -0,0 +1,10 @@
+alter table genres drop column if exists tmdb_id;
+
+drop index if exists movies_tmdb_synced_at_idx;
+
+alter table movies
+    drop column if exists backdrop,
+    drop column if exists original_language,
+    drop column if exists tagline,
+    drop column if exists locked_fields,
+    drop column if exists tmdb_synced_at;
@@ -0,0 +1,25 @@
+-- metadata synced from TMDB, and the fields editors have taken over from it
+alter table movies
+    add column backdrop varchar(255) not null default '',
+    add column original_language varchar(16) not null default '',
+    add column tagline text not null default '',
+    add column locked_fields text[] not null default '{}',
+    add column tmdb_synced_at timestamp without time zone;
+
+create index movies_tmdb_synced_at_idx on movies (tmdb_synced_at nulls first);
+
+-- tmdb genre ids, so synced genres do not depend on matching names
+alter table genres add column tmdb_id integer unique;
+
+insert into genres (genre) values
+    ('Documentary'), ('Family'), ('History'), ('Music'), ('War'), ('Western'), ('TV Movie')
+on conflict (genre) do nothing;
+
+update genres g set tmdb_id = v.tmdb_id
+from (values
+    (28, 'Action'), (12, 'Adventure'), (16, 'Animation'), (35, 'Comedy'), (80, 'Crime'),
+    (99, 'Documentary'), (18, 'Drama'), (10751, 'Family'), (14, 'Fantasy'), (36, 'History'),
+    (27, 'Horror'), (10402, 'Music'), (9648, 'Mystery'), (10749, 'Romance'), (878, 'Sci-Fi'),
+    (10770, 'TV Movie'), (53, 'Thriller'), (10752, 'War'), (37, 'Western')
+) as v(tmdb_id, genre)
+where g.genre = v.genre;
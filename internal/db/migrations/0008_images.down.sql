@@ -0,0 +1,5 @@
+alter table movies
+    drop column if exists poster_image_id,
+    drop column if exists backdrop_image_id;
+
+drop table if exists images;
@@ -0,0 +1,21 @@
+-- stored artwork; the blobs live in the image store under their content hash
+create table images (
+    id bigserial primary key,
+    movie_id integer references movies (id) on delete cascade,
+    kind varchar(16) not null check (kind in ('poster', 'backdrop')),
+    source varchar(16) not null check (source in ('upload', 'tmdb')),
+    -- the tmdb path an image was downloaded from
+    source_path varchar(255) not null default '',
+    hash char(64) not null,
+    content_type varchar(64) not null,
+    width integer not null,
+    height integer not null,
+    size bigint not null,
+    created_at timestamp without time zone not null default now()
+);
+
+create index images_movie_id_idx on images (movie_id);
+
+alter table movies
+    add column poster_image_id bigint references images (id) on delete set null,
+    add column backdrop_image_id bigint references images (id) on delete set null;
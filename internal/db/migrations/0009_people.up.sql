@@ -0,0 +1,28 @@
+-- cast and crew
+create table people (
+    id serial primary key,
+    name varchar(255) not null,
+    biography text not null default '',
+    birth_date date,
+    death_date date,
+    created_at timestamp without time zone not null default now(),
+    updated_at timestamp without time zone not null default now()
+);
+
+create index people_name_idx on people (lower(name));
+
+create table movie_credits (
+    id serial primary key,
+    movie_id integer not null references movies (id) on delete cascade,
+    person_id integer not null references people (id) on delete cascade,
+    role varchar(16) not null check (role in ('actor', 'director', 'writer', 'composer')),
+    character varchar(255) not null default '',
+    -- lower comes first; the top billed cast is the lowest orders
+    billing_order integer not null default 0,
+    created_at timestamp without time zone not null default now(),
+    updated_at timestamp without time zone not null default now(),
+    unique (movie_id, person_id, role, character)
+);
+
+create index movie_credits_movie_id_idx on movie_credits (movie_id, billing_order);
+create index movie_credits_person_id_idx on movie_credits (person_id);
@@ -0,0 +1,7 @@
+alter table movies
+    drop column if exists rating_count,
+    drop column if exists rating_sum;
+
+drop table if exists review_votes;
+drop table if exists reviews;
+drop table if exists ratings;
@@ -0,0 +1,40 @@
+-- one rating per user per movie
+create table ratings (
+    movie_id integer not null references movies (id) on delete cascade,
+    user_id integer not null references users (id) on delete cascade,
+    rating smallint not null check (rating between 1 and 10),
+    created_at timestamp without time zone not null default now(),
+    updated_at timestamp without time zone not null default now(),
+    primary key (movie_id, user_id)
+);
+
+create index ratings_user_id_idx on ratings (user_id);
+
+-- one review per user per movie; the rating lives in ratings
+create table reviews (
+    id serial primary key,
+    movie_id integer not null references movies (id) on delete cascade,
+    user_id integer not null references users (id) on delete cascade,
+    title varchar(255) not null,
+    body text not null,
+    spoiler boolean not null default false,
+    helpful_count integer not null default 0,
+    created_at timestamp without time zone not null default now(),
+    updated_at timestamp without time zone not null default now(),
+    unique (movie_id, user_id)
+);
+
+create index reviews_movie_newest_idx on reviews (movie_id, created_at desc);
+create index reviews_movie_helpful_idx on reviews (movie_id, helpful_count desc, created_at desc);
+
+create table review_votes (
+    review_id integer not null references reviews (id) on delete cascade,
+    user_id integer not null references users (id) on delete cascade,
+    created_at timestamp without time zone not null default now(),
+    primary key (review_id, user_id)
+);
+
+-- running totals, kept in step with ratings by every rating write
+alter table movies
+    add column rating_count integer not null default 0,
+    add column rating_sum integer not null default 0;
@@ -0,0 +1,7 @@
+alter table users
+    drop column if exists warning_count,
+    drop column if exists suspended_until;
+
+drop table if exists moderation_actions;
+drop table if exists comment_reports;
+drop table if exists comments;
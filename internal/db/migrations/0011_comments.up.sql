@@ -0,0 +1,47 @@
+-- threaded discussion under movies. Comments waiting in the moderation
+-- queue are pending; moderators may hide them or delete their text.
+create table comments (
+    id serial primary key,
+    movie_id integer not null references movies (id) on delete cascade,
+    user_id integer not null references users (id) on delete cascade,
+    parent_id integer references comments (id) on delete cascade,
+    body text not null,
+    status varchar(16) not null default 'visible'
+        check (status in ('visible', 'pending', 'hidden', 'deleted')),
+    -- why a pending comment was queued: reports or word_list
+    queue_reason varchar(16) not null default '',
+    report_count integer not null default 0,
+    created_at timestamp without time zone not null default now(),
+    updated_at timestamp without time zone not null default now()
+);
+
+create index comments_movie_root_idx on comments (movie_id, created_at desc) where parent_id is null;
+create index comments_parent_id_idx on comments (parent_id);
+create index comments_pending_idx on comments (updated_at) where status = 'pending';
+
+create table comment_reports (
+    comment_id integer not null references comments (id) on delete cascade,
+    user_id integer not null references users (id) on delete cascade,
+    reason varchar(16) not null check (reason in ('spam', 'abuse', 'spoiler', 'off_topic', 'other')),
+    details text not null default '',
+    created_at timestamp without time zone not null default now(),
+    primary key (comment_id, user_id)
+);
+
+-- the audit log of moderation; moderator_id is null for automatic queueing
+create table moderation_actions (
+    id serial primary key,
+    action varchar(16) not null check (action in ('queue', 'approve', 'hide', 'delete', 'warn', 'suspend')),
+    moderator_id integer references users (id) on delete set null,
+    comment_id integer references comments (id) on delete set null,
+    user_id integer references users (id) on delete cascade,
+    reason text not null default '',
+    created_at timestamp without time zone not null default now()
+);
+
+create index moderation_actions_comment_id_idx on moderation_actions (comment_id);
+create index moderation_actions_user_id_idx on moderation_actions (user_id);
+
+alter table users
+    add column warning_count integer not null default 0,
+    add column suspended_until timestamp without time zone;
@@ -0,0 +1,30 @@
+-- a user's watchlist and custom lists; slugs address lists shared by link
+create table lists (
+    id serial primary key,
+    user_id integer not null references users (id) on delete cascade,
+    name varchar(100) not null,
+    slug varchar(120) not null unique,
+    description text not null default '',
+    visibility varchar(10) not null default 'private'
+        check (visibility in ('private', 'unlisted', 'public')),
+    is_watchlist boolean not null default false,
+    created_at timestamp without time zone not null default now(),
+    updated_at timestamp without time zone not null default now()
+);
+
+create index lists_user_id_idx on lists (user_id);
+
+-- every user has at most one watchlist, created on first use
+create unique index lists_one_watchlist_idx on lists (user_id) where is_watchlist;
+
+create table list_items (
+    list_id integer not null references lists (id) on delete cascade,
+    movie_id integer not null references movies (id) on delete cascade,
+    position integer not null,
+    note text not null default '',
+    added_at timestamp without time zone not null default now(),
+    primary key (list_id, movie_id)
+);
+
+create index list_items_order_idx on list_items (list_id, position);
+create index list_items_movie_id_idx on list_items (movie_id);
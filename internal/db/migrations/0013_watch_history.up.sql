@@ -0,0 +1,11 @@
+-- one row per viewing, so rewatches are counted by their earlier rows
+create table watch_history (
+    id serial primary key,
+    user_id integer not null references users (id) on delete cascade,
+    movie_id integer not null references movies (id) on delete cascade,
+    watched_on date not null,
+    created_at timestamp without time zone not null default now()
+);
+
+create index watch_history_user_watched_idx on watch_history (user_id, watched_on desc, id desc);
+create index watch_history_user_movie_idx on watch_history (user_id, movie_id, watched_on);
@@ -0,0 +1,11 @@
+-- precomputed "similar movies", each movie's best matches ranked by score
+create table movie_similar (
+    movie_id integer not null references movies (id) on delete cascade,
+    similar_id integer not null references movies (id) on delete cascade,
+    score real not null,
+    computed_at timestamp without time zone not null default now(),
+    primary key (movie_id, similar_id)
+);
+
+create index movie_similar_rank_idx on movie_similar (movie_id, score desc);
+create index movie_similar_similar_id_idx on movie_similar (similar_id);
@@ -0,0 +1,2 @@
+drop table if exists item_neighbors;
+drop table if exists movie_thumbs;
@@ -0,0 +1,21 @@
+-- thumbs up (1) or down (-1), the signal recommendations learn from
+create table movie_thumbs (
+    user_id integer not null references users (id) on delete cascade,
+    movie_id integer not null references movies (id) on delete cascade,
+    value smallint not null check (value in (-1, 1)),
+    created_at timestamp without time zone not null default now(),
+    updated_at timestamp without time zone not null default now(),
+    primary key (user_id, movie_id)
+);
+
+create index movie_thumbs_movie_id_idx on movie_thumbs (movie_id);
+
+-- item-item similarities over the thumbs, rebuilt by a batch job
+create table item_neighbors (
+    movie_id integer not null references movies (id) on delete cascade,
+    neighbor_id integer not null references movies (id) on delete cascade,
+    similarity real not null,
+    primary key (movie_id, neighbor_id)
+);
+
+create index item_neighbors_neighbor_id_idx on item_neighbors (neighbor_id);
@@ -0,0 +1,2 @@
+drop table if exists movie_trending;
+drop table if exists movie_events;
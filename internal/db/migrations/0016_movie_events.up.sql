@@ -0,0 +1,25 @@
+-- what people look at: detail views, list impressions and searches,
+-- written in batches and pruned once past the longest trending window
+create table movie_events (
+    id bigserial primary key,
+    kind text not null check (kind in ('view', 'impression', 'search')),
+    movie_id integer references movies (id) on delete cascade,
+    user_id integer references users (id) on delete set null,
+    query text,
+    occurred_at timestamp without time zone not null default now(),
+    check ((kind = 'search') = (movie_id is null))
+);
+
+create index movie_events_occurred_at_idx on movie_events (occurred_at);
+create index movie_events_movie_id_idx on movie_events (movie_id, occurred_at) where movie_id is not null;
+
+-- time-decayed trending scores per window, recomputed by a scheduled job
+create table movie_trending (
+    period text not null check (period in ('day', 'week')),
+    movie_id integer not null references movies (id) on delete cascade,
+    score real not null,
+    computed_at timestamp without time zone not null default now(),
+    primary key (period, movie_id)
+);
+
+create index movie_trending_rank_idx on movie_trending (period, score desc);
@@ -0,0 +1,11 @@
+drop index if exists people_name_key_trgm_idx;
+drop index if exists movies_title_key_trgm_idx;
+drop index if exists people_name_key_prefix_idx;
+drop index if exists movies_title_key_prefix_idx;
+
+alter table people drop column if exists name_key;
+alter table movies drop column if exists title_key;
+
+drop function if exists search_key(text);
+
+-- the extensions are left installed, since other objects may rely on them
@@ -0,0 +1,21 @@
+-- typo tolerant, accent and case insensitive autocomplete over titles and
+-- names
+create extension if not exists pg_trgm;
+create extension if not exists unaccent;
+
+-- unaccent is only stable, since its dictionary could change; naming the
+-- dictionary pins it, so the key can be stored and indexed
+create or replace function search_key(text) returns text
+    language sql immutable strict parallel safe
+    as $$ select lower(public.unaccent('public.unaccent'::regdictionary, $1)) $$;
+
+alter table movies add column title_key text generated always as (search_key(title)) stored;
+alter table people add column name_key text generated always as (search_key(name)) stored;
+
+-- prefix matches are answered from these alone, as index-only scans
+create index movies_title_key_prefix_idx on movies (title_key text_pattern_ops) include (id, title, release_date);
+create index people_name_key_prefix_idx on people (name_key text_pattern_ops) include (id, name);
+
+-- fuzzy matches, for typos and words further into the title
+create index movies_title_key_trgm_idx on movies using gin (title_key gin_trgm_ops);
+create index people_name_key_trgm_idx on people using gin (name_key gin_trgm_ops);
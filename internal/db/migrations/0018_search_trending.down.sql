@@ -0,0 +1,2 @@
+drop index if exists movie_events_search_idx;
+drop table if exists search_trending;
@@ -0,0 +1,13 @@
+-- time-decayed trending search queries per window, recomputed along with
+-- movie_trending from the search events
+create table search_trending (
+    period text not null check (period in ('day', 'week')),
+    query text not null,
+    score real not null,
+    computed_at timestamp without time zone not null default now(),
+    primary key (period, query)
+);
+
+create index search_trending_rank_idx on search_trending (period, score desc);
+
+create index movie_events_search_idx on movie_events (occurred_at) where kind = 'search';
@@ -0,0 +1,300 @@
+// Package enrich fills in movie metadata from TMDB as background jobs.
+package enrich
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/iamYole/go-movies/internal/artwork"
+	"github.com/iamYole/go-movies/internal/jobs"
+	"github.com/iamYole/go-movies/internal/models"
+	"github.com/iamYole/go-movies/internal/similar"
+	"github.com/iamYole/go-movies/internal/tmdb"
+)
+
+const (
+	// JobKind is the job kind handled by Enricher.Handle
+	JobKind = "enrich_movie"
+	// ResyncJobKind is the job kind handled by Enricher.HandleResync
+	ResyncJobKind = "resync_movies"
+)
+
+// Payload is the job payload. TitleChanged makes the enricher search TMDB
+// again instead of trusting the movie's stored tmdb id, which may belong to
+// the old title.
+type Payload struct {
+	MovieID      int  `json:"movie_id"`
+	TitleChanged bool `json:"title_changed,omitempty"`
+}
+
+// Movies is the part of the movie repository the enricher needs
+type Movies interface {
+	EditMovie(context.Context, int64) (*models.Movie, []*models.Genre, error)
+	PatchMovie(context.Context, models.Movie, []string) (int, int, error)
+	GetAllGenres(context.Context) ([]*models.Genre, error)
+	SetExternalID(ctx context.Context, movieID int, source, externalID string) error
+	StaleMovies(ctx context.Context, before time.Time, limit int) ([]int, error)
+	MarkMovieSynced(ctx context.Context, movieID int, at time.Time) error
+}
+
+type Enricher struct {
+	Movies Movies
+	TMDB   *tmdb.Client
+	Jobs   jobs.Store
+
+	// MaxAge is how long a sync stays fresh before a resync picks the movie up
+	MaxAge time.Duration
+	// ResyncBatch caps how many movies one resync queues
+	ResyncBatch int
+	// DownloadArtwork queues a download of TMDB posters and backdrops into
+	// the image store whenever they change
+	DownloadArtwork bool
+}
+
+// Enqueue queues enrichment of a movie. Jobs are keyed by movie, so a burst
+// of edits still leads to a single lookup.
+func Enqueue(ctx context.Context, store jobs.Store, movieID int, titleChanged bool) error {
+	key := "movie:" + strconv.Itoa(movieID)
+	return jobs.Enqueue(ctx, store, JobKind, key, Payload{MovieID: movieID, TitleChanged: titleChanged})
+}
+
+// EnqueueMany queues enrichment of newly created movies in one go
+func EnqueueMany(ctx context.Context, store jobs.Store, movieIDs []int) error {
+	batch := make([]models.Job, 0, len(movieIDs))
+	for _, id := range movieIDs {
+		payload, err := json.Marshal(Payload{MovieID: id})
+		if err != nil {
+			return err
+		}
+		batch = append(batch, models.Job{Kind: JobKind, Key: "movie:" + strconv.Itoa(id), Payload: payload})
+	}
+	return store.EnqueueJobs(ctx, batch)
+}
+
+// Handle is the jobs.Handler for JobKind
+func (e *Enricher) Handle(ctx context.Context, job *models.Job) error {
+	var p Payload
+	if err := json.Unmarshal(job.Payload, &p); err != nil {
+		return jobs.Permanent(fmt.Errorf("decoding payload: %w", err))
+	}
+
+	err := e.EnrichMovie(ctx, p.MovieID, p.TitleChanged)
+	switch {
+	case errors.Is(err, models.ErrNotFound):
+		//deleted since it was queued
+		return nil
+	case errors.Is(err, tmdb.ErrNotConfigured), errors.Is(err, tmdb.ErrUnauthorized):
+		return jobs.Permanent(err)
+	}
+	return err
+}
+
+// HandleResync is the jobs.Handler for ResyncJobKind. It queues enrichment
+// of the movies synced longest ago; the batch keeps each run, and the load
+// it puts on TMDB, bounded.
+func (e *Enricher) HandleResync(ctx context.Context, job *models.Job) error {
+	maxAge, batch := e.MaxAge, e.ResyncBatch
+	if maxAge <= 0 {
+		maxAge = 30 * 24 * time.Hour
+	}
+	if batch <= 0 {
+		batch = 500
+	}
+
+	ids, err := e.Movies.StaleMovies(ctx, time.Now().Add(-maxAge), batch)
+	if err != nil {
+		return err
+	}
+	if len(ids) > 0 {
+		log.Printf("enrich: resyncing %d movies", len(ids))
+	}
+	return EnqueueMany(ctx, e.Jobs, ids)
+}
+
+// EnrichMovie syncs a movie with its TMDB match. Every synced field TMDB
+// has a value for is written unless an editor has locked it, so editors'
+// changes survive while everything else tracks TMDB.
+func (e *Enricher) EnrichMovie(ctx context.Context, movieID int, titleChanged bool) error {
+	movie, _, err := e.Movies.EditMovie(ctx, int64(movieID))
+	if err != nil {
+		return err
+	}
+
+	details, err := e.match(ctx, movie, titleChanged)
+	if errors.Is(err, tmdb.ErrNotFound) {
+		log.Printf("enrich: no tmdb match for movie %d %q", movie.ID, movie.Title)
+		return e.Movies.MarkMovieSynced(ctx, movie.ID, time.Now())
+	}
+	if err != nil {
+		return err
+	}
+
+	var fields []string
+	set := func(field string, dst *string, value string) {
+		if value != "" && value != *dst && !movie.IsLocked(field) {
+			*dst = value
+			fields = append(fields, field)
+		}
+	}
+	set("description", &movie.Description, details.Overview)
+	set("image", &movie.Image, details.PosterPath)
+	set("backdrop", &movie.Backdrop, details.BackdropPath)
+	set("original_language", &movie.OriginalLanguage, details.OriginalLanguage)
+	set("tagline", &movie.Tagline, details.Tagline)
+
+	if details.Runtime > 0 && details.Runtime != movie.Runtime && !movie.IsLocked("runtime") {
+		movie.Runtime = details.Runtime
+		fields = append(fields, "runtime")
+	}
+
+	if details.ReleaseDate != movie.ReleaseDate.Format(time.DateOnly) && !movie.IsLocked("release_date") {
+		if released, err := time.Parse(time.DateOnly, details.ReleaseDate); err == nil {
+			movie.ReleaseDate = released
+			fields = append(fields, "release_date")
+		}
+	}
+
+	if !movie.IsLocked("genres_array") {
+		changed, err := e.syncGenres(ctx, movie, details.Genres)
+		if err != nil {
+			return err
+		}
+		if changed {
+			fields = append(fields, "genres_array")
+		}
+	}
+
+	if len(fields) > 0 {
+		//written at the version read above, so an edit made while TMDB was
+		//being asked wins and this job retries against the new state
+		if _, _, err := e.Movies.PatchMovie(ctx, *movie, fields); err != nil {
+			return err
+		}
+		if slices.Contains(fields, "genres_array") || slices.Contains(fields, "release_date") {
+			if err := similar.Enqueue(ctx, e.Jobs, movie.ID); err != nil {
+				return err
+			}
+		}
+	}
+
+	if e.DownloadArtwork {
+		if err := e.queueArtwork(ctx, movie, fields); err != nil {
+			return err
+		}
+	}
+
+	if movie.ExternalIDs["tmdb"] != strconv.Itoa(details.ID) {
+		if err := e.Movies.SetExternalID(ctx, movie.ID, "tmdb", strconv.Itoa(details.ID)); err != nil {
+			return err
+		}
+	}
+	return e.Movies.MarkMovieSynced(ctx, movie.ID, time.Now())
+}
+
+// queueArtwork queues downloads of the TMDB artwork that changed, or that
+// has never been downloaded
+func (e *Enricher) queueArtwork(ctx context.Context, movie *models.Movie, fields []string) error {
+	kinds := []struct {
+		kind, field, path string
+		stored            *int64
+	}{
+		{models.ImagePoster, "image", movie.Image, movie.PosterImageID},
+		{models.ImageBackdrop, "backdrop", movie.Backdrop, movie.BackdropImageID},
+	}
+	for _, k := range kinds {
+		if k.path == "" || (k.stored != nil && !slices.Contains(fields, k.field)) {
+			continue
+		}
+		if err := artwork.Enqueue(ctx, e.Jobs, movie.ID, k.kind); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// match finds the TMDB record for a movie, trusting stored ids over a search
+func (e *Enricher) match(ctx context.Context, movie *models.Movie, titleChanged bool) (*tmdb.MovieDetails, error) {
+	if !titleChanged {
+		if id, err := strconv.Atoi(movie.ExternalIDs["tmdb"]); err == nil {
+			return e.TMDB.GetMovie(ctx, id)
+		}
+	}
+
+	if imdbID := movie.ExternalIDs["imdb"]; imdbID != "" {
+		found, err := e.TMDB.FindByIMDbID(ctx, imdbID)
+		if err == nil {
+			return e.TMDB.GetMovie(ctx, found.ID)
+		}
+		if !errors.Is(err, tmdb.ErrNotFound) {
+			return nil, err
+		}
+	}
+
+	found, err := e.TMDB.FindMovie(ctx, movie.Title, movie.ReleaseDate.Year())
+	if err != nil {
+		return nil, err
+	}
+	return e.TMDB.GetMovie(ctx, found.ID)
+}
+
+// syncGenres replaces the TMDB mapped genres of a movie with TMDB's list,
+// keeping any local genres TMDB has no equivalent for
+func (e *Enricher) syncGenres(ctx context.Context, movie *models.Movie, tmdbGenres []tmdb.Genre) (bool, error) {
+	if len(tmdbGenres) == 0 {
+		return false, nil
+	}
+
+	all, err := e.Movies.GetAllGenres(ctx)
+	if err != nil {
+		return false, err
+	}
+	byTMDB := map[int]int{}
+	mapped := map[int]bool{}
+	for _, g := range all {
+		if g.TMDBID != nil {
+			byTMDB[*g.TMDBID] = g.ID
+			mapped[g.ID] = true
+		}
+	}
+
+	var genres []int
+	for _, id := range movie.GenresArray {
+		if !mapped[id] {
+			genres = append(genres, id)
+		}
+	}
+	for _, g := range tmdbGenres {
+		if id, ok := byTMDB[g.ID]; ok {
+			genres = append(genres, id)
+		}
+	}
+
+	if sameIDs(genres, movie.GenresArray) {
+		return false, nil
+	}
+	movie.GenresArray = genres
+	return true, nil
+}
+
+func sameIDs(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	seen := map[int]int{}
+	for _, id := range a {
+		seen[id]++
+	}
+	for _, id := range b {
+		seen[id]--
+		if seen[id] < 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,116 @@
+// Package events captures what visitors look at without slowing them down:
+// events are buffered in memory and written to Postgres in batches, and a
+// scheduled job turns them into trending scores.
+package events
+
+import (
+	"context"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/iamYole/go-movies/internal/models"
+)
+
+// Store is the part of the event repository the recorder needs
+type Store interface {
+	InsertEvents(context.Context, []models.Event) error
+}
+
+type Options struct {
+	// Buffer is how many events wait in memory; more are dropped
+	Buffer int
+	// Batch is how many events are written at once
+	Batch int
+	// Flush is the longest an event waits before being written
+	Flush time.Duration
+}
+
+// Recorder buffers events and writes them in batches. Recording never
+// blocks: when writes fall behind and the buffer fills, events are dropped
+// and counted, since losing a few views is better than slow responses.
+type Recorder struct {
+	store   Store
+	opts    Options
+	events  chan models.Event
+	dropped atomic.Int64
+}
+
+func NewRecorder(store Store, opts Options) *Recorder {
+	if opts.Buffer <= 0 {
+		opts.Buffer = 10000
+	}
+	if opts.Batch <= 0 {
+		opts.Batch = 500
+	}
+	if opts.Flush <= 0 {
+		opts.Flush = 5 * time.Second
+	}
+	return &Recorder{store: store, opts: opts, events: make(chan models.Event, opts.Buffer)}
+}
+
+// Record queues an event for the next batch
+func (r *Recorder) Record(e models.Event) {
+	if e.OccurredAt.IsZero() {
+		e.OccurredAt = time.Now()
+	}
+	select {
+	case r.events <- e:
+	default:
+		r.dropped.Add(1)
+	}
+}
+
+// Run writes batches until ctx is cancelled, then writes what is left.
+// Cancel it once the server has shut down, so the events of the last
+// requests are kept.
+func (r *Recorder) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.opts.Flush)
+	defer ticker.Stop()
+
+	batch := make([]models.Event, 0, r.opts.Batch)
+	for {
+		select {
+		case e := <-r.events:
+			batch = append(batch, e)
+			if len(batch) >= r.opts.Batch {
+				batch = r.write(batch)
+			}
+		case <-ticker.C:
+			batch = r.write(batch)
+		case <-ctx.Done():
+			for {
+				select {
+				case e := <-r.events:
+					batch = append(batch, e)
+					if len(batch) >= r.opts.Batch {
+						batch = r.write(batch)
+					}
+				default:
+					r.write(batch)
+					return
+				}
+			}
+		}
+	}
+}
+
+// write stores a batch and returns it emptied. A failed batch is logged
+// and dropped rather than retried, so a database outage cannot back the
+// buffer up indefinitely.
+func (r *Recorder) write(batch []models.Event) []models.Event {
+	if n := r.dropped.Swap(0); n > 0 {
+		log.Printf("events: buffer full, dropped %d events", n)
+	}
+	if len(batch) == 0 {
+		return batch
+	}
+
+	//not tied to Run's context, which is done by the final write
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := r.store.InsertEvents(ctx, batch); err != nil {
+		log.Printf("events: writing %d events: %v", len(batch), err)
+	}
+	return batch[:0]
+}
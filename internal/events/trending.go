@@ -0,0 +1,71 @@
+package events
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/iamYole/go-movies/internal/models"
+)
+
+// JobKind is the job kind handled by Trending.Handle
+const JobKind = "compute_trending"
+
+// TrendingStore is the part of the event repository the trending job needs
+type TrendingStore interface {
+	RefreshTrending(ctx context.Context, period string, window, halfLife time.Duration, w models.TrendingWeights) error
+	PruneEvents(ctx context.Context, cutoff time.Time) (int64, error)
+}
+
+// Window is a trending period: the events it covers and how quickly they
+// fade within it
+type Window struct {
+	Period   string
+	Length   time.Duration
+	HalfLife time.Duration
+}
+
+// Windows are the trending periods served. A view counts half after a
+// quarter of the day window and after two days of the week window.
+var Windows = []Window{
+	{Period: models.TrendingDay, Length: 24 * time.Hour, HalfLife: 6 * time.Hour},
+	{Period: models.TrendingWeek, Length: 7 * 24 * time.Hour, HalfLife: 48 * time.Hour},
+}
+
+// DefaultWeights count a detail view ten times a list impression
+var DefaultWeights = models.TrendingWeights{View: 1, Impression: 0.1}
+
+type Trending struct {
+	Store   TrendingStore
+	Weights models.TrendingWeights
+
+	// Retention is how long events are kept, at least the longest window
+	Retention time.Duration
+}
+
+// Handle is the jobs.Handler for JobKind, which recomputes every window's
+// scores and prunes events too old to count
+func (t *Trending) Handle(ctx context.Context, job *models.Job) error {
+	weights := t.Weights
+	if weights == (models.TrendingWeights{}) {
+		weights = DefaultWeights
+	}
+
+	var longest time.Duration
+	for _, w := range Windows {
+		if err := t.Store.RefreshTrending(ctx, w.Period, w.Length, w.HalfLife, weights); err != nil {
+			return fmt.Errorf("%s window: %w", w.Period, err)
+		}
+		longest = max(longest, w.Length)
+	}
+
+	n, err := t.Store.PruneEvents(ctx, time.Now().Add(-max(t.Retention, longest)))
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		log.Printf("events: pruned %d events", n)
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+// Package imaging validates uploaded artwork and renders its resized
+// variants with the standard library alone.
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+	"net/http"
+)
+
+var ErrUnsupported = errors.New("image must be a jpeg, png or gif")
+
+// MaxPixels bounds decoded images, so a small file claiming huge dimensions
+// cannot exhaust memory
+const MaxPixels = 40_000_000
+
+// Source is a decoded original
+type Source struct {
+	Image       image.Image
+	ContentType string
+	Width       int
+	Height      int
+}
+
+// Decode sniffs and decodes data, checking its dimensions before the pixels
+func Decode(data []byte) (*Source, error) {
+	contentType := http.DetectContentType(data)
+	switch contentType {
+	case "image/jpeg", "image/png", "image/gif":
+	default:
+		return nil, ErrUnsupported
+	}
+
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrUnsupported
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || cfg.Width*cfg.Height > MaxPixels {
+		return nil, errors.New("image dimensions are out of range")
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrUnsupported
+	}
+	return &Source{Image: img, ContentType: contentType, Width: cfg.Width, Height: cfg.Height}, nil
+}
+
+// JPEG renders src at most width pixels wide as a JPEG. Images are never
+// scaled up, and transparency is flattened onto white.
+func JPEG(src *Source, width int) ([]byte, error) {
+	img := src.Image
+	if width > 0 && width < src.Width {
+		height := max(1, src.Height*width/src.Width)
+		img = resize(img, width, height)
+	}
+
+	bounds := img.Bounds()
+	flat := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(flat, flat.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.Draw(flat, flat.Bounds(), img, bounds.Min, draw.Over)
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, flat, &jpeg.Options{Quality: 85}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// resize scales src down to w by h by averaging the source pixels that
+// fall in each destination pixel, which avoids the aliasing of nearest
+// neighbour sampling at the large reductions posters need
+func resize(src image.Image, w, h int) *image.NRGBA {
+	sb := src.Bounds()
+	sw, sh := sb.Dx(), sb.Dy()
+	dst := image.NewNRGBA(image.Rect(0, 0, w, h))
+
+	for y := 0; y < h; y++ {
+		y0 := sb.Min.Y + y*sh/h
+		y1 := max(y0+1, sb.Min.Y+(y+1)*sh/h)
+		for x := 0; x < w; x++ {
+			x0 := sb.Min.X + x*sw/w
+			x1 := max(x0+1, sb.Min.X+(x+1)*sw/w)
+
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					c := color.NRGBA64Model.Convert(src.At(sx, sy)).(color.NRGBA64)
+					r += uint64(c.R)
+					g += uint64(c.G)
+					b += uint64(c.B)
+					a += uint64(c.A)
+					n++
+				}
+			}
+
+			dst.SetNRGBA(x, y, color.NRGBA{
+				R: uint8(r / n >> 8),
+				G: uint8(g / n >> 8),
+				B: uint8(b / n >> 8),
+				A: uint8(a / n >> 8),
+			})
+		}
+	}
+	return dst
+}
@@ -0,0 +1,139 @@
+// Package imdb reads the IMDb non-commercial TSV datasets
+// (https://developer.imdb.com/non-commercial-datasets/) one line at a time,
+// so multi-gigabyte files never have to fit in memory.
+package imdb
+
+import (
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// null is how the datasets write a missing value
+const null = `\N`
+
+// Title is a row of title.basics.tsv
+type Title struct {
+	TConst         string
+	TitleType      string
+	PrimaryTitle   string
+	OriginalTitle  string
+	IsAdult        bool
+	StartYear      int
+	RuntimeMinutes int
+	Genres         []string
+}
+
+// Rating is a row of title.ratings.tsv
+type Rating struct {
+	AverageRating float64
+	NumVotes      int
+}
+
+type gzipFile struct {
+	*gzip.Reader
+	f *os.File
+}
+
+func (g gzipFile) Close() error {
+	g.Reader.Close()
+	return g.f.Close()
+}
+
+// Open opens a dataset file, decompressing it on the fly when it ends in .gz
+func Open(path string) (io.ReadCloser, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasSuffix(path, ".gz") {
+		return f, nil
+	}
+
+	zr, err := gzip.NewReader(bufio.NewReaderSize(f, 1<<20))
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return gzipFile{Reader: zr, f: f}, nil
+}
+
+// ReadBasics calls fn for every row of title.basics.tsv. Returning ErrStop
+// from fn ends the scan early without an error.
+func ReadBasics(r io.Reader, fn func(Title) error) error {
+	return readTSV(r, []string{"tconst", "titleType", "primaryTitle", "originalTitle",
+		"isAdult", "startYear", "endYear", "runtimeMinutes", "genres"}, func(cols []string) error {
+		t := Title{
+			TConst:         cols[0],
+			TitleType:      cols[1],
+			PrimaryTitle:   cols[2],
+			OriginalTitle:  cols[3],
+			IsAdult:        cols[4] == "1",
+			StartYear:      atoi(cols[5]),
+			RuntimeMinutes: atoi(cols[7]),
+		}
+		if cols[8] != null {
+			t.Genres = strings.Split(cols[8], ",")
+		}
+		return fn(t)
+	})
+}
+
+// ReadRatings loads title.ratings.tsv into a map keyed by tconst. The file
+// is a few tens of megabytes, small enough to hold while basics stream past.
+func ReadRatings(r io.Reader) (map[string]Rating, error) {
+	ratings := map[string]Rating{}
+	err := readTSV(r, []string{"tconst", "averageRating", "numVotes"}, func(cols []string) error {
+		avg, _ := strconv.ParseFloat(cols[1], 64)
+		ratings[cols[0]] = Rating{AverageRating: avg, NumVotes: atoi(cols[2])}
+		return nil
+	})
+	return ratings, err
+}
+
+// ErrStop ends ReadBasics early
+var ErrStop = errors.New("stop reading")
+
+// readTSV checks the header and hands each data row to fn. The datasets do
+// not quote fields, so lines are split on tabs rather than read as CSV.
+func readTSV(r io.Reader, header []string, fn func([]string) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+
+	if !scanner.Scan() {
+		if err := scanner.Err(); err != nil {
+			return err
+		}
+		return errors.New("dataset is empty")
+	}
+	if got := strings.Split(scanner.Text(), "\t"); strings.Join(got, ",") != strings.Join(header, ",") {
+		return fmt.Errorf("unexpected dataset header %q", scanner.Text())
+	}
+
+	for line := 2; scanner.Scan(); line++ {
+		cols := strings.Split(scanner.Text(), "\t")
+		if len(cols) != len(header) {
+			return fmt.Errorf("line %d: expected %d columns, got %d", line, len(header), len(cols))
+		}
+		if err := fn(cols); err != nil {
+			if errors.Is(err, ErrStop) {
+				return nil
+			}
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+func atoi(s string) int {
+	if s == null {
+		return 0
+	}
+	n, _ := strconv.Atoi(s)
+	return n
+}
@@ -0,0 +1,238 @@
+// Package importer reads movie catalogs from CSV and NDJSON uploads.
+package importer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/iamYole/go-movies/internal/models"
+)
+
+const (
+	FormatCSV    = "csv"
+	FormatNDJSON = "ndjson"
+)
+
+var ErrUnknownFormat = errors.New("unknown import format")
+
+// Row is one parsed line of an upload. Err is set when the line could not be
+// read into a movie at all; rule checks are left to the caller.
+type Row struct {
+	Line  int
+	Movie models.ImportMovie
+	Err   error
+}
+
+// FormatFor picks an import format from a media type or file name
+func FormatFor(mediaType, filename string) string {
+	switch {
+	case mediaType == "text/csv", strings.HasSuffix(strings.ToLower(filename), ".csv"):
+		return FormatCSV
+	case mediaType == "application/x-ndjson", mediaType == "application/jsonl",
+		strings.HasSuffix(strings.ToLower(filename), ".ndjson"), strings.HasSuffix(strings.ToLower(filename), ".jsonl"):
+		return FormatNDJSON
+	}
+	return ""
+}
+
+// Parse reads every row of r in the given format
+func Parse(r io.Reader, format string) ([]Row, error) {
+	switch format {
+	case FormatCSV:
+		return parseCSV(r)
+	case FormatNDJSON:
+		return parseNDJSON(r)
+	}
+	return nil, ErrUnknownFormat
+}
+
+var csvColumns = []string{"title", "release_date", "runtime", "mpaa_rating", "description", "genres"}
+
+// parseCSV expects a header row naming the columns in any order. Genres are
+// separated by "|" and optional <source>_id columns such as imdb_id carry
+// external ids.
+func parseCSV(r io.Reader) ([]Row, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("reading csv header: %w", err)
+	}
+
+	index := map[string]int{}
+	for i, name := range header {
+		index[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, col := range csvColumns[:4] {
+		if _, ok := index[col]; !ok {
+			return nil, fmt.Errorf("csv header is missing the %s column", col)
+		}
+	}
+
+	var rows []Row
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) {
+				rows = append(rows, Row{Line: line, Err: err})
+				continue
+			}
+			return nil, err
+		}
+
+		field := func(name string) string {
+			i, ok := index[name]
+			if !ok || i >= len(record) {
+				return ""
+			}
+			return strings.TrimSpace(record[i])
+		}
+
+		row := Row{Line: line}
+		row.Movie, row.Err = buildMovie(field("title"), field("release_date"), field("runtime"),
+			field("mpaa_rating"), field("description"), splitGenres(field("genres")))
+		for _, source := range models.ExternalSources {
+			if id := field(source + "_id"); id != "" {
+				if row.Movie.ExternalIDs == nil {
+					row.Movie.ExternalIDs = map[string]string{}
+				}
+				row.Movie.ExternalIDs[source] = id
+			}
+		}
+		rows = append(rows, row)
+	}
+
+	return rows, nil
+}
+
+type ndjsonRow struct {
+	Title       string            `json:"title"`
+	ReleaseDate string            `json:"release_date"`
+	Runtime     json.Number       `json:"runtime"`
+	MPAARating  string            `json:"mpaa_rating"`
+	Description string            `json:"description"`
+	Genres      json.RawMessage   `json:"genres"`
+	ExternalIDs map[string]string `json:"external_ids"`
+}
+
+// parseNDJSON reads one JSON object per line. Genres may be an array of
+// names or a "|" separated string, matching the CSV column.
+func parseNDJSON(r io.Reader) ([]Row, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	var rows []Row
+	for line := 1; scanner.Scan(); line++ {
+		text := bytes.TrimSpace(scanner.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+
+		row := Row{Line: line}
+
+		var in ndjsonRow
+		decode := json.NewDecoder(bytes.NewReader(text))
+		decode.DisallowUnknownFields()
+		if err := decode.Decode(&in); err != nil {
+			row.Err = err
+			rows = append(rows, row)
+			continue
+		}
+
+		genres, err := decodeGenres(in.Genres)
+		if err != nil {
+			row.Err = err
+			rows = append(rows, row)
+			continue
+		}
+
+		row.Movie, row.Err = buildMovie(in.Title, in.ReleaseDate, in.Runtime.String(),
+			in.MPAARating, in.Description, genres)
+		for source := range in.ExternalIDs {
+			if !models.IsExternalSource(source) {
+				row.Err = fmt.Errorf("unknown external id source %q", source)
+			}
+		}
+		row.Movie.ExternalIDs = in.ExternalIDs
+		rows = append(rows, row)
+	}
+
+	return rows, scanner.Err()
+}
+
+func decodeGenres(raw json.RawMessage) ([]string, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+
+	var names []string
+	if err := json.Unmarshal(raw, &names); err == nil {
+		return names, nil
+	}
+
+	var joined string
+	if err := json.Unmarshal(raw, &joined); err != nil {
+		return nil, errors.New("genres must be a list of names")
+	}
+	return splitGenres(joined), nil
+}
+
+func splitGenres(s string) []string {
+	var genres []string
+	for _, g := range strings.Split(s, "|") {
+		if g = strings.TrimSpace(g); g != "" {
+			genres = append(genres, g)
+		}
+	}
+	return genres
+}
+
+func buildMovie(title, releaseDate, runtime, rating, description string, genres []string) (models.ImportMovie, error) {
+	movie := models.ImportMovie{
+		Movie: models.Movie{
+			Title:       title,
+			MPAARating:  strings.ToUpper(rating),
+			Description: description,
+		},
+		Genres: genres,
+	}
+
+	if releaseDate != "" {
+		date, err := parseDate(releaseDate)
+		if err != nil {
+			return movie, fmt.Errorf("release_date %q is not a date", releaseDate)
+		}
+		movie.Movie.ReleaseDate = date
+	}
+
+	if runtime != "" {
+		minutes, err := strconv.Atoi(runtime)
+		if err != nil {
+			return movie, fmt.Errorf("runtime %q is not a whole number of minutes", runtime)
+		}
+		movie.Movie.Runtime = minutes
+	}
+
+	return movie, nil
+}
+
+func parseDate(s string) (time.Time, error) {
+	if t, err := time.Parse(time.DateOnly, s); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
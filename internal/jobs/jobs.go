@@ -0,0 +1,268 @@
+// Package jobs runs background work queued in the jobs table. Workers claim
+// jobs with FOR UPDATE SKIP LOCKED, so any number of them, across any number
+// of processes, can share the queue without handing out a job twice.
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/iamYole/go-movies/internal/models"
+)
+
+// Store is the part of the job repository the runner needs
+type Store interface {
+	EnqueueJob(context.Context, models.Job) (int64, error)
+	EnqueueJobs(context.Context, []models.Job) error
+	ClaimJob(ctx context.Context, kinds []string, worker string, lease time.Duration) (*models.Job, error)
+	CompleteJob(ctx context.Context, id int64, worker string) error
+	FailJob(ctx context.Context, id int64, worker string, message string, retryAt time.Time, dead bool) error
+	PruneJobs(context.Context, time.Time) (int64, error)
+}
+
+// Handler does the work of one job. Returning an error schedules a retry
+// unless the error is Permanent or the job is out of attempts.
+type Handler func(ctx context.Context, job *models.Job) error
+
+type permanentError struct {
+	err error
+}
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+// Permanent marks err as one retrying cannot fix, sending the job straight
+// to the dead letter state
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return permanentError{err}
+}
+
+// Enqueue queues a job of kind with payload encoded as JSON. Jobs sharing a
+// non empty key collapse into one while pending.
+func Enqueue(ctx context.Context, store Store, kind, key string, payload any) error {
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	_, err = store.EnqueueJob(ctx, models.Job{Kind: kind, Key: key, Payload: raw})
+	return err
+}
+
+type Options struct {
+	Workers int
+	// Poll is how long an idle worker waits before looking again
+	Poll time.Duration
+	// Timeout bounds a single run of a job
+	Timeout time.Duration
+	// Retention is how long finished jobs are kept
+	Retention time.Duration
+}
+
+type Runner struct {
+	store     Store
+	opts      Options
+	worker    string
+	handlers  map[string]Handler
+	schedules map[string]time.Duration
+}
+
+func NewRunner(store Store, opts Options) *Runner {
+	if opts.Workers <= 0 {
+		opts.Workers = 2
+	}
+	if opts.Poll <= 0 {
+		opts.Poll = 2 * time.Second
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 2 * time.Minute
+	}
+	if opts.Retention <= 0 {
+		opts.Retention = 7 * 24 * time.Hour
+	}
+
+	host, _ := os.Hostname()
+	return &Runner{
+		store:     store,
+		opts:      opts,
+		worker:    fmt.Sprintf("%s:%d", host, os.Getpid()),
+		handlers:  map[string]Handler{},
+		schedules: map[string]time.Duration{},
+	}
+}
+
+// Handle registers h for jobs of kind. It must be called before Run.
+func (r *Runner) Handle(kind string, h Handler) {
+	r.handlers[kind] = h
+}
+
+// Schedule queues a job of kind when Run starts and then every interval.
+// The job is keyed by its kind, so instances sharing the queue collapse
+// their ticks into a single pending job. It must be called before Run.
+func (r *Runner) Schedule(kind string, every time.Duration) {
+	r.schedules[kind] = every
+}
+
+// Run works the queue until ctx is cancelled, then waits for jobs in flight
+// to finish
+func (r *Runner) Run(ctx context.Context) {
+	kinds := make([]string, 0, len(r.handlers))
+	for kind := range r.handlers {
+		kinds = append(kinds, kind)
+	}
+	if len(kinds) == 0 {
+		return
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < r.opts.Workers; i++ {
+		wg.Add(1)
+		go func(n int) {
+			defer wg.Done()
+			r.work(ctx, kinds, fmt.Sprintf("%s/%d", r.worker, n))
+		}(i)
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		r.prune(ctx)
+	}()
+
+	for kind, every := range r.schedules {
+		wg.Add(1)
+		go func(kind string, every time.Duration) {
+			defer wg.Done()
+			r.tick(ctx, kind, every)
+		}(kind, every)
+	}
+
+	wg.Wait()
+}
+
+func (r *Runner) work(ctx context.Context, kinds []string, worker string) {
+	for {
+		//a lease well past the run timeout so live jobs are never stolen
+		job, err := r.store.ClaimJob(ctx, kinds, worker, 2*r.opts.Timeout)
+		if err != nil && ctx.Err() == nil {
+			log.Println("jobs: claim:", err)
+		}
+
+		if job == nil {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(r.opts.Poll):
+			}
+			continue
+		}
+
+		r.run(job)
+	}
+}
+
+// run executes job outside of the runner's context, so shutting down lets
+// the job finish and record its result rather than abandoning it
+func (r *Runner) run(job *models.Job) {
+	ctx, cancel := context.WithTimeout(context.Background(), r.opts.Timeout)
+	defer cancel()
+
+	err := r.call(ctx, job)
+	if err == nil {
+		if err := r.store.CompleteJob(ctx, job.ID, job.LockedBy); err != nil {
+			logOutcome("completing", job, err)
+		}
+		return
+	}
+
+	var permanent permanentError
+	dead := errors.As(err, &permanent) || job.Attempts >= job.MaxAttempts
+	retryAt := time.Now().Add(backoff(job.Attempts))
+	if dead {
+		log.Printf("jobs: %s %d failed for good after %d attempts: %v", job.Kind, job.ID, job.Attempts, err)
+	}
+
+	if err := r.store.FailJob(ctx, job.ID, job.LockedBy, err.Error(), retryAt, dead); err != nil {
+		logOutcome("failing", job, err)
+	}
+}
+
+// logOutcome reports a job result that could not be saved. A lost lease
+// means the job ran past it and another worker has taken it over, so the
+// result is dropped in favour of that run.
+func logOutcome(action string, job *models.Job, err error) {
+	if errors.Is(err, models.ErrLeaseLost) {
+		log.Printf("jobs: %s %d: lease lost to another worker, result dropped", action, job.ID)
+		return
+	}
+	log.Printf("jobs: %s %d: %v", action, job.ID, err)
+}
+
+func (r *Runner) call(ctx context.Context, job *models.Job) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = Permanent(fmt.Errorf("panic: %v", p))
+		}
+	}()
+	return r.handlers[job.Kind](ctx, job)
+}
+
+// backoff doubles from 30s up to an hour, with jitter so failures caused
+// by the same outage do not all retry at once
+func backoff(attempt int) time.Duration {
+	if attempt < 1 {
+		attempt = 1
+	}
+	d := 30 * time.Second << (attempt - 1)
+	if d > time.Hour || d <= 0 {
+		d = time.Hour
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+func (r *Runner) tick(ctx context.Context, kind string, every time.Duration) {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+
+	for {
+		if err := Enqueue(ctx, r.store, kind, kind, struct{}{}); err != nil && ctx.Err() == nil {
+			log.Printf("jobs: scheduling %s: %v", kind, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (r *Runner) prune(ctx context.Context) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for {
+		n, err := r.store.PruneJobs(ctx, time.Now().Add(-r.opts.Retention))
+		switch {
+		case err != nil && ctx.Err() == nil:
+			log.Println("jobs: prune:", err)
+		case n > 0:
+			log.Printf("jobs: pruned %d finished jobs", n)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package jsonpatch
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// jsonEqual compares two documents by value, so key order does not matter
+func jsonEqual(t *testing.T, got []byte, want string) bool {
+	t.Helper()
+	var g, w any
+	if err := json.Unmarshal(got, &g); err != nil {
+		t.Fatalf("result %s: %v", got, err)
+	}
+	if err := json.Unmarshal([]byte(want), &w); err != nil {
+		t.Fatalf("want %s: %v", want, err)
+	}
+	return reflect.DeepEqual(g, w)
+}
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		name  string
+		doc   string
+		patch string
+		want  string
+	}{
+		{"add member", `{"a": 1}`, `[{"op": "add", "path": "/b", "value": 2}]`, `{"a": 1, "b": 2}`},
+		{"add replaces member", `{"a": 1}`, `[{"op": "add", "path": "/a", "value": [1]}]`, `{"a": [1]}`},
+		{"add null", `{}`, `[{"op": "add", "path": "/a", "value": null}]`, `{"a": null}`},
+		{"add nested", `{"a": {"b": {}}}`, `[{"op": "add", "path": "/a/b/c", "value": true}]`, `{"a": {"b": {"c": true}}}`},
+		{"add inserts into array", `{"a": [1, 3]}`, `[{"op": "add", "path": "/a/1", "value": 2}]`, `{"a": [1, 2, 3]}`},
+		{"add at array length", `{"a": [1]}`, `[{"op": "add", "path": "/a/1", "value": 2}]`, `{"a": [1, 2]}`},
+		{"add appends with dash", `{"a": [1, 2]}`, `[{"op": "add", "path": "/a/-", "value": 3}]`, `{"a": [1, 2, 3]}`},
+		{"add dash to empty array", `{"a": []}`, `[{"op": "add", "path": "/a/-", "value": 1}]`, `{"a": [1]}`},
+		{"add replaces root", `{"a": 1}`, `[{"op": "add", "path": "", "value": [1]}]`, `[1]`},
+		{"remove member", `{"a": 1, "b": 2}`, `[{"op": "remove", "path": "/a"}]`, `{"b": 2}`},
+		{"remove array element", `{"a": [1, 2, 3]}`, `[{"op": "remove", "path": "/a/1"}]`, `{"a": [1, 3]}`},
+		{"replace member", `{"a": 1}`, `[{"op": "replace", "path": "/a", "value": "x"}]`, `{"a": "x"}`},
+		{"replace array element", `{"a": [1, 2]}`, `[{"op": "replace", "path": "/a/0", "value": 9}]`, `{"a": [9, 2]}`},
+		{"move member", `{"a": {"b": 1}, "c": {}}`, `[{"op": "move", "from": "/a/b", "path": "/c/d"}]`, `{"a": {}, "c": {"d": 1}}`},
+		{"move array element", `{"a": [1, 2, 3]}`, `[{"op": "move", "from": "/a/0", "path": "/a/-"}]`, `{"a": [2, 3, 1]}`},
+		{"move onto itself", `{"a": 1}`, `[{"op": "move", "from": "/a", "path": "/a"}]`, `{"a": 1}`},
+		{"copy member", `{"a": {"b": 1}}`, `[{"op": "copy", "from": "/a", "path": "/c"}]`, `{"a": {"b": 1}, "c": {"b": 1}}`},
+		{"copy is deep", `{"a": {"b": 1}}`,
+			`[{"op": "copy", "from": "/a", "path": "/c"}, {"op": "replace", "path": "/c/b", "value": 2}]`,
+			`{"a": {"b": 1}, "c": {"b": 2}}`},
+		{"test passes", `{"a": [1, {"b": "x"}]}`, `[{"op": "test", "path": "/a", "value": [1, {"b": "x"}]}]`, `{"a": [1, {"b": "x"}]}`},
+		{"test number", `{"a": 1}`, `[{"op": "test", "path": "/a", "value": 1.0}]`, `{"a": 1}`},
+		{"tilde escape", `{"a~b": 1}`, `[{"op": "replace", "path": "/a~0b", "value": 2}]`, `{"a~b": 2}`},
+		{"slash escape", `{"a/b": 1}`, `[{"op": "remove", "path": "/a~1b"}]`, `{}`},
+		{"escapes unescaped in order", `{}`, `[{"op": "add", "path": "/~01", "value": 1}]`, `{"~1": 1}`},
+		{"empty key", `{}`, `[{"op": "add", "path": "/", "value": 1}]`, `{"": 1}`},
+		{"operations in order", `{"a": 1}`,
+			`[{"op": "add", "path": "/b", "value": 2}, {"op": "remove", "path": "/a"}, {"op": "test", "path": "/b", "value": 2}]`,
+			`{"b": 2}`},
+	}
+
+	for _, tt := range tests {
+		got, err := Apply([]byte(tt.doc), []byte(tt.patch))
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if !jsonEqual(t, got, tt.want) {
+			t.Errorf("%s: got %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestApplyErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		doc   string
+		patch string
+		want  error
+	}{
+		{"not a list", `{}`, `{"op": "add"}`, ErrInvalidPatch},
+		{"unknown op", `{}`, `[{"op": "merge", "path": "/a"}]`, ErrInvalidPatch},
+		{"missing value", `{}`, `[{"op": "add", "path": "/a"}]`, ErrInvalidPatch},
+		{"pointer without slash", `{"a": 1}`, `[{"op": "remove", "path": "a"}]`, ErrInvalidPatch},
+		{"add to missing parent", `{}`, `[{"op": "add", "path": "/a/b", "value": 1}]`, ErrInvalidPatch},
+		{"add past array end", `{"a": [1]}`, `[{"op": "add", "path": "/a/2", "value": 1}]`, ErrInvalidPatch},
+		{"leading zero index", `{"a": [1, 2]}`, `[{"op": "replace", "path": "/a/01", "value": 1}]`, ErrInvalidPatch},
+		{"negative index", `{"a": [1]}`, `[{"op": "remove", "path": "/a/-1"}]`, ErrInvalidPatch},
+		{"remove dash", `{"a": [1]}`, `[{"op": "remove", "path": "/a/-"}]`, ErrInvalidPatch},
+		{"remove missing member", `{}`, `[{"op": "remove", "path": "/a"}]`, ErrInvalidPatch},
+		{"replace missing member", `{}`, `[{"op": "replace", "path": "/a", "value": 1}]`, ErrInvalidPatch},
+		{"move into own child", `{"a": {"b": {}}}`, `[{"op": "move", "from": "/a", "path": "/a/b/c"}]`, ErrInvalidPatch},
+		{"copy missing from", `{}`, `[{"op": "copy", "from": "/a", "path": "/b"}]`, ErrInvalidPatch},
+		{"test mismatch", `{"a": 1}`, `[{"op": "test", "path": "/a", "value": "1"}]`, ErrTestFailed},
+		{"test missing member", `{}`, `[{"op": "test", "path": "/a", "value": null}]`, ErrInvalidPatch},
+		{"later op fails", `{"a": 1}`,
+			`[{"op": "remove", "path": "/a"}, {"op": "test", "path": "/a", "value": 1}]`, ErrInvalidPatch},
+	}
+
+	for _, tt := range tests {
+		got, err := Apply([]byte(tt.doc), []byte(tt.patch))
+		if !errors.Is(err, tt.want) {
+			t.Errorf("%s: got %s, %v, want %v", tt.name, got, err, tt.want)
+		}
+	}
+}
+
+// The examples of RFC 7396 appendix A
+func TestMergePatch(t *testing.T) {
+	tests := []struct {
+		doc   string
+		patch string
+		want  string
+	}{
+		{`{"a": "b"}`, `{"a": "c"}`, `{"a": "c"}`},
+		{`{"a": "b"}`, `{"b": "c"}`, `{"a": "b", "b": "c"}`},
+		{`{"a": "b"}`, `{"a": null}`, `{}`},
+		{`{"a": "b", "b": "c"}`, `{"a": null}`, `{"b": "c"}`},
+		{`{"a": ["b"]}`, `{"a": "c"}`, `{"a": "c"}`},
+		{`{"a": "c"}`, `{"a": ["b"]}`, `{"a": ["b"]}`},
+		{`{"a": {"b": "c"}}`, `{"a": {"b": "d", "c": null}}`, `{"a": {"b": "d"}}`},
+		{`{"a": [{"b": "c"}]}`, `{"a": [1]}`, `{"a": [1]}`},
+		{`["a", "b"]`, `["c", "d"]`, `["c", "d"]`},
+		{`{"a": "b"}`, `["c"]`, `["c"]`},
+		{`{"a": "foo"}`, `null`, `null`},
+		{`{"a": "foo"}`, `"bar"`, `"bar"`},
+		{`{"e": null}`, `{"a": 1}`, `{"e": null, "a": 1}`},
+		{`[1, 2]`, `{"a": "b", "c": null}`, `{"a": "b"}`},
+		{`{}`, `{"a": {"bb": {"ccc": null}}}`, `{"a": {"bb": {}}}`},
+	}
+
+	for _, tt := range tests {
+		got, err := MergePatch([]byte(tt.doc), []byte(tt.patch))
+		if err != nil {
+			t.Errorf("%s + %s: %v", tt.doc, tt.patch, err)
+			continue
+		}
+		if !jsonEqual(t, got, tt.want) {
+			t.Errorf("%s + %s: got %s, want %s", tt.doc, tt.patch, got, tt.want)
+		}
+	}
+}
+
+func TestMergePatchInvalid(t *testing.T) {
+	if _, err := MergePatch([]byte(`{}`), []byte(`{`)); !errors.Is(err, ErrInvalidPatch) {
+		t.Errorf("err = %v, want ErrInvalidPatch", err)
+	}
+}
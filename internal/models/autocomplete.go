@@ -0,0 +1,96 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/iamYole/go-movies/internal/db"
+)
+
+const (
+	SuggestMovie  = "movie"
+	SuggestPerson = "person"
+)
+
+// Suggestion is an autocomplete match. Year is a movie's release year.
+type Suggestion struct {
+	Type  string  `json:"type"`
+	ID    int     `json:"id"`
+	Label string  `json:"label"`
+	Year  int     `json:"year,omitempty"`
+	Score float64 `json:"-"`
+}
+
+// minFuzzyKey is the shortest query worth a trigram match; shorter ones
+// only match as prefixes
+const minFuzzyKey = 3
+
+type AutocompleteRepo struct {
+	DB *sql.DB
+}
+
+// Autocomplete returns the best limit titles and names matching q, folding
+// case and accents. Matches scored by trigram word similarity are joined by
+// those starting with q, which get a boost of 1 so they rank first.
+func (a *AutocompleteRepo) Autocomplete(ctx context.Context, q string, limit int) ([]*Suggestion, error) {
+	ctx, cancel := context.WithTimeout(ctx, db.QueryTimeoutDuration)
+	defer cancel()
+
+	//the prefix must reach the planner as a value for the prefix indexes
+	//to be used, so the key is folded first
+	var key string
+	if err := a.DB.QueryRowContext(ctx, `select search_key($1)`, q).Scan(&key); err != nil {
+		return nil, err
+	}
+	if key == "" {
+		return []*Suggestion{}, nil
+	}
+
+	qry := `select kind, id, label, year, max(score)
+			from (
+				(select 'movie' as kind, m.id, m.title as label, extract(year from m.release_date)::int as year,
+					1 + similarity(m.title_key, $1) as score
+				from movies m
+				where m.title_key like $2
+				order by m.title_key
+				limit $3)
+				union all
+				(select 'movie', m.id, m.title, extract(year from m.release_date)::int,
+					word_similarity($1, m.title_key)
+				from movies m
+				where length($1) >= $4 and $1 <% m.title_key
+				order by 5 desc, m.id
+				limit $3)
+				union all
+				(select 'person', p.id, p.name, 0, 1 + similarity(p.name_key, $1)
+				from people p
+				where p.name_key like $2
+				order by p.name_key
+				limit $3)
+				union all
+				(select 'person', p.id, p.name, 0, word_similarity($1, p.name_key)
+				from people p
+				where length($1) >= $4 and $1 <% p.name_key
+				order by 5 desc, p.id
+				limit $3)
+			) s
+			group by kind, id, label, year
+			order by 5 desc, label, id
+			limit $3;`
+
+	rows, err := a.DB.QueryContext(ctx, qry, key, escapeLike(key)+"%", limit, minFuzzyKey)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	suggestions := []*Suggestion{}
+	for rows.Next() {
+		var s Suggestion
+		if err := rows.Scan(&s.Type, &s.ID, &s.Label, &s.Year, &s.Score); err != nil {
+			return nil, err
+		}
+		suggestions = append(suggestions, &s)
+	}
+	return suggestions, rows.Err()
+}
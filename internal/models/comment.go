@@ -0,0 +1,303 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/iamYole/go-movies/internal/db"
+	"github.com/lib/pq"
+)
+
+const (
+	CommentVisible = "visible"
+	// CommentPending comments wait in the moderation queue, out of view
+	CommentPending = "pending"
+	CommentHidden  = "hidden"
+	// CommentDeleted comments keep their place in the thread without a body
+	CommentDeleted = "deleted"
+
+	QueuedByReports  = "reports"
+	QueuedByWordList = "word_list"
+)
+
+// ReportReasons are the reasons a comment can be reported for
+var ReportReasons = []string{"spam", "abuse", "spoiler", "off_topic", "other"}
+
+func IsReportReason(reason string) bool {
+	for _, r := range ReportReasons {
+		if r == reason {
+			return true
+		}
+	}
+	return false
+}
+
+// Comment is a post in a movie's discussion. Replies holds the comments
+// answering it when read as a thread.
+type Comment struct {
+	ID        int        `json:"id"`
+	MovieID   int        `json:"movie_id"`
+	UserID    int        `json:"user_id,omitempty"`
+	Author    string     `json:"author,omitempty"`
+	ParentID  *int       `json:"parent_id,omitempty"`
+	Body      string     `json:"body" validate:"required,max=5000"`
+	Status    string     `json:"status"`
+	CreatedAt time.Time  `json:"created_at"`
+	Replies   []*Comment `json:"replies,omitempty"`
+}
+
+// CommentFilter pages through a movie's threads, newest first
+type CommentFilter struct {
+	MovieID int
+	Limit   int
+	Offset  int
+}
+
+type CommentRepo struct {
+	DB *sql.DB
+}
+
+// InsertComment saves a comment. A comment the word list caught arrives as
+// pending with a queue reason, and its queueing is logged with it.
+func (c *CommentRepo) InsertComment(ctx context.Context, comment Comment, queueReason string) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, db.QueryTimeoutDuration)
+	defer cancel()
+
+	tx, err := c.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if comment.ParentID != nil {
+		var parentMovie int
+		err := tx.QueryRowContext(ctx, `select movie_id from comments where id = $1`, *comment.ParentID).Scan(&parentMovie)
+		if err != nil {
+			return 0, dbError("parent comment", err)
+		}
+		if parentMovie != comment.MovieID {
+			return 0, Invalid("comment", "parent comment belongs to another movie")
+		}
+	}
+
+	stmt := `insert into comments (movie_id, user_id, parent_id, body, status, queue_reason, created_at, updated_at)
+			values ($1, $2, $3, $4, $5, $6, $7, $7)
+			returning id;`
+
+	var id int
+	err = tx.QueryRowContext(ctx, stmt, comment.MovieID, comment.UserID, comment.ParentID, comment.Body,
+		comment.Status, queueReason, time.Now()).Scan(&id)
+	if err != nil {
+		return 0, dbError("comment", err)
+	}
+
+	if comment.Status == CommentPending {
+		action := ModerationAction{Action: "queue", CommentID: &id, UserID: &comment.UserID, Reason: queueReason}
+		if err := logAction(ctx, tx, action); err != nil {
+			return 0, err
+		}
+	}
+
+	return id, tx.Commit()
+}
+
+// GetCommentThreads returns a page of a movie's top level comments, newest
+// first, each with all its replies oldest first. Comments out of public
+// view lose their author and body but keep their place, so replies to them
+// still read in context; ones with no visible replies are left out.
+func (c *CommentRepo) GetCommentThreads(ctx context.Context, filter CommentFilter) ([]*Comment, error) {
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = 20
+	}
+
+	qry := `with recursive roots as (
+				select id from comments
+				where movie_id = $1 and parent_id is null
+				order by created_at desc, id desc
+				limit $2 offset $3
+			), thread as (
+				select c.* from comments c join roots r on r.id = c.id
+				union all
+				select c.* from comments c join thread t on c.parent_id = t.id
+			)
+			select t.id, t.movie_id, t.user_id, u.first_name || ' ' || left(u.last_name, 1) || '.',
+				t.parent_id, t.body, t.status, t.created_at
+			from thread t
+				join users u on u.id = t.user_id
+			order by t.created_at, t.id;`
+
+	ctx, cancel := context.WithTimeout(ctx, db.QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := c.DB.QueryContext(ctx, qry, filter.MovieID, limit, filter.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var all []*Comment
+	byID := map[int]*Comment{}
+	for rows.Next() {
+		var cm Comment
+		err := rows.Scan(&cm.ID, &cm.MovieID, &cm.UserID, &cm.Author, &cm.ParentID, &cm.Body, &cm.Status, &cm.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, &cm)
+		byID[cm.ID] = &cm
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(all) == 0 && filter.Offset == 0 {
+		if err := requireMovie(ctx, c.DB, filter.MovieID); err != nil {
+			return nil, err
+		}
+	}
+
+	//rows come oldest first, so parents are always seen before replies
+	var roots []*Comment
+	for _, cm := range all {
+		if cm.ParentID == nil {
+			roots = append(roots, cm)
+		} else if parent, ok := byID[*cm.ParentID]; ok {
+			parent.Replies = append(parent.Replies, cm)
+		}
+	}
+
+	threads := []*Comment{}
+	for i := len(roots) - 1; i >= 0; i-- {
+		if prune(roots[i]) {
+			threads = append(threads, roots[i])
+		}
+	}
+	return threads, nil
+}
+
+// prune drops replies with nothing to show, masks comments out of public
+// view, and reports whether anything of the thread is left to show
+func prune(cm *Comment) bool {
+	var replies []*Comment
+	for _, r := range cm.Replies {
+		if prune(r) {
+			replies = append(replies, r)
+		}
+	}
+	cm.Replies = replies
+
+	if cm.Status == CommentVisible {
+		return true
+	}
+	cm.UserID, cm.Author, cm.Body = 0, "", ""
+	if cm.Status != CommentDeleted {
+		cm.Status = CommentHidden
+	}
+	return len(cm.Replies) > 0
+}
+
+func (c *CommentRepo) GetComment(ctx context.Context, commentID int) (*Comment, error) {
+	qry := `select c.id, c.movie_id, c.user_id, u.first_name || ' ' || left(u.last_name, 1) || '.',
+				c.parent_id, c.body, c.status, c.created_at
+			from comments c
+				join users u on u.id = c.user_id
+			where c.id = $1;`
+
+	ctx, cancel := context.WithTimeout(ctx, db.QueryTimeoutDuration)
+	defer cancel()
+
+	var cm Comment
+	err := c.DB.QueryRowContext(ctx, qry, commentID).Scan(&cm.ID, &cm.MovieID, &cm.UserID, &cm.Author,
+		&cm.ParentID, &cm.Body, &cm.Status, &cm.CreatedAt)
+	if err != nil {
+		return nil, dbError("comment", err)
+	}
+	return &cm, nil
+}
+
+// ReportComment records a user's report. Once a visible comment has
+// threshold reports it is queued for moderation, which is reported back.
+func (c *CommentRepo) ReportComment(ctx context.Context, movieID, commentID, userID int, reason, details string, threshold int) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, db.QueryTimeoutDuration)
+	defer cancel()
+
+	tx, err := c.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var author int
+	var status string
+	err = tx.QueryRowContext(ctx, `select user_id, status from comments where id = $1 and movie_id = $2 for update`,
+		commentID, movieID).Scan(&author, &status)
+	if err != nil {
+		return false, dbError("comment", err)
+	}
+	if author == userID {
+		return false, Forbidden("you cannot report your own comment")
+	}
+	if status == CommentDeleted {
+		return false, NotFound("comment")
+	}
+
+	_, err = tx.ExecContext(ctx, `insert into comment_reports (comment_id, user_id, reason, details, created_at)
+			values ($1, $2, $3, $4, $5)`, commentID, userID, reason, details, time.Now())
+	if err != nil {
+		err = dbError("report", err)
+		if errors.Is(err, ErrConflict) {
+			return false, Conflict("report", "you have already reported this comment")
+		}
+		return false, err
+	}
+
+	var reports int
+	err = tx.QueryRowContext(ctx, `update comments set report_count = report_count + 1 where id = $1 returning report_count`,
+		commentID).Scan(&reports)
+	if err != nil {
+		return false, err
+	}
+
+	queued := status == CommentVisible && threshold > 0 && reports >= threshold
+	if queued {
+		_, err = tx.ExecContext(ctx, `update comments set status = $1, queue_reason = $2, updated_at = $3 where id = $4`,
+			CommentPending, QueuedByReports, time.Now(), commentID)
+		if err != nil {
+			return false, err
+		}
+		action := ModerationAction{Action: "queue", CommentID: &commentID, UserID: &author, Reason: QueuedByReports}
+		if err := logAction(ctx, tx, action); err != nil {
+			return false, err
+		}
+	}
+
+	return queued, tx.Commit()
+}
+
+// reportTally counts a comment's reports by reason
+func reportTally(ctx context.Context, q queryer, commentIDs []int) (map[int]map[string]int, error) {
+	rows, err := q.QueryContext(ctx, `select comment_id, reason, count(*) from comment_reports
+			where comment_id = any($1)
+			group by comment_id, reason`, pq.Array(commentIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tally := map[int]map[string]int{}
+	for rows.Next() {
+		var id, n int
+		var reason string
+		if err := rows.Scan(&id, &reason, &n); err != nil {
+			return nil, err
+		}
+		if tally[id] == nil {
+			tally[id] = map[string]int{}
+		}
+		tally[id][reason] = n
+	}
+	return tally, rows.Err()
+}
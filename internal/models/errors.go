@@ -0,0 +1,103 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/lib/pq"
+)
+
+// Kinds of domain error. Callers match them with errors.Is and never need to
+// know about the database errors underneath.
+var (
+	ErrNotFound     = errors.New("not found")
+	ErrConflict     = errors.New("conflict")
+	ErrValidation   = errors.New("validation failed")
+	ErrUnauthorized = errors.New("unauthorized")
+	ErrForbidden    = errors.New("forbidden")
+)
+
+// Error is a domain error of a given kind. Message is safe to show to
+// clients while Err keeps the internal cause for logging.
+type Error struct {
+	Kind     error
+	Resource string
+	Message  string
+	Err      error
+}
+
+func (e *Error) Error() string {
+	msg := e.Message
+	if msg == "" {
+		msg = e.Kind.Error()
+	}
+	if e.Err != nil {
+		return fmt.Sprintf("%s: %v", msg, e.Err)
+	}
+	return msg
+}
+
+func (e *Error) Unwrap() []error {
+	if e.Err == nil {
+		return []error{e.Kind}
+	}
+	return []error{e.Kind, e.Err}
+}
+
+func NotFound(resource string) error {
+	return &Error{Kind: ErrNotFound, Resource: resource, Message: resource + " not found"}
+}
+
+func Conflict(resource, message string) error {
+	return &Error{Kind: ErrConflict, Resource: resource, Message: message}
+}
+
+func Invalid(resource, message string) error {
+	return &Error{Kind: ErrValidation, Resource: resource, Message: message}
+}
+
+func Unauthorized(message string) error {
+	return &Error{Kind: ErrUnauthorized, Message: message}
+}
+
+func Forbidden(message string) error {
+	return &Error{Kind: ErrForbidden, Message: message}
+}
+
+// dbError translates database errors about resource into domain errors and
+// passes anything it does not recognise through untouched
+func dbError(resource string, err error) error {
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		return &Error{Kind: ErrNotFound, Resource: resource, Message: resource + " not found", Err: err}
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		switch pqErr.Code {
+		case "23505": //unique_violation
+			return &Error{Kind: ErrConflict, Resource: resource, Message: resource + " already exists", Err: err}
+		case "23503": //foreign_key_violation
+			return &Error{Kind: ErrValidation, Resource: resource, Message: resource + " refers to a record that does not exist", Err: err}
+		case "23502", "23514", "22001": //not_null, check, string too long
+			return &Error{Kind: ErrValidation, Resource: resource, Message: resource + " is invalid", Err: err}
+		}
+	}
+
+	return err
+}
+
+// expectRow reports a not found error when a write touched no rows
+func expectRow(res sql.Result, resource string) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return NotFound(resource)
+	}
+	return nil
+}
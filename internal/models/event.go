@@ -0,0 +1,213 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/iamYole/go-movies/internal/db"
+	"github.com/lib/pq"
+)
+
+const (
+	EventView       = "view"
+	EventImpression = "impression"
+	EventSearch     = "search"
+)
+
+const (
+	TrendingDay  = "day"
+	TrendingWeek = "week"
+)
+
+var TrendingWindows = []string{TrendingDay, TrendingWeek}
+
+// Event is something a visitor looked at. Views and impressions name a
+// movie, searches a query; UserID is zero for anonymous visitors.
+type Event struct {
+	Kind       string
+	MovieID    int
+	UserID     int
+	Query      string
+	OccurredAt time.Time
+}
+
+// TrendingMovie is a movie ranked by its decayed activity over a window
+type TrendingMovie struct {
+	ID          int       `json:"id"`
+	Title       string    `json:"title"`
+	ReleaseDate time.Time `json:"release_date"`
+	MPAARating  string    `json:"mpaa_rating"`
+	Image       string    `json:"image"`
+	Score       float64   `json:"score"`
+}
+
+// TrendingSearch is a search query ranked like a trending movie, each
+// search counting one
+type TrendingSearch struct {
+	Query string  `json:"query"`
+	Score float64 `json:"score"`
+}
+
+// minSearchers is how many people must have searched for a query before it
+// can trend, so no one's own searches are shown to others
+const minSearchers = 3
+
+// TrendingWeights are how much each kind of event counts towards a score
+type TrendingWeights struct {
+	View       float64
+	Impression float64
+}
+
+type EventRepo struct {
+	DB *sql.DB
+}
+
+// InsertEvents writes a batch of events. Events of movies deleted since they
+// were recorded are dropped; those of deleted users turn anonymous.
+func (e *EventRepo) InsertEvents(ctx context.Context, events []Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	kinds := make([]string, len(events))
+	movieIDs := make([]int64, len(events))
+	userIDs := make([]int64, len(events))
+	queries := make([]string, len(events))
+	times := make([]time.Time, len(events))
+	for i, ev := range events {
+		kinds[i], movieIDs[i], userIDs[i] = ev.Kind, int64(ev.MovieID), int64(ev.UserID)
+		queries[i], times[i] = ev.Query, ev.OccurredAt
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, db.QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := e.DB.ExecContext(ctx, `insert into movie_events (kind, movie_id, user_id, query, occurred_at)
+			select s.kind, nullif(s.movie_id, 0), u.id, nullif(s.query, ''), s.occurred_at
+			from unnest($1::text[], $2::int[], $3::int[], $4::text[], $5::timestamp[])
+					as s(kind, movie_id, user_id, query, occurred_at)
+				left join users u on u.id = s.user_id
+			where s.movie_id = 0 or exists (select 1 from movies m where m.id = s.movie_id)`,
+		pq.Array(kinds), pq.Array(movieIDs), pq.Array(userIDs), pq.Array(queries), pq.Array(times))
+	return err
+}
+
+// RefreshTrending recomputes a window's movie and search scores from the
+// events since the window opened. Each event counts its kind's weight,
+// halved for every halfLife of its age, so the score follows the latest
+// activity. Anonymous searches each count as a different searcher.
+func (e *EventRepo) RefreshTrending(ctx context.Context, period string, window, halfLife time.Duration, w TrendingWeights) error {
+	ctx, cancel := context.WithTimeout(ctx, db.QueryTimeoutDuration)
+	defer cancel()
+
+	now := time.Now()
+
+	tx, err := e.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `delete from movie_trending where period = $1`, period); err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `insert into movie_trending (period, movie_id, score, computed_at)
+			select $1, e.movie_id,
+				sum(case e.kind when 'view' then $4::float else $5::float end
+					* exp(-ln(2) * extract(epoch from $6 - e.occurred_at) / $3)),
+				$6
+			from movie_events e
+				join movies m on m.id = e.movie_id
+			where e.occurred_at > $2 and e.kind in ('view', 'impression')
+			group by e.movie_id`,
+		period, now.Add(-window), halfLife.Seconds(), w.View, w.Impression, now)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, `delete from search_trending where period = $1`, period); err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `insert into search_trending (period, query, score, computed_at)
+			select $1, e.query, sum(exp(-ln(2) * extract(epoch from $4 - e.occurred_at) / $3)), $4
+			from movie_events e
+			where e.occurred_at > $2 and e.kind = 'search'
+			group by e.query
+			having count(distinct coalesce(e.user_id::text, 'event:' || e.id)) >= $5`,
+		period, now.Add(-window), halfLife.Seconds(), now, minSearchers)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// PruneEvents deletes the events recorded before cutoff
+func (e *EventRepo) PruneEvents(ctx context.Context, cutoff time.Time) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, db.QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := e.DB.ExecContext(ctx, `delete from movie_events where occurred_at < $1`, cutoff)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// GetTrending returns a window's top movies, highest score first
+func (e *EventRepo) GetTrending(ctx context.Context, period string, limit int) ([]*TrendingMovie, error) {
+	qry := `select m.id, m.title, m.release_date, m.mpaa_rating, coalesce(m.image, ''), t.score
+			from movie_trending t
+				join movies m on m.id = t.movie_id
+			where t.period = $1
+			order by t.score desc, m.id
+			limit $2;`
+
+	ctx, cancel := context.WithTimeout(ctx, db.QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := e.DB.QueryContext(ctx, qry, period, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	movies := []*TrendingMovie{}
+	for rows.Next() {
+		var m TrendingMovie
+		if err := rows.Scan(&m.ID, &m.Title, &m.ReleaseDate, &m.MPAARating, &m.Image, &m.Score); err != nil {
+			return nil, err
+		}
+		movies = append(movies, &m)
+	}
+	return movies, rows.Err()
+}
+
+// GetTrendingSearches returns a window's top search queries, highest score
+// first
+func (e *EventRepo) GetTrendingSearches(ctx context.Context, period string, limit int) ([]*TrendingSearch, error) {
+	qry := `select query, score
+			from search_trending
+			where period = $1
+			order by score desc, query
+			limit $2;`
+
+	ctx, cancel := context.WithTimeout(ctx, db.QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := e.DB.QueryContext(ctx, qry, period, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	searches := []*TrendingSearch{}
+	for rows.Next() {
+		var s TrendingSearch
+		if err := rows.Scan(&s.Query, &s.Score); err != nil {
+			return nil, err
+		}
+		searches = append(searches, &s)
+	}
+	return searches, rows.Err()
+}
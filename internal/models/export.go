@@ -0,0 +1,98 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// exportFetchSize is how many rows each FETCH pulls from the export cursor
+const exportFetchSize = 500
+
+// StreamMovies calls fn for every movie matching filter, in title order, with
+// Genres holding the genre names and ExternalIDs the linked catalogs. Rows come from a server side cursor so the
+// catalog is never held in memory; the context bounds the whole export.
+func (m *MovieRepo) StreamMovies(ctx context.Context, filter MovieFilter, fn func(*Movie) error) error {
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var args []any
+	qry := `declare movie_export no scroll cursor for
+			select 
+				m.id, m.title, m.release_date, m.runtime, m.mpaa_rating,
+				m.description ,coalesce(m.image,'') ,m.created_at ,m.updated_at ,m.version,
+				coalesce((select string_agg(g.genre, '|' order by g.genre)
+						  from movies_genres mg join genres g on g.id = mg.genre_id
+						  where mg.movie_id = m.id), ''),
+				coalesce((select json_object_agg(e.source, e.external_id)
+						  from movie_external_ids e where e.movie_id = m.id), '{}')
+			from movies m
+			where ` + filter.where(&args) + `
+			order by m.title, m.id;`
+
+	if _, err := tx.ExecContext(ctx, qry, args...); err != nil {
+		return err
+	}
+
+	fetch := fmt.Sprintf("fetch forward %d from movie_export", exportFetchSize)
+	for {
+		rows, err := tx.QueryContext(ctx, fetch)
+		if err != nil {
+			return err
+		}
+
+		n := 0
+		for rows.Next() {
+			n++
+			var movie Movie
+			var genres string
+			var externalIDs []byte
+			err := rows.Scan(
+				&movie.ID,
+				&movie.Title,
+				&movie.ReleaseDate,
+				&movie.Runtime,
+				&movie.MPAARating,
+				&movie.Description,
+				&movie.Image,
+				&movie.CreatedAt,
+				&movie.UpdatedAt,
+				&movie.Version,
+				&genres,
+				&externalIDs,
+			)
+			if err != nil {
+				rows.Close()
+				return err
+			}
+
+			if err := json.Unmarshal(externalIDs, &movie.ExternalIDs); err != nil {
+				rows.Close()
+				return err
+			}
+
+			for _, name := range strings.Split(genres, "|") {
+				if name != "" {
+					movie.Genres = append(movie.Genres, &Genre{Genre: name})
+				}
+			}
+
+			if err := fn(&movie); err != nil {
+				rows.Close()
+				return err
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		if n < exportFetchSize {
+			return tx.Commit()
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/iamYole/go-movies/internal/db"
+	"github.com/lib/pq"
+)
+
+// ExternalSources are the catalogs a movie may be linked to
+var ExternalSources = []string{"tmdb", "imdb", "internal"}
+
+func IsExternalSource(source string) bool {
+	for _, s := range ExternalSources {
+		if s == source {
+			return true
+		}
+	}
+	return false
+}
+
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+func loadExternalIDs(ctx context.Context, q queryer, movieID int) (map[string]string, error) {
+	rows, err := q.QueryContext(ctx,
+		`select e.source, e.external_id from movie_external_ids e where e.movie_id = $1`, movieID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids map[string]string
+	for rows.Next() {
+		var source, id string
+		if err := rows.Scan(&source, &id); err != nil {
+			return nil, err
+		}
+		if ids == nil {
+			ids = map[string]string{}
+		}
+		ids[source] = id
+	}
+	return ids, rows.Err()
+}
+
+// GetMovieByExternalID finds the movie linked to an id in an outside catalog
+func (m *MovieRepo) GetMovieByExternalID(ctx context.Context, source, externalID string) (*Movie, error) {
+	movieID, err := m.movieIDByExternalID(ctx, source, externalID)
+	if err != nil {
+		return nil, err
+	}
+	return m.GetMovieByID(ctx, int64(movieID))
+}
+
+func (m *MovieRepo) movieIDByExternalID(ctx context.Context, source, externalID string) (int, error) {
+	qry := `select e.movie_id from movie_external_ids e where e.source = $1 and e.external_id = $2;`
+
+	ctx, cancel := context.WithTimeout(ctx, db.QueryTimeoutDuration)
+	defer cancel()
+
+	var movieID int
+	if err := m.DB.QueryRowContext(ctx, qry, source, externalID).Scan(&movieID); err != nil {
+		return 0, dbError("movie", err)
+	}
+	return movieID, nil
+}
+
+// SetExternalID links a movie to an outside catalog, replacing any earlier
+// id from the same source
+func (m *MovieRepo) SetExternalID(ctx context.Context, movieID int, source, externalID string) error {
+	stmt := `insert into movie_external_ids (movie_id, source, external_id, created_at)
+			values ($1, $2, $3, $4)
+			on conflict (movie_id, source) do update set external_id = excluded.external_id;`
+
+	ctx, cancel := context.WithTimeout(ctx, db.QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, stmt, movieID, source, externalID, time.Now())
+	return dbError("external id", err)
+}
+
+// UpsertMovieByExternalID updates the movie linked to source/externalID, or
+// creates and links a new one. It reports whether the movie was created
+// along with its id, revision and version.
+func (m *MovieRepo) UpsertMovieByExternalID(ctx context.Context, source, externalID string, movie Movie) (bool, int, int, int, error) {
+	movieID, err := m.movieIDByExternalID(ctx, source, externalID)
+	switch {
+	case err == nil:
+		movie.ID = movieID
+		revision, version, err := m.UpdateMovie(ctx, movie)
+		return false, movieID, revision, version, err
+	case !errors.Is(err, ErrNotFound):
+		return false, 0, 0, 0, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, db.QueryTimeoutDuration)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return false, 0, 0, 0, err
+	}
+	defer tx.Rollback()
+
+	movie.ExternalIDs = map[string]string{source: externalID}
+	batch := []Movie{movie}
+	if err := insertMovieBatch(ctx, tx, batch); err != nil {
+		return false, 0, 0, 0, err
+	}
+
+	return true, batch[0].ID, 1, 1, tx.Commit()
+}
+
+// insertBatchExternalIDs links many movies to their outside catalog ids
+func insertBatchExternalIDs(ctx context.Context, tx *sql.Tx, movies []Movie) error {
+	return writeBatchExternalIDs(ctx, tx, movies, "")
+}
+
+// linkBatchExternalIDs adds the outside catalog ids existing movies do not
+// have yet. Ids already linked, to them or to another movie, are left as
+// they are.
+func linkBatchExternalIDs(ctx context.Context, tx *sql.Tx, movies []Movie) error {
+	return writeBatchExternalIDs(ctx, tx, movies, " on conflict do nothing")
+}
+
+func writeBatchExternalIDs(ctx context.Context, tx *sql.Tx, movies []Movie, onConflict string) error {
+	var movieIDs []int64
+	var sources, externalIDs []string
+	for _, movie := range movies {
+		for source, id := range movie.ExternalIDs {
+			movieIDs = append(movieIDs, int64(movie.ID))
+			sources = append(sources, source)
+			externalIDs = append(externalIDs, id)
+		}
+	}
+	if len(movieIDs) == 0 {
+		return nil
+	}
+
+	stmt := `insert into movie_external_ids (movie_id, source, external_id, created_at)
+			select v.movie_id, v.source, v.external_id, $4
+			from unnest($1::int[], $2::text[], $3::text[]) as v(movie_id, source, external_id)` + onConflict
+	_, err := tx.ExecContext(ctx, stmt, pq.Array(movieIDs), pq.Array(sources), pq.Array(externalIDs), time.Now())
+	return dbError("external id", err)
+}
@@ -0,0 +1,116 @@
+package models
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/iamYole/go-movies/internal/db"
+)
+
+const (
+	FacetGenre   = "genre"
+	FacetRating  = "rating"
+	FacetDecade  = "decade"
+	FacetRuntime = "runtime"
+)
+
+var MovieFacets = []string{FacetGenre, FacetRating, FacetDecade, FacetRuntime}
+
+// FacetBucket counts the listed movies sharing a value. Value is what the
+// matching filter parameter takes: a genre id for genre, a rating for
+// rating, the first year of a decade for year_from, and the shortest
+// runtime of a band for runtime_min. Decades and bands end where the next
+// begins.
+type FacetBucket struct {
+	Value string `json:"value"`
+	Label string `json:"label"`
+	Count int    `json:"count"`
+}
+
+// facetQueries count each facet's values over movies m, with a %s for the
+// filter condition. Movies are counted once per genre they belong to.
+var facetQueries = map[string]string{
+	FacetGenre: `select g.id::text, g.genre, count(*)
+			from movies m
+				join movies_genres mg on mg.movie_id = m.id
+				join genres g on g.id = mg.genre_id
+			where %s
+			group by g.id, g.genre
+			order by count(*) desc, g.genre`,
+	FacetRating: `select m.mpaa_rating, m.mpaa_rating, count(*)
+			from movies m
+			where %s
+			group by m.mpaa_rating
+			order by count(*) desc, m.mpaa_rating`,
+	FacetDecade: `select y.decade::text, y.decade || 's', count(*)
+			from movies m,
+				lateral (select extract(year from m.release_date)::int / 10 * 10 as decade) y
+			where %s
+			group by y.decade
+			order by y.decade`,
+	FacetRuntime: `select b.band, b.label, count(*)
+			from movies m,
+				lateral (select
+					case when m.runtime < 90 then 'under_90' when m.runtime < 120 then '90_119'
+						when m.runtime < 150 then '120_149' else '150_plus' end as band,
+					case when m.runtime < 90 then 'Under 90 min' when m.runtime < 120 then '90-119 min'
+						when m.runtime < 150 then '120-149 min' else '150 min and over' end as label) b
+			where %s
+			group by b.band, b.label
+			order by min(m.runtime)`,
+}
+
+// ownFilter clears the part of a filter a facet breaks down, so the facet
+// still offers the other values once one is picked: genre ignores genre,
+// rating ignores rating, decade ignores year_from and year_to, and runtime
+// ignores runtime_min and runtime_max
+var ownFilter = map[string]func(*MovieFilter){
+	FacetGenre:   func(f *MovieFilter) { f.GenreID = 0 },
+	FacetRating:  func(f *MovieFilter) { f.MPAARating = "" },
+	FacetDecade:  func(f *MovieFilter) { f.YearFrom, f.YearTo = 0, 0 },
+	FacetRuntime: func(f *MovieFilter) { f.RuntimeMin, f.RuntimeMax = 0, 0 },
+}
+
+// GetFacets counts the movies matching filter by each of the named facets.
+// Each facet applies every filter but its own, as ownFilter lists, so its
+// counts are what picking one of its values would list.
+func (m *MovieRepo) GetFacets(ctx context.Context, filter MovieFilter, facets []string) (map[string][]*FacetBucket, error) {
+	ctx, cancel := context.WithTimeout(ctx, db.QueryTimeoutDuration)
+	defer cancel()
+
+	result := make(map[string][]*FacetBucket, len(facets))
+	for _, name := range facets {
+		qry, ok := facetQueries[name]
+		if !ok {
+			return nil, Invalid("facet", fmt.Sprintf("unknown facet %q", name))
+		}
+
+		f := filter
+		ownFilter[name](&f)
+		var args []any
+		buckets, err := m.facetBuckets(ctx, fmt.Sprintf(qry, f.where(&args)), args)
+		if err != nil {
+			return nil, fmt.Errorf("%s facet: %w", name, err)
+		}
+		result[name] = buckets
+	}
+	return result, nil
+}
+
+func (m *MovieRepo) facetBuckets(ctx context.Context, qry string, args []any) ([]*FacetBucket, error) {
+	rows, err := m.DB.QueryContext(ctx, qry, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	buckets := []*FacetBucket{}
+	for rows.Next() {
+		var b FacetBucket
+		if err := rows.Scan(&b.Value, &b.Label, &b.Count); err != nil {
+			return nil, err
+		}
+		buckets = append(buckets, &b)
+	}
+	return buckets, rows.Err()
+}
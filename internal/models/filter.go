@@ -0,0 +1,61 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+)
+
+// MovieFilter narrows movie listings and exports. Zero values match
+// everything.
+type MovieFilter struct {
+	Title      string
+	GenreID    int
+	MPAARating string
+	YearFrom   int
+	YearTo     int
+	// RuntimeMin and RuntimeMax bound the runtime in minutes, inclusive
+	RuntimeMin int
+	RuntimeMax int
+}
+
+// where builds the SQL condition for the filter against the movies alias m,
+// appending its bind values to args
+func (f MovieFilter) where(args *[]any) string {
+	var conds []string
+
+	add := func(cond string, value any) {
+		*args = append(*args, value)
+		conds = append(conds, fmt.Sprintf(cond, len(*args)))
+	}
+
+	if f.Title != "" {
+		add("m.title ilike '%%' || $%d || '%%'", escapeLike(f.Title))
+	}
+	if f.GenreID > 0 {
+		add("exists (select 1 from movies_genres fg where fg.movie_id = m.id and fg.genre_id = $%d)", f.GenreID)
+	}
+	if f.MPAARating != "" {
+		add("m.mpaa_rating = $%d", f.MPAARating)
+	}
+	if f.YearFrom > 0 {
+		add("extract(year from m.release_date) >= $%d", f.YearFrom)
+	}
+	if f.YearTo > 0 {
+		add("extract(year from m.release_date) <= $%d", f.YearTo)
+	}
+	if f.RuntimeMin > 0 {
+		add("m.runtime >= $%d", f.RuntimeMin)
+	}
+	if f.RuntimeMax > 0 {
+		add("m.runtime <= $%d", f.RuntimeMax)
+	}
+
+	if len(conds) == 0 {
+		return "true"
+	}
+	return strings.Join(conds, " and ")
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
@@ -0,0 +1,263 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/iamYole/go-movies/internal/db"
+)
+
+// Watch is one viewing of a movie. RewatchCount is how many times the user
+// had seen the movie before, and Rating is their current rating of it.
+type Watch struct {
+	ID           int        `json:"id"`
+	MovieID      int        `json:"movie_id"`
+	WatchedOn    time.Time  `json:"watched_on"`
+	RewatchCount int        `json:"rewatch_count"`
+	Rating       *int       `json:"rating,omitempty"`
+	Title        string     `json:"title"`
+	ReleaseDate  *time.Time `json:"release_date,omitempty"`
+	Runtime      int        `json:"runtime"`
+}
+
+// HistoryMonth groups the viewings of a calendar month
+type HistoryMonth struct {
+	Year    int      `json:"year"`
+	Month   int      `json:"month"`
+	Watches []*Watch `json:"watches"`
+}
+
+// HistoryFilter pages through a user's history, newest first, optionally
+// within a year or a month of a year
+type HistoryFilter struct {
+	UserID int
+	Year   int
+	Month  int
+	Limit  int
+	Offset int
+}
+
+// WatchStats summarise a user's history. Runtimes are in minutes and count
+// every viewing, rewatches included.
+type WatchStats struct {
+	Watches   int           `json:"watches"`
+	Movies    int           `json:"movies"`
+	Runtime   int           `json:"runtime"`
+	TopGenres []*GenreWatch `json:"top_genres"`
+	Years     []*YearWatch  `json:"years"`
+}
+
+type GenreWatch struct {
+	GenreID int    `json:"genre_id"`
+	Genre   string `json:"genre"`
+	Watches int    `json:"watches"`
+	Runtime int    `json:"runtime"`
+}
+
+type YearWatch struct {
+	Year    int `json:"year"`
+	Watches int `json:"watches"`
+	Movies  int `json:"movies"`
+	Runtime int `json:"runtime"`
+}
+
+// topGenreCount is how many genres the stats rank
+const topGenreCount = 5
+
+type HistoryRepo struct {
+	DB *sql.DB
+}
+
+// watchColumns reads a viewing with its movie and the earlier viewings of
+// the same movie, from watch_history h joined to movies m
+const watchColumns = `h.id, h.movie_id, h.watched_on,
+				(select count(*) from watch_history p
+					where p.user_id = h.user_id and p.movie_id = h.movie_id
+						and (p.watched_on, p.id) < (h.watched_on, h.id)),
+				r.rating, m.title, m.release_date, m.runtime`
+
+func scanWatch(row interface{ Scan(...any) error }) (*Watch, error) {
+	var w Watch
+	var rating sql.NullInt64
+	var released time.Time
+	err := row.Scan(&w.ID, &w.MovieID, &w.WatchedOn, &w.RewatchCount, &rating, &w.Title, &released, &w.Runtime)
+	if err != nil {
+		return nil, err
+	}
+	if rating.Valid {
+		n := int(rating.Int64)
+		w.Rating = &n
+	}
+	w.ReleaseDate = &released
+	return &w, nil
+}
+
+// AddWatch records a viewing, and rates the movie too when rating is set
+func (h *HistoryRepo) AddWatch(ctx context.Context, userID, movieID int, watchedOn time.Time, rating int) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, db.QueryTimeoutDuration)
+	defer cancel()
+
+	tx, err := h.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if err := requireMovie(ctx, tx, movieID); err != nil {
+		return 0, err
+	}
+
+	var id int
+	err = tx.QueryRowContext(ctx, `insert into watch_history (user_id, movie_id, watched_on, created_at)
+			values ($1, $2, $3, $4)
+			returning id`, userID, movieID, watchedOn, time.Now()).Scan(&id)
+	if err != nil {
+		return 0, dbError("watch", err)
+	}
+
+	if rating > 0 {
+		if err := setRating(ctx, tx, movieID, userID, rating); err != nil {
+			return 0, err
+		}
+	}
+
+	return id, tx.Commit()
+}
+
+func (h *HistoryRepo) GetWatch(ctx context.Context, userID, watchID int) (*Watch, error) {
+	qry := `select ` + watchColumns + `
+			from watch_history h
+				join movies m on m.id = h.movie_id
+				left join ratings r on r.movie_id = h.movie_id and r.user_id = h.user_id
+			where h.id = $1 and h.user_id = $2;`
+
+	ctx, cancel := context.WithTimeout(ctx, db.QueryTimeoutDuration)
+	defer cancel()
+
+	w, err := scanWatch(h.DB.QueryRowContext(ctx, qry, watchID, userID))
+	if err != nil {
+		return nil, dbError("watch", err)
+	}
+	return w, nil
+}
+
+// GetHistory returns a page of viewings, newest first, grouped by month
+func (h *HistoryRepo) GetHistory(ctx context.Context, filter HistoryFilter) ([]*HistoryMonth, error) {
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = 50
+	}
+
+	qry := `select ` + watchColumns + `
+			from watch_history h
+				join movies m on m.id = h.movie_id
+				left join ratings r on r.movie_id = h.movie_id and r.user_id = h.user_id
+			where h.user_id = $1
+				and ($2 = 0 or extract(year from h.watched_on) = $2)
+				and ($3 = 0 or extract(month from h.watched_on) = $3)
+			order by h.watched_on desc, h.id desc
+			limit $4 offset $5;`
+
+	ctx, cancel := context.WithTimeout(ctx, db.QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := h.DB.QueryContext(ctx, qry, filter.UserID, filter.Year, filter.Month, limit, filter.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	months := []*HistoryMonth{}
+	var month *HistoryMonth
+	for rows.Next() {
+		w, err := scanWatch(rows)
+		if err != nil {
+			return nil, err
+		}
+		year, m, _ := w.WatchedOn.Date()
+		if month == nil || month.Year != year || month.Month != int(m) {
+			month = &HistoryMonth{Year: year, Month: int(m)}
+			months = append(months, month)
+		}
+		month.Watches = append(month.Watches, w)
+	}
+	return months, rows.Err()
+}
+
+// DeleteWatch removes a viewing logged by mistake; the rating is kept
+func (h *HistoryRepo) DeleteWatch(ctx context.Context, userID, watchID int) error {
+	ctx, cancel := context.WithTimeout(ctx, db.QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := h.DB.ExecContext(ctx, `delete from watch_history where id = $1 and user_id = $2`, watchID, userID)
+	if err != nil {
+		return err
+	}
+	return expectRow(res, "watch")
+}
+
+// GetWatchStats totals a user's history, ranks the genres they watch most
+// and breaks their viewing down by year
+func (h *HistoryRepo) GetWatchStats(ctx context.Context, userID int) (*WatchStats, error) {
+	ctx, cancel := context.WithTimeout(ctx, db.QueryTimeoutDuration)
+	defer cancel()
+
+	stats := &WatchStats{TopGenres: []*GenreWatch{}, Years: []*YearWatch{}}
+	err := h.DB.QueryRowContext(ctx, `select count(*), count(distinct h.movie_id), coalesce(sum(m.runtime), 0)
+			from watch_history h
+				join movies m on m.id = h.movie_id
+			where h.user_id = $1`, userID).Scan(&stats.Watches, &stats.Movies, &stats.Runtime)
+	if err != nil {
+		return nil, err
+	}
+	if stats.Watches == 0 {
+		return stats, nil
+	}
+
+	rows, err := h.DB.QueryContext(ctx, `select g.id, g.genre, count(*), coalesce(sum(m.runtime), 0)
+			from watch_history h
+				join movies m on m.id = h.movie_id
+				join movies_genres mg on mg.movie_id = h.movie_id
+				join genres g on g.id = mg.genre_id
+			where h.user_id = $1
+			group by g.id, g.genre
+			order by count(*) desc, sum(m.runtime) desc, g.genre
+			limit $2`, userID, topGenreCount)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var g GenreWatch
+		if err := rows.Scan(&g.GenreID, &g.Genre, &g.Watches, &g.Runtime); err != nil {
+			return nil, err
+		}
+		stats.TopGenres = append(stats.TopGenres, &g)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = h.DB.QueryContext(ctx, `select extract(year from h.watched_on)::int, count(*), count(distinct h.movie_id),
+				coalesce(sum(m.runtime), 0)
+			from watch_history h
+				join movies m on m.id = h.movie_id
+			where h.user_id = $1
+			group by 1
+			order by 1 desc`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var y YearWatch
+		if err := rows.Scan(&y.Year, &y.Watches, &y.Movies, &y.Runtime); err != nil {
+			return nil, err
+		}
+		stats.Years = append(stats.Years, &y)
+	}
+	return stats, rows.Err()
+}
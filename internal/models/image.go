@@ -0,0 +1,160 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/iamYole/go-movies/internal/db"
+)
+
+const (
+	ImagePoster   = "poster"
+	ImageBackdrop = "backdrop"
+
+	ImageSourceUpload = "upload"
+	ImageSourceTMDB   = "tmdb"
+)
+
+// ImageVariants are the sizes every stored image is served in
+var ImageVariants = []string{"thumb", "medium", "original"}
+
+func IsImageVariant(variant string) bool {
+	for _, v := range ImageVariants {
+		if v == variant {
+			return true
+		}
+	}
+	return false
+}
+
+// Image is a piece of stored artwork. Its blobs are addressed by the hash
+// of the original, so the same file uploaded twice is stored once.
+type Image struct {
+	ID          int64     `json:"id"`
+	MovieID     int       `json:"movie_id"`
+	Kind        string    `json:"kind"`
+	Source      string    `json:"source"`
+	SourcePath  string    `json:"source_path,omitempty"`
+	Hash        string    `json:"hash"`
+	ContentType string    `json:"content_type"`
+	Width       int       `json:"width"`
+	Height      int       `json:"height"`
+	Size        int64     `json:"size"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// Key is where a variant of the image is kept in the blob store. Resized
+// variants are always JPEG; the original keeps its own format.
+func (i *Image) Key(variant string) string {
+	ext := ".jpg"
+	if variant == "original" {
+		switch i.ContentType {
+		case "image/png":
+			ext = ".png"
+		case "image/gif":
+			ext = ".gif"
+		}
+	}
+	return fmt.Sprintf("images/%s/%s/%s%s", i.Hash[:2], i.Hash, variant, ext)
+}
+
+// ImageLinks maps each variant of an image to the URL it is served from
+type ImageLinks map[string]string
+
+func imageLinks(id *int64) ImageLinks {
+	if id == nil {
+		return nil
+	}
+	links := ImageLinks{}
+	for _, v := range ImageVariants {
+		links[v] = fmt.Sprintf("/images/%d/%s", *id, v)
+	}
+	return links
+}
+
+// setArtwork fills the derived artwork links from the stored image ids
+func (m *Movie) setArtwork() {
+	m.Artwork = nil
+	if m.PosterImageID == nil && m.BackdropImageID == nil {
+		return
+	}
+	m.Artwork = map[string]ImageLinks{}
+	if links := imageLinks(m.PosterImageID); links != nil {
+		m.Artwork[ImagePoster] = links
+	}
+	if links := imageLinks(m.BackdropImageID); links != nil {
+		m.Artwork[ImageBackdrop] = links
+	}
+}
+
+type ImageRepo struct {
+	DB *sql.DB
+}
+
+func (i *ImageRepo) InsertImage(ctx context.Context, image Image) (int64, error) {
+	stmt := `insert into images (movie_id, kind, source, source_path, hash, content_type, width, height, size, created_at)
+			values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+			returning id;`
+
+	ctx, cancel := context.WithTimeout(ctx, db.QueryTimeoutDuration)
+	defer cancel()
+
+	var id int64
+	err := i.DB.QueryRowContext(ctx, stmt, image.MovieID, image.Kind, image.Source, image.SourcePath, image.Hash,
+		image.ContentType, image.Width, image.Height, image.Size, time.Now()).Scan(&id)
+	if err != nil {
+		return 0, dbError("image", err)
+	}
+	return id, nil
+}
+
+func (i *ImageRepo) GetImage(ctx context.Context, id int64) (*Image, error) {
+	qry := `select id, coalesce(movie_id, 0), kind, source, source_path, hash, content_type, width, height, size, created_at
+			from images where id = $1;`
+
+	ctx, cancel := context.WithTimeout(ctx, db.QueryTimeoutDuration)
+	defer cancel()
+
+	var image Image
+	err := i.DB.QueryRowContext(ctx, qry, id).Scan(&image.ID, &image.MovieID, &image.Kind, &image.Source,
+		&image.SourcePath, &image.Hash, &image.ContentType, &image.Width, &image.Height, &image.Size, &image.CreatedAt)
+	if err != nil {
+		return nil, dbError("image", err)
+	}
+	return &image, nil
+}
+
+// SetMovieImage points the movie's poster or backdrop at an image. Like an
+// edit it bumps the version, so cached copies of the movie go stale; version
+// zero skips the check. The new version is returned.
+func (m *MovieRepo) SetMovieImage(ctx context.Context, movieID int, kind string, imageID int64, version int) (int, error) {
+	var column string
+	switch kind {
+	case ImagePoster:
+		column = "poster_image_id"
+	case ImageBackdrop:
+		column = "backdrop_image_id"
+	default:
+		return 0, fmt.Errorf("unknown image kind %q", kind)
+	}
+
+	stmt := fmt.Sprintf(`update movies set %s = $1, updated_at = $2, version = version + 1
+			where id = $3 and ($4 = 0 or version = $4)
+			RETURNING version;`, column)
+
+	ctx, cancel := context.WithTimeout(ctx, db.QueryTimeoutDuration)
+	defer cancel()
+
+	var newVersion int
+	err := m.DB.QueryRowContext(ctx, stmt, imageID, time.Now(), movieID, version).Scan(&newVersion)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, m.versionError(ctx, movieID)
+		}
+		return 0, dbError("movie", err)
+	}
+	return newVersion, nil
+}
@@ -0,0 +1,565 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/iamYole/go-movies/internal/db"
+	"github.com/lib/pq"
+)
+
+// importBatchSize keeps multi-row inserts well under the bind parameter limit
+const importBatchSize = 500
+
+// importedFields are the movie fields a catalog import sets, and so the ones
+// importing a row again refreshes
+var importedFields = []string{"title", "release_date", "runtime", "mpaa_rating", "description", "genres_array"}
+
+// externalFields are the fields UpsertMoviesByExternalID refreshes; outside
+// catalogs carry no rating or description worth keeping
+var externalFields = []string{"title", "release_date", "runtime", "genres_array"}
+
+// ImportMovie is a movie whose genres are given by name rather than id
+type ImportMovie struct {
+	Movie       Movie
+	Genres      []string
+	ExternalIDs map[string]string
+}
+
+// ImportMovies writes movies in batches inside one transaction, creating any
+// genres that do not exist yet. Rows whose external ids are already linked
+// update the linked movie instead of adding another, as do later rows
+// repeating an earlier row's ids, so importing the same file twice changes
+// nothing. The movie ids are returned in input order, along with how many
+// movies were created and how many updated.
+func (m *MovieRepo) ImportMovies(ctx context.Context, movies []ImportMovie) ([]int, int, int, error) {
+	ctx, cancel := context.WithTimeout(ctx, db.BulkTimeoutDuration)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	defer tx.Rollback()
+
+	var names []string
+	for _, im := range movies {
+		names = append(names, im.Genres...)
+	}
+	genreIDs, err := resolveGenres(ctx, tx, names)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+
+	linked, err := lockLinkedMovies(ctx, tx, movies)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+
+	//each row is written to a target: a linked movie, or a new one shared by
+	//every row with the same external ids, the last row winning
+	type target struct {
+		movie  Movie
+		linked bool
+	}
+	var targets []*target
+	rowTargets := make([]int, len(movies))
+	byKey := map[string]int{}
+	byMovie := map[int]int{}
+
+	for i, im := range movies {
+		t := -1
+		for _, source := range ExternalSources {
+			id, ok := im.ExternalIDs[source]
+			if !ok {
+				continue
+			}
+			key := source + ":" + id
+			if j, ok := byKey[key]; ok {
+				t = j
+				break
+			}
+			if movieID, ok := linked[key]; ok {
+				if j, ok := byMovie[movieID]; ok {
+					t = j
+				} else {
+					t = len(targets)
+					byMovie[movieID] = t
+					targets = append(targets, &target{movie: Movie{ID: movieID}, linked: true})
+				}
+				break
+			}
+		}
+		if t < 0 {
+			t = len(targets)
+			targets = append(targets, &target{})
+		}
+
+		movie := im.Movie
+		movie.ID = targets[t].movie.ID
+		movie.ExternalIDs = map[string]string{}
+		for source, id := range targets[t].movie.ExternalIDs {
+			movie.ExternalIDs[source] = id
+		}
+		for source, id := range im.ExternalIDs {
+			movie.ExternalIDs[source] = id
+			byKey[source+":"+id] = t
+		}
+		movie.GenresArray = nil
+		for _, name := range im.Genres {
+			movie.GenresArray = append(movie.GenresArray, genreIDs[strings.ToLower(name)])
+		}
+
+		targets[t].movie = movie
+		rowTargets[i] = t
+	}
+
+	var fresh, stale []Movie
+	for _, t := range targets {
+		if t.linked {
+			stale = append(stale, t.movie)
+		} else {
+			fresh = append(fresh, t.movie)
+		}
+	}
+
+	for start := 0; start < len(fresh); start += importBatchSize {
+		end := min(start+importBatchSize, len(fresh))
+		if err := insertMovieBatch(ctx, tx, fresh[start:end]); err != nil {
+			return nil, 0, 0, err
+		}
+	}
+
+	updated, err := refreshMovieBatch(ctx, tx, stale, importedFields)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	//a row may add ids from other sources to a linked movie
+	if err := linkBatchExternalIDs(ctx, tx, stale); err != nil {
+		return nil, 0, 0, err
+	}
+
+	n := 0
+	for _, t := range targets {
+		if !t.linked {
+			t.movie.ID = fresh[n].ID
+			n++
+		}
+	}
+	ids := make([]int, len(movies))
+	for i, t := range rowTargets {
+		ids[i] = targets[t].movie.ID
+	}
+
+	return ids, len(fresh), updated, tx.Commit()
+}
+
+// lockLinkedMovies finds the movies already linked to the external ids of
+// the rows, keyed by "source:id", and locks them so a concurrent import
+// cannot update them in between
+func lockLinkedMovies(ctx context.Context, tx *sql.Tx, movies []ImportMovie) (map[string]int, error) {
+	var sources, keys []string
+	for _, im := range movies {
+		for source, id := range im.ExternalIDs {
+			sources = append(sources, source)
+			keys = append(keys, id)
+		}
+	}
+	linked := map[string]int{}
+	if len(keys) == 0 {
+		return linked, nil
+	}
+
+	qry := `select e.source, e.external_id, e.movie_id
+			from movie_external_ids e join movies m on m.id = e.movie_id
+			where (e.source, e.external_id) in (select * from unnest($1::text[], $2::text[]))
+			for update of m;`
+	rows, err := tx.QueryContext(ctx, qry, pq.Array(sources), pq.Array(keys))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var source, key string
+		var id int
+		if err := rows.Scan(&source, &key, &id); err != nil {
+			return nil, err
+		}
+		linked[source+":"+key] = id
+	}
+	return linked, rows.Err()
+}
+
+// resolveGenres maps lower cased genre names to ids, inserting the ones that
+// are missing
+func resolveGenres(ctx context.Context, tx *sql.Tx, names []string) (map[string]int, error) {
+	ids := map[string]int{}
+	if len(names) == 0 {
+		return ids, nil
+	}
+
+	seen := map[string]bool{}
+	var unique []string
+	for _, name := range names {
+		if key := strings.ToLower(name); !seen[key] {
+			seen[key] = true
+			unique = append(unique, name)
+		}
+	}
+
+	stmt := `insert into genres (genre, created_at, updated_at)
+			select n, now(), now() from unnest($1::text[]) n
+			where not exists (select 1 from genres g where lower(g.genre) = lower(n))
+			on conflict (genre) do nothing;`
+	if _, err := tx.ExecContext(ctx, stmt, pq.Array(unique)); err != nil {
+		return nil, err
+	}
+
+	qry := `select g.id, lower(g.genre) from genres g where lower(g.genre) = any($1::text[]);`
+	lowered := make([]string, 0, len(unique))
+	for _, name := range unique {
+		lowered = append(lowered, strings.ToLower(name))
+	}
+
+	rows, err := tx.QueryContext(ctx, qry, pq.Array(lowered))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int
+		var name string
+		if err := rows.Scan(&id, &name); err != nil {
+			return nil, err
+		}
+		ids[name] = id
+	}
+	return ids, rows.Err()
+}
+
+// insertMovieBatch inserts movies with multi-row statements and sets their
+// ids. Ids are taken from the sequence up front so rows never have to be
+// matched back to the RETURNING order.
+func insertMovieBatch(ctx context.Context, tx *sql.Tx, movies []Movie) error {
+	rows, err := tx.QueryContext(ctx,
+		`select nextval(pg_get_serial_sequence('movies', 'id')) from generate_series(1, $1)`, len(movies))
+	if err != nil {
+		return err
+	}
+	for i := 0; rows.Next(); i++ {
+		if err := rows.Scan(&movies[i].ID); err != nil {
+			rows.Close()
+			return err
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	var values, genreValues, revisionValues []string
+	var args, genreArgs, revisionArgs []any
+
+	for i := range movies {
+		movie := &movies[i]
+		movie.Version = 1
+
+		n := len(args)
+		values = append(values, fmt.Sprintf("($%d,$%d,$%d,$%d,$%d,$%d,$%d,$%d,$%d,$%d,$%d,$%d,$%d)",
+			n+1, n+2, n+3, n+4, n+5, n+6, n+7, n+8, n+9, n+10, n+11, n+12, n+13))
+		args = append(args, movie.ID, movie.Title, movie.ReleaseDate, movie.Runtime, movie.MPAARating,
+			movie.Description, movie.Image, movie.Backdrop, movie.OriginalLanguage, movie.Tagline,
+			pq.Array(lockedFields(movie.LockedFields)), now, now)
+
+		for _, genreID := range movie.GenresArray {
+			n := len(genreArgs)
+			genreValues = append(genreValues, fmt.Sprintf("($%d,$%d)", n+1, n+2))
+			genreArgs = append(genreArgs, movie.ID, genreID)
+		}
+
+		snapshot, err := json.Marshal(movie)
+		if err != nil {
+			return err
+		}
+		n = len(revisionArgs)
+		revisionValues = append(revisionValues, fmt.Sprintf("($%d,1,$%d,$%d)", n+1, n+2, n+3))
+		revisionArgs = append(revisionArgs, movie.ID, snapshot, now)
+	}
+
+	stmt := `insert into movies 
+				(id,title,release_date,runtime,mpaa_rating,description,image,
+				 backdrop,original_language,tagline,locked_fields,created_at,updated_at)
+			values ` + strings.Join(values, ",")
+	if _, err := tx.ExecContext(ctx, stmt, args...); err != nil {
+		return dbError("movie", err)
+	}
+
+	if len(genreValues) > 0 {
+		stmt = `insert into movies_genres (movie_id, genre_id) values ` + strings.Join(genreValues, ",")
+		if _, err := tx.ExecContext(ctx, stmt, genreArgs...); err != nil {
+			return dbError("genre", err)
+		}
+	}
+
+	if err := insertBatchExternalIDs(ctx, tx, movies); err != nil {
+		return err
+	}
+
+	stmt = `insert into movie_revisions (movie_id, revision, snapshot, created_at) values ` + strings.Join(revisionValues, ",")
+	_, err = tx.ExecContext(ctx, stmt, revisionArgs...)
+	return err
+}
+
+// UpsertMoviesByExternalID writes one batch of movies keyed by their id in
+// source, in a single transaction. Unknown ids are inserted and linked;
+// movies already linked get their title, release date, runtime and genres
+// refreshed and a new revision when anything changed.
+func (m *MovieRepo) UpsertMoviesByExternalID(ctx context.Context, source string, movies []ImportMovie) (int, int, error) {
+	if len(movies) == 0 {
+		return 0, 0, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, db.BulkTimeoutDuration)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer tx.Rollback()
+
+	var names, keys []string
+	for _, im := range movies {
+		names = append(names, im.Genres...)
+		keys = append(keys, im.ExternalIDs[source])
+	}
+	genreIDs, err := resolveGenres(ctx, tx, names)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	//lock the linked movies so a concurrent batch cannot update them in between
+	qry := `select e.external_id, e.movie_id
+			from movie_external_ids e join movies m on m.id = e.movie_id
+			where e.source = $1 and e.external_id = any($2::text[])
+			for update of m;`
+	rows, err := tx.QueryContext(ctx, qry, source, pq.Array(keys))
+	if err != nil {
+		return 0, 0, err
+	}
+	existing := map[string]int{}
+	for rows.Next() {
+		var key string
+		var id int
+		if err := rows.Scan(&key, &id); err != nil {
+			rows.Close()
+			return 0, 0, err
+		}
+		existing[key] = id
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, 0, err
+	}
+
+	var fresh, stale []Movie
+	for _, im := range movies {
+		movie := im.Movie
+		movie.ExternalIDs = im.ExternalIDs
+		movie.GenresArray = nil
+		for _, name := range im.Genres {
+			movie.GenresArray = append(movie.GenresArray, genreIDs[strings.ToLower(name)])
+		}
+
+		if id, ok := existing[im.ExternalIDs[source]]; ok {
+			movie.ID = id
+			stale = append(stale, movie)
+		} else {
+			fresh = append(fresh, movie)
+		}
+	}
+
+	if len(fresh) > 0 {
+		if err := insertMovieBatch(ctx, tx, fresh); err != nil {
+			return 0, 0, err
+		}
+	}
+
+	updated, err := refreshMovieBatch(ctx, tx, stale, externalFields)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return len(fresh), updated, tx.Commit()
+}
+
+// refreshMovieBatch overwrites the given fields of existing movies,
+// skipping the ones that would not change. Locked fields, and descriptions
+// the import leaves empty, keep their stored value.
+func refreshMovieBatch(ctx context.Context, tx *sql.Tx, movies []Movie, fields []string) (int, error) {
+	if len(movies) == 0 {
+		return 0, nil
+	}
+
+	byID := make(map[int]Movie, len(movies))
+	var ids, runtimes []int64
+	var titles, dates, ratings, descriptions, genres []string
+	for _, movie := range movies {
+		byID[movie.ID] = movie
+		ids = append(ids, int64(movie.ID))
+		titles = append(titles, movie.Title)
+		dates = append(dates, movie.ReleaseDate.Format(time.DateOnly))
+		runtimes = append(runtimes, int64(movie.Runtime))
+		ratings = append(ratings, movie.MPAARating)
+		descriptions = append(descriptions, movie.Description)
+		genres = append(genres, genreKey(movie.GenresArray))
+	}
+
+	//genres are compared as sorted sets, the order they were added in does
+	//not count as a change
+	stmt := `with v as (
+				select m.id,
+					case when 'title' = any($8) then u.title else m.title end as title,
+					case when 'release_date' = any($8) and not 'release_date' = any(m.locked_fields)
+						then u.release_date else m.release_date end as release_date,
+					case when 'runtime' = any($8) and not 'runtime' = any(m.locked_fields)
+						then u.runtime else m.runtime end as runtime,
+					case when 'mpaa_rating' = any($8) then u.mpaa_rating else m.mpaa_rating end as mpaa_rating,
+					case when 'description' = any($8) and u.description <> '' and not 'description' = any(m.locked_fields)
+						then u.description else m.description end as description,
+					s.genres as stored_genres,
+					case when 'genres_array' = any($8) and not 'genres_array' = any(m.locked_fields)
+						then string_to_array(u.genres, ',')::int[] else s.genres end as genres
+				from movies m
+					join unnest($1::int[], $2::text[], $3::date[], $4::int[], $5::text[], $6::text[], $7::text[])
+						as u(id, title, release_date, runtime, mpaa_rating, description, genres) on u.id = m.id,
+					lateral (select array(select distinct mg.genre_id from movies_genres mg
+						where mg.movie_id = m.id order by 1) as genres) s
+			)
+			update movies m set
+				title = v.title, release_date = v.release_date, runtime = v.runtime,
+				mpaa_rating = v.mpaa_rating, description = v.description,
+				updated_at = $9, version = m.version + 1
+			from v
+			where m.id = v.id
+			  and (m.title, m.release_date, m.runtime, m.mpaa_rating, m.description, v.stored_genres)
+				is distinct from (v.title, v.release_date, v.runtime, v.mpaa_rating, v.description, v.genres)
+			RETURNING m.id, m.title, m.release_date, m.runtime, m.mpaa_rating, m.description,
+				coalesce(m.image,''), m.backdrop, m.original_language, m.tagline, m.locked_fields, m.version,
+				v.genres;`
+
+	rows, err := tx.QueryContext(ctx, stmt, pq.Array(ids), pq.Array(titles), pq.Array(dates), pq.Array(runtimes),
+		pq.Array(ratings), pq.Array(descriptions), pq.Array(genres), pq.Array(fields), time.Now())
+	if err != nil {
+		return 0, dbError("movie", err)
+	}
+
+	var changed []Movie
+	for rows.Next() {
+		var movie Movie
+		var genres pq.Int64Array
+		err := rows.Scan(&movie.ID, &movie.Title, &movie.ReleaseDate, &movie.Runtime, &movie.MPAARating,
+			&movie.Description, &movie.Image, &movie.Backdrop, &movie.OriginalLanguage, &movie.Tagline,
+			pq.Array(&movie.LockedFields), &movie.Version, &genres)
+		if err != nil {
+			rows.Close()
+			return 0, err
+		}
+		for _, id := range genres {
+			movie.GenresArray = append(movie.GenresArray, int(id))
+		}
+		movie.ExternalIDs = byID[movie.ID].ExternalIDs
+		changed = append(changed, movie)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	if len(changed) == 0 {
+		return 0, nil
+	}
+	if err := replaceBatchGenres(ctx, tx, changed); err != nil {
+		return 0, err
+	}
+	if err := insertBatchRevisions(ctx, tx, changed); err != nil {
+		return 0, err
+	}
+
+	return len(changed), nil
+}
+
+// genreKey writes genre ids as a sorted, comma separated set
+func genreKey(genreIDs []int) string {
+	sorted := slices.Clone(genreIDs)
+	slices.Sort(sorted)
+	sorted = slices.Compact(sorted)
+
+	keys := make([]string, len(sorted))
+	for i, id := range sorted {
+		keys[i] = strconv.Itoa(id)
+	}
+	return strings.Join(keys, ",")
+}
+
+// replaceBatchGenres sets the genres of many movies with array statements
+// instead of a round trip per movie
+func replaceBatchGenres(ctx context.Context, tx *sql.Tx, movies []Movie) error {
+	var ids, movieIDs, genreIDs []int64
+	for _, movie := range movies {
+		ids = append(ids, int64(movie.ID))
+		for _, g := range movie.GenresArray {
+			movieIDs = append(movieIDs, int64(movie.ID))
+			genreIDs = append(genreIDs, int64(g))
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, `delete from movies_genres where movie_id = any($1::int[])`, pq.Array(ids)); err != nil {
+		return err
+	}
+	if len(movieIDs) == 0 {
+		return nil
+	}
+
+	stmt := `insert into movies_genres (movie_id, genre_id)
+			select * from unnest($1::int[], $2::int[]);`
+	_, err := tx.ExecContext(ctx, stmt, pq.Array(movieIDs), pq.Array(genreIDs))
+	return dbError("genre", err)
+}
+
+// insertBatchRevisions is insertRevision for many movies at once, locking
+// the movie rows in id order so batches cannot deadlock each other
+func insertBatchRevisions(ctx context.Context, tx *sql.Tx, movies []Movie) error {
+	ids := make([]int64, 0, len(movies))
+	snapshots := make([]string, 0, len(movies))
+	for _, movie := range movies {
+		snapshot, err := json.Marshal(movie)
+		if err != nil {
+			return err
+		}
+		ids = append(ids, int64(movie.ID))
+		snapshots = append(snapshots, string(snapshot))
+	}
+
+	lock := `select 1 from movies where id = any($1::int[]) order by id for update`
+	if _, err := tx.ExecContext(ctx, lock, pq.Array(ids)); err != nil {
+		return err
+	}
+
+	stmt := `insert into movie_revisions (movie_id, revision, snapshot, created_at)
+			select v.movie_id,
+				coalesce((select max(r.revision) from movie_revisions r where r.movie_id = v.movie_id), 0) + 1,
+				v.snapshot::jsonb, $3
+			from unnest($1::int[], $2::text[]) as v(movie_id, snapshot);`
+	_, err := tx.ExecContext(ctx, stmt, pq.Array(ids), pq.Array(snapshots), time.Now())
+	return err
+}
@@ -0,0 +1,310 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/iamYole/go-movies/internal/db"
+	"github.com/lib/pq"
+)
+
+const (
+	JobPending = "pending"
+	JobRunning = "running"
+	JobDone    = "done"
+	JobDead    = "dead"
+)
+
+var JobStatuses = []string{JobPending, JobRunning, JobDone, JobDead}
+
+// ErrLeaseLost is returned when a worker records the outcome of a job it no
+// longer holds
+var ErrLeaseLost = errors.New("job lease lost")
+
+// Job is a unit of background work. Key, when set, collapses repeated
+// enqueues of the same work while one is still pending.
+type Job struct {
+	ID          int64           `json:"id"`
+	Kind        string          `json:"kind"`
+	Key         string          `json:"key,omitempty"`
+	Payload     json.RawMessage `json:"payload"`
+	Status      string          `json:"status"`
+	Attempts    int             `json:"attempts"`
+	MaxAttempts int             `json:"max_attempts"`
+	RunAt       time.Time       `json:"run_at"`
+	LockedAt    *time.Time      `json:"locked_at,omitempty"`
+	LockedBy    string          `json:"locked_by,omitempty"`
+	LastError   string          `json:"last_error,omitempty"`
+	CreatedAt   time.Time       `json:"created_at"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+}
+
+type JobFilter struct {
+	Status string
+	Kind   string
+	Limit  int
+	Offset int
+}
+
+type JobRepo struct {
+	DB *sql.DB
+}
+
+const jobColumns = `id, kind, coalesce(key, ''), payload, status, attempts, max_attempts, run_at,
+	locked_at, coalesce(locked_by, ''), coalesce(last_error, ''), created_at, updated_at`
+
+func scanJob(row rowScanner) (*Job, error) {
+	var job Job
+	var payload []byte
+	err := row.Scan(&job.ID, &job.Kind, &job.Key, &payload, &job.Status, &job.Attempts, &job.MaxAttempts,
+		&job.RunAt, &job.LockedAt, &job.LockedBy, &job.LastError, &job.CreatedAt, &job.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	job.Payload = payload
+	return &job, nil
+}
+
+// EnqueueJob adds a job to the queue. When a pending job with the same kind
+// and key exists its payload is replaced instead and its id returned.
+func (j *JobRepo) EnqueueJob(ctx context.Context, job Job) (int64, error) {
+	if job.Payload == nil {
+		job.Payload = json.RawMessage("{}")
+	}
+	if job.MaxAttempts <= 0 {
+		job.MaxAttempts = 5
+	}
+	if job.RunAt.IsZero() {
+		job.RunAt = time.Now()
+	}
+
+	stmt := `insert into jobs (kind, key, payload, max_attempts, run_at)
+			values ($1, nullif($2, ''), $3, $4, $5)
+			on conflict (kind, key) where status = 'pending'
+			do update set payload = excluded.payload,
+				run_at = least(jobs.run_at, excluded.run_at),
+				updated_at = now()
+			returning id;`
+
+	ctx, cancel := context.WithTimeout(ctx, db.QueryTimeoutDuration)
+	defer cancel()
+
+	var id int64
+	err := j.DB.QueryRowContext(ctx, stmt, job.Kind, job.Key, []byte(job.Payload), job.MaxAttempts, job.RunAt).Scan(&id)
+	if err != nil {
+		return 0, dbError("job", err)
+	}
+	return id, nil
+}
+
+// EnqueueJobs queues many jobs in one statement, with the same collapsing of
+// pending keys as EnqueueJob. Jobs repeating a kind and key within the batch
+// are collapsed too, the last payload winning, since one statement cannot
+// update the same row twice.
+func (j *JobRepo) EnqueueJobs(ctx context.Context, jobs []Job) error {
+	if len(jobs) == 0 {
+		return nil
+	}
+
+	var kinds, keys, payloads []string
+	seen := map[[2]string]int{}
+	for _, job := range jobs {
+		if job.Payload == nil {
+			job.Payload = json.RawMessage("{}")
+		}
+		//jobs without a key are never collapsed
+		if job.Key != "" {
+			k := [2]string{job.Kind, job.Key}
+			if i, ok := seen[k]; ok {
+				payloads[i] = string(job.Payload)
+				continue
+			}
+			seen[k] = len(kinds)
+		}
+		kinds = append(kinds, job.Kind)
+		keys = append(keys, job.Key)
+		payloads = append(payloads, string(job.Payload))
+	}
+
+	stmt := `insert into jobs (kind, key, payload)
+			select v.kind, nullif(v.key, ''), v.payload::jsonb
+			from unnest($1::text[], $2::text[], $3::text[]) as v(kind, key, payload)
+			on conflict (kind, key) where status = 'pending'
+			do update set payload = excluded.payload, updated_at = now();`
+
+	ctx, cancel := context.WithTimeout(ctx, db.QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := j.DB.ExecContext(ctx, stmt, pq.Array(kinds), pq.Array(keys), pq.Array(payloads))
+	return dbError("job", err)
+}
+
+// ClaimJob locks the next due job of one of kinds for worker and marks it
+// running. Running jobs whose lease has expired, because their worker died,
+// are claimed again. It returns nil when there is nothing to do.
+func (j *JobRepo) ClaimJob(ctx context.Context, kinds []string, worker string, lease time.Duration) (*Job, error) {
+	stmt := `update jobs set status = 'running', attempts = attempts + 1,
+				locked_at = now(), locked_by = $2, updated_at = now()
+			where id = (
+				select id from jobs
+				where kind = any($1)
+				and ((status = 'pending' and run_at <= now())
+					or (status = 'running' and locked_at < now() - make_interval(secs => $3)))
+				order by run_at, id
+				limit 1
+				for update skip locked
+			)
+			returning ` + jobColumns + `;`
+
+	ctx, cancel := context.WithTimeout(ctx, db.QueryTimeoutDuration)
+	defer cancel()
+
+	job, err := scanJob(j.DB.QueryRowContext(ctx, stmt, pq.Array(kinds), worker, lease.Seconds()))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return job, err
+}
+
+// CompleteJob marks a job claimed by worker done. It returns ErrLeaseLost
+// when the job is no longer worker's.
+func (j *JobRepo) CompleteJob(ctx context.Context, id int64, worker string) error {
+	stmt := `update jobs set status = 'done', locked_at = null, locked_by = null,
+				last_error = null, updated_at = now()
+			where id = $1 and locked_by = $2;`
+
+	ctx, cancel := context.WithTimeout(ctx, db.QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := j.DB.ExecContext(ctx, stmt, id, worker)
+	if err != nil {
+		return err
+	}
+	return expectLease(res)
+}
+
+// FailJob records a failed attempt of a job claimed by worker. The job runs
+// again at retryAt, or moves to the dead letter state when dead is set. Like
+// CompleteJob it returns ErrLeaseLost when the job is no longer worker's.
+func (j *JobRepo) FailJob(ctx context.Context, id int64, worker string, message string, retryAt time.Time, dead bool) error {
+	status := JobPending
+	if dead {
+		status = JobDead
+	}
+
+	stmt := `update jobs set status = $2, run_at = $3, last_error = $4,
+				locked_at = null, locked_by = null, updated_at = now()
+			where id = $1 and locked_by = $5;`
+
+	ctx, cancel := context.WithTimeout(ctx, db.QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := j.DB.ExecContext(ctx, stmt, id, status, retryAt, message, worker)
+	if err != nil {
+		return dbError("job", err)
+	}
+	return expectLease(res)
+}
+
+// expectLease reports ErrLeaseLost when a worker's update matched no job:
+// its lease expired and another worker claimed the job, or it was removed
+func expectLease(res sql.Result) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrLeaseLost
+	}
+	return nil
+}
+
+// RetryJob puts a job that is not running back in the queue to run now, with
+// a fresh set of attempts
+func (j *JobRepo) RetryJob(ctx context.Context, id int64) (*Job, error) {
+	stmt := `update jobs set status = 'pending', attempts = 0, run_at = now(), updated_at = now()
+			where id = $1 and status <> 'running'
+			returning ` + jobColumns + `;`
+
+	ctx, cancel := context.WithTimeout(ctx, db.QueryTimeoutDuration)
+	defer cancel()
+
+	job, err := scanJob(j.DB.QueryRowContext(ctx, stmt, id))
+	if !errors.Is(err, sql.ErrNoRows) {
+		return job, dbError("job", err)
+	}
+
+	if _, err := j.GetJob(ctx, id); err != nil {
+		return nil, err
+	}
+	return nil, Conflict("job", "job is running")
+}
+
+func (j *JobRepo) GetJob(ctx context.Context, id int64) (*Job, error) {
+	qry := `select ` + jobColumns + ` from jobs where id = $1;`
+
+	ctx, cancel := context.WithTimeout(ctx, db.QueryTimeoutDuration)
+	defer cancel()
+
+	job, err := scanJob(j.DB.QueryRowContext(ctx, qry, id))
+	if err != nil {
+		return nil, dbError("job", err)
+	}
+	return job, nil
+}
+
+// GetJobs lists jobs newest first
+func (j *JobRepo) GetJobs(ctx context.Context, filter JobFilter) ([]*Job, error) {
+	var args []any
+	where := "true"
+	if filter.Status != "" {
+		args = append(args, filter.Status)
+		where += fmt.Sprintf(" and status = $%d", len(args))
+	}
+	if filter.Kind != "" {
+		args = append(args, filter.Kind)
+		where += fmt.Sprintf(" and kind = $%d", len(args))
+	}
+	if filter.Limit <= 0 {
+		filter.Limit = 50
+	}
+	args = append(args, filter.Limit, filter.Offset)
+
+	qry := fmt.Sprintf(`select %s from jobs where %s order by id desc limit $%d offset $%d;`,
+		jobColumns, where, len(args)-1, len(args))
+
+	ctx, cancel := context.WithTimeout(ctx, db.QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := j.DB.QueryContext(ctx, qry, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var jobs []*Job
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
+
+// PruneJobs deletes finished jobs last touched before the given time
+func (j *JobRepo) PruneJobs(ctx context.Context, before time.Time) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, db.QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := j.DB.ExecContext(ctx, `delete from jobs where status = 'done' and updated_at < $1;`, before)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,482 @@
+package models
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/iamYole/go-movies/internal/db"
+	"github.com/lib/pq"
+)
+
+const (
+	ListPrivate = "private"
+	// ListUnlisted lists can be read by anyone with their link
+	ListUnlisted = "unlisted"
+	ListPublic   = "public"
+)
+
+// ListVisibilities are who may read a list through its slug
+var ListVisibilities = []string{ListPrivate, ListUnlisted, ListPublic}
+
+func IsListVisibility(visibility string) bool {
+	for _, v := range ListVisibilities {
+		if v == visibility {
+			return true
+		}
+	}
+	return false
+}
+
+// List is a user's ordered collection of movies. Every user has one
+// watchlist, created on first use, which cannot be deleted.
+type List struct {
+	ID          int       `json:"id"`
+	UserID      int       `json:"user_id"`
+	Owner       string    `json:"owner,omitempty"`
+	Name        string    `json:"name" validate:"required,max=100"`
+	Slug        string    `json:"slug"`
+	Description string    `json:"description" validate:"max=2000"`
+	Visibility  string    `json:"visibility" validate:"required,list_visibility"`
+	Watchlist   bool      `json:"watchlist"`
+	ItemCount   int       `json:"item_count"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	// Items are filled when a single list is read
+	Items []*ListItem `json:"items,omitempty"`
+}
+
+// ListItem is a movie's place in a list. Positions start at 1.
+type ListItem struct {
+	MovieID  int       `json:"movie_id"`
+	Position int       `json:"position" validate:"gte=0"`
+	Note     string    `json:"note" validate:"max=1000"`
+	AddedAt  time.Time `json:"added_at"`
+	// The movie's title, release date and image, filled on reads
+	Title       string     `json:"title,omitempty"`
+	ReleaseDate *time.Time `json:"release_date,omitempty"`
+	Image       string     `json:"image,omitempty"`
+}
+
+type ListRepo struct {
+	DB *sql.DB
+}
+
+// newSlug builds a list slug from its name and a random suffix, which keeps
+// slugs unique and unguessable for unlisted lists
+func newSlug(name string) (string, error) {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(name) {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			b.WriteRune(r)
+			dash = false
+		case !dash && b.Len() > 0:
+			b.WriteByte('-')
+			dash = true
+		}
+		if b.Len() >= 60 {
+			break
+		}
+	}
+	base := strings.TrimSuffix(b.String(), "-")
+	if base == "" {
+		base = "list"
+	}
+
+	suffix := make([]byte, 5)
+	if _, err := rand.Read(suffix); err != nil {
+		return "", err
+	}
+	return base + "-" + hex.EncodeToString(suffix), nil
+}
+
+// WatchlistID returns the id of the user's watchlist, creating it on first
+// use
+func (l *ListRepo) WatchlistID(ctx context.Context, userID int) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, db.QueryTimeoutDuration)
+	defer cancel()
+
+	var id int
+	err := l.DB.QueryRowContext(ctx, `select id from lists where user_id = $1 and is_watchlist`, userID).Scan(&id)
+	if err == nil {
+		return id, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return 0, err
+	}
+
+	slug, err := newSlug("watchlist")
+	if err != nil {
+		return 0, err
+	}
+	//a concurrent first use may have created it, in which case read it back
+	_, err = l.DB.ExecContext(ctx, `insert into lists (user_id, name, slug, visibility, is_watchlist, created_at, updated_at)
+			values ($1, 'Watchlist', $2, $3, true, $4, $4)
+			on conflict (user_id) where is_watchlist do nothing`, userID, slug, ListPrivate, time.Now())
+	if err != nil {
+		return 0, dbError("list", err)
+	}
+
+	err = l.DB.QueryRowContext(ctx, `select id from lists where user_id = $1 and is_watchlist`, userID).Scan(&id)
+	return id, err
+}
+
+// GetLists returns the user's lists, watchlist first, then by name
+func (l *ListRepo) GetLists(ctx context.Context, userID int) ([]*List, error) {
+	if _, err := l.WatchlistID(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	qry := `select l.id, l.user_id, l.name, l.slug, l.description, l.visibility, l.is_watchlist,
+				(select count(*) from list_items i where i.list_id = l.id), l.created_at, l.updated_at
+			from lists l
+			where l.user_id = $1
+			order by l.is_watchlist desc, lower(l.name), l.id;`
+
+	ctx, cancel := context.WithTimeout(ctx, db.QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := l.DB.QueryContext(ctx, qry, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lists := []*List{}
+	for rows.Next() {
+		var list List
+		err := rows.Scan(&list.ID, &list.UserID, &list.Name, &list.Slug, &list.Description, &list.Visibility,
+			&list.Watchlist, &list.ItemCount, &list.CreatedAt, &list.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		lists = append(lists, &list)
+	}
+	return lists, rows.Err()
+}
+
+// GetList returns one of the user's lists with its items in order
+func (l *ListRepo) GetList(ctx context.Context, userID, listID int) (*List, error) {
+	return l.getList(ctx, `l.id = $1 and l.user_id = $2`, listID, userID)
+}
+
+// GetListBySlug returns an unlisted or public list with its items in order.
+// Private lists are reported as not found.
+func (l *ListRepo) GetListBySlug(ctx context.Context, slug string) (*List, error) {
+	return l.getList(ctx, `l.slug = $1 and l.visibility <> 'private'`, slug)
+}
+
+func (l *ListRepo) getList(ctx context.Context, where string, args ...any) (*List, error) {
+	qry := `select l.id, l.user_id, u.first_name || ' ' || left(u.last_name, 1) || '.', l.name, l.slug,
+				l.description, l.visibility, l.is_watchlist, l.created_at, l.updated_at
+			from lists l
+				join users u on u.id = l.user_id
+			where ` + where
+
+	ctx, cancel := context.WithTimeout(ctx, db.QueryTimeoutDuration)
+	defer cancel()
+
+	var list List
+	err := l.DB.QueryRowContext(ctx, qry, args...).Scan(&list.ID, &list.UserID, &list.Owner, &list.Name, &list.Slug,
+		&list.Description, &list.Visibility, &list.Watchlist, &list.CreatedAt, &list.UpdatedAt)
+	if err != nil {
+		return nil, dbError("list", err)
+	}
+
+	qry = `select i.movie_id, i.position, i.note, i.added_at, m.title, m.release_date, coalesce(m.image, '')
+			from list_items i
+				join movies m on m.id = i.movie_id
+			where i.list_id = $1
+			order by i.position, i.added_at;`
+
+	rows, err := l.DB.QueryContext(ctx, qry, list.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list.Items = []*ListItem{}
+	for rows.Next() {
+		var item ListItem
+		var released time.Time
+		err := rows.Scan(&item.MovieID, &item.Position, &item.Note, &item.AddedAt, &item.Title, &released, &item.Image)
+		if err != nil {
+			return nil, err
+		}
+		item.ReleaseDate = &released
+		list.Items = append(list.Items, &item)
+	}
+	list.ItemCount = len(list.Items)
+	return &list, rows.Err()
+}
+
+func (l *ListRepo) InsertList(ctx context.Context, list List) (int, error) {
+	slug, err := newSlug(list.Name)
+	if err != nil {
+		return 0, err
+	}
+
+	stmt := `insert into lists (user_id, name, slug, description, visibility, created_at, updated_at)
+			values ($1, $2, $3, $4, $5, $6, $6)
+			returning id;`
+
+	ctx, cancel := context.WithTimeout(ctx, db.QueryTimeoutDuration)
+	defer cancel()
+
+	var id int
+	err = l.DB.QueryRowContext(ctx, stmt, list.UserID, list.Name, slug, list.Description, list.Visibility,
+		time.Now()).Scan(&id)
+	if err != nil {
+		return 0, dbError("list", err)
+	}
+	return id, nil
+}
+
+// UpdateList saves a list's name, description and visibility. The slug is
+// kept, so links already shared keep working.
+func (l *ListRepo) UpdateList(ctx context.Context, list List) error {
+	stmt := `update lists set name = $1, description = $2, visibility = $3, updated_at = $4
+			where id = $5 and user_id = $6;`
+
+	ctx, cancel := context.WithTimeout(ctx, db.QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := l.DB.ExecContext(ctx, stmt, list.Name, list.Description, list.Visibility, time.Now(),
+		list.ID, list.UserID)
+	if err != nil {
+		return dbError("list", err)
+	}
+	return expectRow(res, "list")
+}
+
+// DeleteList removes one of the user's custom lists with its items
+func (l *ListRepo) DeleteList(ctx context.Context, userID, listID int) error {
+	ctx, cancel := context.WithTimeout(ctx, db.QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := l.DB.ExecContext(ctx, `delete from lists where id = $1 and user_id = $2 and not is_watchlist`,
+		listID, userID)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil || n > 0 {
+		return err
+	}
+
+	//nothing deleted: tell a missing list from the watchlist
+	var watchlist bool
+	err = l.DB.QueryRowContext(ctx, `select is_watchlist from lists where id = $1 and user_id = $2`,
+		listID, userID).Scan(&watchlist)
+	if err != nil {
+		return dbError("list", err)
+	}
+	return Conflict("list", "the watchlist cannot be deleted")
+}
+
+// lockList checks the list belongs to the user and locks it, so item
+// positions change one writer at a time
+func lockList(ctx context.Context, tx *sql.Tx, userID, listID int) error {
+	var id int
+	err := tx.QueryRowContext(ctx, `select id from lists where id = $1 and user_id = $2 for update`,
+		listID, userID).Scan(&id)
+	return dbError("list", err)
+}
+
+func touchList(ctx context.Context, tx *sql.Tx, listID int) error {
+	_, err := tx.ExecContext(ctx, `update lists set updated_at = $1 where id = $2`, time.Now(), listID)
+	return err
+}
+
+// AddListItem adds a movie to a list at item.Position, moving later items
+// down. A zero or out of range position adds it at the end.
+func (l *ListRepo) AddListItem(ctx context.Context, userID, listID int, item ListItem) error {
+	ctx, cancel := context.WithTimeout(ctx, db.QueryTimeoutDuration)
+	defer cancel()
+
+	tx, err := l.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := lockList(ctx, tx, userID, listID); err != nil {
+		return err
+	}
+	if err := requireMovie(ctx, tx, item.MovieID); err != nil {
+		return err
+	}
+
+	var count int
+	if err := tx.QueryRowContext(ctx, `select count(*) from list_items where list_id = $1`, listID).Scan(&count); err != nil {
+		return err
+	}
+	position := item.Position
+	if position <= 0 || position > count {
+		position = count + 1
+	} else {
+		_, err = tx.ExecContext(ctx, `update list_items set position = position + 1 where list_id = $1 and position >= $2`,
+			listID, position)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, `insert into list_items (list_id, movie_id, position, note, added_at)
+			values ($1, $2, $3, $4, $5)`, listID, item.MovieID, position, item.Note, time.Now())
+	if err != nil {
+		err = dbError("list item", err)
+		if errors.Is(err, ErrConflict) {
+			return Conflict("list item", "the movie is already in this list")
+		}
+		return err
+	}
+
+	if err := touchList(ctx, tx, listID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// UpdateListItem changes the note on a movie in a list
+func (l *ListRepo) UpdateListItem(ctx context.Context, userID, listID, movieID int, note string) error {
+	ctx, cancel := context.WithTimeout(ctx, db.QueryTimeoutDuration)
+	defer cancel()
+
+	tx, err := l.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := lockList(ctx, tx, userID, listID); err != nil {
+		return err
+	}
+
+	res, err := tx.ExecContext(ctx, `update list_items set note = $1 where list_id = $2 and movie_id = $3`,
+		note, listID, movieID)
+	if err != nil {
+		return err
+	}
+	if err := expectRow(res, "list item"); err != nil {
+		return err
+	}
+
+	if err := touchList(ctx, tx, listID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// RemoveListItem takes a movie out of a list, closing the gap it leaves
+func (l *ListRepo) RemoveListItem(ctx context.Context, userID, listID, movieID int) error {
+	ctx, cancel := context.WithTimeout(ctx, db.QueryTimeoutDuration)
+	defer cancel()
+
+	tx, err := l.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := lockList(ctx, tx, userID, listID); err != nil {
+		return err
+	}
+
+	var position int
+	err = tx.QueryRowContext(ctx, `delete from list_items where list_id = $1 and movie_id = $2 returning position`,
+		listID, movieID).Scan(&position)
+	if err != nil {
+		return dbError("list item", err)
+	}
+
+	_, err = tx.ExecContext(ctx, `update list_items set position = position - 1 where list_id = $1 and position > $2`,
+		listID, position)
+	if err != nil {
+		return err
+	}
+
+	if err := touchList(ctx, tx, listID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ReorderList puts a list's movies in the given order, which must name
+// every movie in the list exactly once
+func (l *ListRepo) ReorderList(ctx context.Context, userID, listID int, movieIDs []int) error {
+	ctx, cancel := context.WithTimeout(ctx, db.QueryTimeoutDuration)
+	defer cancel()
+
+	tx, err := l.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := lockList(ctx, tx, userID, listID); err != nil {
+		return err
+	}
+
+	var count, matched int
+	err = tx.QueryRowContext(ctx, `select count(*), count(*) filter (where movie_id = any($2))
+			from list_items where list_id = $1`, listID, pq.Array(movieIDs)).Scan(&count, &matched)
+	if err != nil {
+		return err
+	}
+	if count != len(movieIDs) || matched != count || hasDuplicates(movieIDs) {
+		return Invalid("list", "the order must name every movie in the list exactly once")
+	}
+
+	_, err = tx.ExecContext(ctx, `update list_items i set position = o.position
+			from unnest($2::int[]) with ordinality as o(movie_id, position)
+			where i.list_id = $1 and i.movie_id = o.movie_id`, listID, pq.Array(movieIDs))
+	if err != nil {
+		return err
+	}
+
+	if err := touchList(ctx, tx, listID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func hasDuplicates(ids []int) bool {
+	seen := make(map[int]bool, len(ids))
+	for _, id := range ids {
+		if seen[id] {
+			return true
+		}
+		seen[id] = true
+	}
+	return false
+}
+
+// WatchlistFlags reports which of the movies are on the user's watchlist
+func (l *ListRepo) WatchlistFlags(ctx context.Context, userID int, movieIDs []int) (map[int]bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, db.QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := l.DB.QueryContext(ctx, `select i.movie_id from list_items i
+				join lists l on l.id = i.list_id
+			where l.user_id = $1 and l.is_watchlist and i.movie_id = any($2)`, userID, pq.Array(movieIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	flags := make(map[int]bool, len(movieIDs))
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		flags[id] = true
+	}
+	return flags, rows.Err()
+}
@@ -0,0 +1,220 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/iamYole/go-movies/internal/db"
+)
+
+// CommentActions are the moderator decisions on a comment
+var CommentActions = []string{"approve", "hide", "delete"}
+
+// ModerationAction is an entry in the moderation log. ModeratorID is nil
+// for the automatic queueing of a comment.
+type ModerationAction struct {
+	ID          int       `json:"id"`
+	Action      string    `json:"action"`
+	ModeratorID *int      `json:"moderator_id,omitempty"`
+	CommentID   *int      `json:"comment_id,omitempty"`
+	UserID      *int      `json:"user_id,omitempty"`
+	Reason      string    `json:"reason,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// QueuedComment is a comment waiting in the moderation queue
+type QueuedComment struct {
+	Comment
+	QueueReason string         `json:"queue_reason"`
+	ReportCount int            `json:"report_count"`
+	Reports     map[string]int `json:"reports,omitempty"`
+}
+
+// ActionFilter narrows the moderation log to a comment or a user
+type ActionFilter struct {
+	CommentID int
+	UserID    int
+	Limit     int
+	Offset    int
+}
+
+func logAction(ctx context.Context, tx *sql.Tx, a ModerationAction) error {
+	_, err := tx.ExecContext(ctx, `insert into moderation_actions (action, moderator_id, comment_id, user_id, reason, created_at)
+			values ($1, $2, $3, $4, $5, $6)`, a.Action, a.ModeratorID, a.CommentID, a.UserID, a.Reason, time.Now())
+	return err
+}
+
+// GetModerationQueue lists pending comments, longest waiting first, with
+// their reports tallied by reason
+func (c *CommentRepo) GetModerationQueue(ctx context.Context, limit, offset int) ([]*QueuedComment, error) {
+	if limit <= 0 {
+		limit = 50
+	}
+
+	qry := `select c.id, c.movie_id, c.user_id, u.first_name || ' ' || u.last_name, c.parent_id, c.body, c.status,
+				c.created_at, c.queue_reason, c.report_count
+			from comments c
+				join users u on u.id = c.user_id
+			where c.status = 'pending'
+			order by c.updated_at, c.id
+			limit $1 offset $2;`
+
+	ctx, cancel := context.WithTimeout(ctx, db.QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := c.DB.QueryContext(ctx, qry, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	queue := []*QueuedComment{}
+	var ids []int
+	for rows.Next() {
+		var q QueuedComment
+		err := rows.Scan(&q.ID, &q.MovieID, &q.UserID, &q.Author, &q.ParentID, &q.Body, &q.Status,
+			&q.CreatedAt, &q.QueueReason, &q.ReportCount)
+		if err != nil {
+			return nil, err
+		}
+		queue = append(queue, &q)
+		ids = append(ids, q.ID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return queue, nil
+	}
+
+	tally, err := reportTally(ctx, c.DB, ids)
+	if err != nil {
+		return nil, err
+	}
+	for _, q := range queue {
+		q.Reports = tally[q.ID]
+	}
+	return queue, nil
+}
+
+// ModerateComment applies a moderator's decision to a comment and logs it.
+// Approving clears the comment's reports, so only new reports can queue it
+// again; deleting removes its text but keeps its replies.
+func (c *CommentRepo) ModerateComment(ctx context.Context, commentID, moderatorID int, action, reason string) error {
+	var set string
+	switch action {
+	case "approve":
+		set = `status = 'visible', queue_reason = '', report_count = 0`
+	case "hide":
+		set = `status = 'hidden', queue_reason = ''`
+	case "delete":
+		set = `status = 'deleted', queue_reason = '', body = ''`
+	default:
+		return fmt.Errorf("unknown comment action %q", action)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, db.QueryTimeoutDuration)
+	defer cancel()
+
+	tx, err := c.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var author int
+	err = tx.QueryRowContext(ctx, fmt.Sprintf(`update comments set %s, updated_at = $1 where id = $2 returning user_id`, set),
+		time.Now(), commentID).Scan(&author)
+	if err != nil {
+		return dbError("comment", err)
+	}
+
+	entry := ModerationAction{Action: action, ModeratorID: moderatorRef(moderatorID), CommentID: &commentID,
+		UserID: &author, Reason: reason}
+	if err := logAction(ctx, tx, entry); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// WarnUser records a warning against a user, optionally about a comment
+func (c *CommentRepo) WarnUser(ctx context.Context, userID, moderatorID int, commentID *int, reason string) error {
+	return c.sanctionUser(ctx, `warning_count = warning_count + 1`, nil,
+		ModerationAction{Action: "warn", ModeratorID: moderatorRef(moderatorID), CommentID: commentID, UserID: &userID, Reason: reason})
+}
+
+// SuspendUser stops a user posting until the given time
+func (c *CommentRepo) SuspendUser(ctx context.Context, userID, moderatorID int, commentID *int, until time.Time, reason string) error {
+	return c.sanctionUser(ctx, `suspended_until = $3`, []any{until},
+		ModerationAction{Action: "suspend", ModeratorID: moderatorRef(moderatorID), CommentID: commentID, UserID: &userID,
+			Reason: fmt.Sprintf("until %s: %s", until.UTC().Format(time.RFC3339), reason)})
+}
+
+func (c *CommentRepo) sanctionUser(ctx context.Context, set string, args []any, entry ModerationAction) error {
+	ctx, cancel := context.WithTimeout(ctx, db.QueryTimeoutDuration)
+	defer cancel()
+
+	tx, err := c.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, fmt.Sprintf(`update users set %s, updated_at = $1 where id = $2`, set),
+		append([]any{time.Now(), *entry.UserID}, args...)...)
+	if err != nil {
+		return err
+	}
+	if err := expectRow(res, "user"); err != nil {
+		return err
+	}
+
+	if err := logAction(ctx, tx, entry); err != nil {
+		return dbError("comment", err)
+	}
+	return tx.Commit()
+}
+
+// GetModerationActions lists the moderation log, newest first
+func (c *CommentRepo) GetModerationActions(ctx context.Context, filter ActionFilter) ([]*ModerationAction, error) {
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = 50
+	}
+
+	qry := `select id, action, moderator_id, comment_id, user_id, reason, created_at
+			from moderation_actions
+			where ($1 = 0 or comment_id = $1) and ($2 = 0 or user_id = $2)
+			order by created_at desc, id desc
+			limit $3 offset $4;`
+
+	ctx, cancel := context.WithTimeout(ctx, db.QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := c.DB.QueryContext(ctx, qry, filter.CommentID, filter.UserID, limit, filter.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	actions := []*ModerationAction{}
+	for rows.Next() {
+		var a ModerationAction
+		err := rows.Scan(&a.ID, &a.Action, &a.ModeratorID, &a.CommentID, &a.UserID, &a.Reason, &a.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		actions = append(actions, &a)
+	}
+	return actions, rows.Err()
+}
+
+// moderatorRef stores an unknown moderator as null
+func moderatorRef(id int) *int {
+	if id == 0 {
+		return nil
+	}
+	return &id
+}
@@ -3,52 +3,314 @@ package models
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
 	"time"
 
 	"github.com/iamYole/go-movies/internal/db"
+	"github.com/lib/pq"
 )
 
+
 type Movie struct {
 	ID          int       `json:"id"`
-	Title       string    `json:"title"`
-	ReleaseDate time.Time `json:"release_date"`
-	Runtime     int       `json:"runtime"`
-	MPAARating  string    `json:"mpaa_rating"`
+	Title       string    `json:"title" validate:"required,max=255"`
+	ReleaseDate time.Time `json:"release_date" validate:"required,release_date"`
+	Runtime     int       `json:"runtime" validate:"gt=0"`
+	MPAARating  string    `json:"mpaa_rating" validate:"required,mpaa"`
 	Description string    `json:"description"`
 	Image       string    `json:"image"`
-	CreatedAt   time.Time `json:"-"`
-	UpdatedAt   time.Time `json:"-"`
-	Genres      []*Genre  `json:"genres,omitempty"`
-	GenresArray []int     `json:"genres_array,omitempty"`
+	Backdrop    string    `json:"backdrop"`
+	// OriginalLanguage is an ISO 639-1 code
+	OriginalLanguage string `json:"original_language" validate:"omitempty,len=2,lowercase"`
+	Tagline          string `json:"tagline"`
+	// LockedFields are fields an editor has set by hand, which TMDB sync
+	// must leave alone
+	LockedFields []string   `json:"locked_fields" validate:"dive,synced_field"`
+	SyncedAt     *time.Time `json:"tmdb_synced_at,omitempty"`
+	// PosterImageID and BackdropImageID point at stored artwork. They are set
+	// by uploads and artwork downloads only, and surface as Artwork links.
+	PosterImageID   *int64                `json:"-"`
+	BackdropImageID *int64                `json:"-"`
+	Artwork         map[string]ImageLinks `json:"artwork,omitempty"`
+	// AverageRating and RatingCount summarise user ratings; they are read
+	// only and kept up to date by every rating write
+	AverageRating float64 `json:"average_rating"`
+	RatingCount   int     `json:"rating_count"`
+	CreatedAt       time.Time             `json:"-"`
+	UpdatedAt       time.Time             `json:"-"`
+	Genres          []*Genre              `json:"genres,omitempty"`
+	GenresArray     []int                 `json:"genres_array,omitempty"`
+	Version         int                   `json:"version"`
+	// ExternalIDs maps a catalog such as imdb or tmdb to the movie's id there.
+	// It is managed through the external id endpoints, not movie edits.
+	ExternalIDs map[string]string `json:"external_ids,omitempty"`
+	// Cast is the top billed cast, embedded on request; credits are managed
+	// through the credit endpoints
+	Cast []*Credit `json:"cast,omitempty"`
+	// InWatchlist is set for signed in callers only
+	InWatchlist *bool `json:"in_watchlist,omitempty"`
 }
 
 type Genre struct {
 	ID        int       `json:"id"`
 	Genre     string    `json:"genre"`
+	TMDBID    *int      `json:"tmdb_id,omitempty"`
 	Checked   bool      `json:"checked"`
 	CreatedAt time.Time `json:"-"`
 	UpdatedAt time.Time `json:"-"`
 }
 
+// MPAARatings are the ratings a movie may carry, NR being not rated
+var MPAARatings = []string{"G", "PG", "PG13", "R", "NC17", "18A", "NR"}
+
+func IsMPAARating(rating string) bool {
+	for _, r := range MPAARatings {
+		if r == rating {
+			return true
+		}
+	}
+	return false
+}
+
+// ErrEditConflict is returned when a write carries a stale movie version; it is
+// also an ErrConflict
+var ErrEditConflict = &Error{Kind: ErrConflict, Resource: "movie", Message: "movie has been modified"}
+
 type MovieRepo struct {
 	DB *sql.DB
 }
 
+// InsertMovie saves a new movie with its genres and records it as the first
+// revision, all in one transaction
 func (m *MovieRepo) InsertMovie(ctx context.Context, movie Movie)(int64, error){
 	stmt := `insert into movies 
-				(title,release_date,runtime,mpaa_rating,description,image,created_at,updated_at)
-			values($1,$2,$3,$4,$5,$6,$7,$8) RETURNING id, created_at;`
+				(title,release_date,runtime,mpaa_rating,description,image,backdrop,original_language,tagline,locked_fields,created_at,updated_at)
+			values($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12) RETURNING id, created_at, version;`
 
 	ctx, cancel := context.WithTimeout(ctx, db.QueryTimeoutDuration)
 	defer cancel()
 
-	err:= m.DB.QueryRowContext(ctx,stmt,movie.Title,movie.ReleaseDate,movie.Runtime,movie.MPAARating,
-					movie.Description,movie.Image,time.Now(),time.Now()).Scan(&movie.ID,&movie.CreatedAt)
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx,stmt,movie.Title,movie.ReleaseDate,movie.Runtime,movie.MPAARating,
+					movie.Description,movie.Image,movie.Backdrop,movie.OriginalLanguage,movie.Tagline,
+					pq.Array(lockedFields(movie.LockedFields)),time.Now(),time.Now()).Scan(&movie.ID,&movie.CreatedAt,&movie.Version)
 	if err!=nil{
-		return 0,err
+		return 0,dbError("movie", err)
+	}
+
+	if err := replaceGenres(ctx, tx, movie.ID, movie.GenresArray); err != nil {
+		return 0, err
+	}
+	if _, err := insertRevision(ctx, tx, movie); err != nil {
+		return 0, err
+	}
+
+	return int64(movie.ID), tx.Commit()
+}
+
+// movieFields are the editable movie fields, keyed by their JSON name
+var movieFields = []string{"title", "release_date", "runtime", "mpaa_rating", "description", "image",
+	"backdrop", "original_language", "tagline", "locked_fields", "genres_array"}
+
+// SyncedFields are the fields TMDB sync may write, and so the ones an editor
+// can lock
+var SyncedFields = []string{"release_date", "runtime", "description", "image",
+	"backdrop", "original_language", "tagline", "genres_array"}
+
+func IsSyncedField(field string) bool {
+	for _, f := range SyncedFields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+// IsLocked reports whether field has been locked by an editor
+func (m *Movie) IsLocked(field string) bool {
+	for _, f := range m.LockedFields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+// LockChanged locks the synced fields of movie that differ from current, so
+// a sync never undoes an editor's change
+func (m *Movie) LockChanged(current Movie) {
+	for _, change := range DiffMovies(current, *m) {
+		if IsSyncedField(change.Field) && !m.IsLocked(change.Field) {
+			m.LockedFields = append(m.LockedFields, change.Field)
+		}
+	}
+}
+
+// requiredSyncedFields must be given to create a movie, so having them says
+// nothing about whether the editor wants to keep them
+var requiredSyncedFields = []string{"release_date", "runtime"}
+
+// LockOptional locks the optional synced fields a new movie was given. The
+// required ones stay open so sync can still correct them.
+func (m *Movie) LockOptional() {
+	for _, change := range DiffMovies(Movie{}, *m) {
+		if IsSyncedField(change.Field) && !slices.Contains(requiredSyncedFields, change.Field) && !m.IsLocked(change.Field) {
+			m.LockedFields = append(m.LockedFields, change.Field)
+		}
+	}
+}
+
+// lockedFields never hands the driver a nil slice, which it would store as null
+func lockedFields(fields []string) []string {
+	if fields == nil {
+		return []string{}
+	}
+	return fields
+}
+
+// UpdateMovie saves the editable fields and genres of movie and records the
+// new state as a revision. movie.Version must match the stored version unless
+// it is zero; the new revision and version are returned.
+func (m *MovieRepo) UpdateMovie(ctx context.Context, movie Movie) (int, int, error) {
+	return m.PatchMovie(ctx, movie, movieFields)
+}
+
+// PatchMovie is UpdateMovie restricted to the named fields. The revision still
+// records the whole of movie, so it must hold the complete patched state.
+func (m *MovieRepo) PatchMovie(ctx context.Context, movie Movie, fields []string) (int, int, error) {
+	ctx, cancel := context.WithTimeout(ctx, db.QueryTimeoutDuration)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer tx.Rollback()
+
+	set := "updated_at = $1, version = version + 1"
+	args := []any{time.Now()}
+	updateGenres := false
+
+	for _, field := range fields {
+		var value any
+		switch field {
+		case "title":
+			value = movie.Title
+		case "release_date":
+			value = movie.ReleaseDate
+		case "runtime":
+			value = movie.Runtime
+		case "mpaa_rating":
+			value = movie.MPAARating
+		case "description":
+			value = movie.Description
+		case "image":
+			value = movie.Image
+		case "backdrop":
+			value = movie.Backdrop
+		case "original_language":
+			value = movie.OriginalLanguage
+		case "tagline":
+			value = movie.Tagline
+		case "locked_fields":
+			value = pq.Array(lockedFields(movie.LockedFields))
+		case "genres_array":
+			updateGenres = true
+			continue
+		default:
+			return 0, 0, fmt.Errorf("unknown movie field %q", field)
+		}
+		args = append(args, value)
+		set += fmt.Sprintf(", %s = $%d", field, len(args))
+	}
+
+	args = append(args, movie.ID, movie.Version)
+	stmt := fmt.Sprintf(`update movies set %s
+			where id = $%d and ($%d = 0 or version = $%d)
+			RETURNING version;`, set, len(args)-1, len(args), len(args))
+
+	var version int
+	err = tx.QueryRowContext(ctx, stmt, args...).Scan(&version)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, 0, m.versionError(ctx, movie.ID)
+		}
+		return 0, 0, dbError("movie", err)
+	}
+	movie.Version = version
+
+	if updateGenres {
+		if err := replaceGenres(ctx, tx, movie.ID, movie.GenresArray); err != nil {
+			return 0, 0, err
+		}
+	}
+
+	revision, err := insertRevision(ctx, tx, movie)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return revision, version, tx.Commit()
+}
+
+// replaceGenres sets the genres of a movie within tx
+func replaceGenres(ctx context.Context, tx *sql.Tx, movieID int, genreIDs []int) error {
+	if _, err := tx.ExecContext(ctx, `delete from movies_genres where movie_id = $1`, movieID); err != nil {
+		return err
+	}
+
+	for _, n := range genreIDs {
+		stmt := `insert into movies_genres (movie_id, genre_id) values ($1, $2)`
+		if _, err := tx.ExecContext(ctx, stmt, movieID, n); err != nil {
+			return dbError("genre", err)
+		}
+	}
+	return nil
+}
+
+// DeleteMovie removes a movie if version matches the stored version, or
+// unconditionally when version is zero
+func (m *MovieRepo) DeleteMovie(ctx context.Context, movieID int64, version int) error {
+	ctx, cancel := context.WithTimeout(ctx, db.QueryTimeoutDuration)
+	defer cancel()
+
+	stmt := `delete from movies where id = $1 and ($2 = 0 or version = $2);`
+
+	res, err := m.DB.ExecContext(ctx, stmt, movieID, version)
+	if err != nil {
+		return err
 	}
 
-	return int64(movie.ID), nil
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return m.versionError(ctx, int(movieID))
+	}
+
+	return nil
+}
+
+// versionError tells a missing movie apart from a stale version after a
+// conditional write matched no rows
+func (m *MovieRepo) versionError(ctx context.Context, movieID int) error {
+	var exists bool
+	err := m.DB.QueryRowContext(ctx, `select exists(select 1 from movies where id = $1)`, movieID).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return NotFound("movie")
+	}
+	return ErrEditConflict
 }
 
 func (m *MovieRepo) UpdateMovieGenres(ctx context.Context, id int, genreIDs []int) error{
@@ -66,26 +328,29 @@ func (m *MovieRepo) UpdateMovieGenres(ctx context.Context, id int, genreIDs []in
 		stmt := `insert into movies_genres (movie_id, genre_id) values ($1, $2)`
 		_, err := m.DB.ExecContext(ctx, stmt, id, n)
 		if err != nil {
-			return err
+			return dbError("genre", err)
 		}
 	}
 
 	return nil
 }
 
-func (m *MovieRepo) GetMovies(ctx context.Context) ([]*Movie, error) {
+func (m *MovieRepo) GetMovies(ctx context.Context, filter MovieFilter) ([]*Movie, error) {
 	var movies []*Movie
+	var args []any
 	qry := `select 
 				m.id, m.title, m.release_date, m.runtime, m.mpaa_rating,
-				m.description ,coalesce(m.image,'') ,m.created_at ,m.updated_at 
+				m.description ,coalesce(m.image,'') ,m.poster_image_id ,m.backdrop_image_id ,
+				m.rating_count ,m.rating_sum ,m.created_at ,m.updated_at ,m.version
 			from 
 				movies m
+			where ` + filter.where(&args) + `
 			order by m.title;`
 
 	ctx, cancel := context.WithTimeout(ctx, db.QueryTimeoutDuration)
 	defer cancel()
 
-	rows, err := m.DB.QueryContext(ctx, qry)
+	rows, err := m.DB.QueryContext(ctx, qry, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -93,6 +358,7 @@ func (m *MovieRepo) GetMovies(ctx context.Context) ([]*Movie, error) {
 
 	for rows.Next() {
 		var m Movie
+		var ratingSum int
 		err := rows.Scan(
 			&m.ID,
 			&m.Title,
@@ -101,12 +367,19 @@ func (m *MovieRepo) GetMovies(ctx context.Context) ([]*Movie, error) {
 			&m.MPAARating,
 			&m.Description,
 			&m.Image,
+			&m.PosterImageID,
+			&m.BackdropImageID,
+			&m.RatingCount,
+			&ratingSum,
 			&m.CreatedAt,
 			&m.UpdatedAt,
+			&m.Version,
 		)
 		if err != nil {
 			return nil, err
 		}
+		m.setArtwork()
+		m.AverageRating = ratingAverage(ratingSum, m.RatingCount)
 
 		movies = append(movies, &m)
 	}
@@ -116,8 +389,10 @@ func (m *MovieRepo) GetMovies(ctx context.Context) ([]*Movie, error) {
 
 func (m *MovieRepo) GetMovieByID(ctx context.Context, movieID int64) (*Movie, error) {
 	var movie Movie
+	var ratingSum int
 	qry := `select m.id, m.title, m.release_date,m.runtime,m.mpaa_rating ,m.description ,
-				   coalesce(m.image,'') ,m.created_at ,m.updated_at 
+				   coalesce(m.image,'') ,m.backdrop ,m.original_language ,m.tagline ,m.locked_fields ,
+				   m.tmdb_synced_at ,m.poster_image_id ,m.backdrop_image_id ,m.rating_count ,m.rating_sum ,m.created_at ,m.updated_at ,m.version
 			from movies m
 			where m.id= $1;`
 
@@ -133,18 +408,30 @@ func (m *MovieRepo) GetMovieByID(ctx context.Context, movieID int64) (*Movie, er
 		&movie.MPAARating,
 		&movie.Description,
 		&movie.Image,
+		&movie.Backdrop,
+		&movie.OriginalLanguage,
+		&movie.Tagline,
+		pq.Array(&movie.LockedFields),
+		&movie.SyncedAt,
+		&movie.PosterImageID,
+		&movie.BackdropImageID,
+		&movie.RatingCount,
+		&ratingSum,
 		&movie.CreatedAt,
 		&movie.UpdatedAt,
+		&movie.Version,
 	)
 	if err != nil {
-		return nil, err
+		return nil, dbError("movie", err)
 	}
+	movie.setArtwork()
+	movie.AverageRating = ratingAverage(ratingSum, movie.RatingCount)
 
 	qry = `select g.id, g.genre 
 		   from movies_genres mg 
 				left join genres g 
-				on mg.id =g.id 
-			where g.id =$1
+				on mg.genre_id =g.id 
+			where mg.movie_id =$1
 			order by g.genre;`
 
 	rows, err := m.DB.QueryContext(ctx,qry,movieID)
@@ -168,13 +455,20 @@ func (m *MovieRepo) GetMovieByID(ctx context.Context, movieID int64) (*Movie, er
 	}
 	movie.Genres=genres
 
+	movie.ExternalIDs, err = loadExternalIDs(ctx, m.DB, movie.ID)
+	if err != nil {
+		return nil, err
+	}
+
 	return &movie, nil
 }
 
 func (m *MovieRepo) EditMovie(ctx context.Context, movieID int64) (*Movie, []*Genre, error) {
 	var movie Movie
+	var ratingSum int
 	qry := `select m.id, m.title, m.release_date,m.runtime,m.mpaa_rating ,m.description ,
-				   coalesce(m.image,'') ,m.created_at ,m.updated_at 
+				   coalesce(m.image,'') ,m.backdrop ,m.original_language ,m.tagline ,m.locked_fields ,
+				   m.tmdb_synced_at ,m.poster_image_id ,m.backdrop_image_id ,m.rating_count ,m.rating_sum ,m.created_at ,m.updated_at ,m.version
 			from movies m
 			where m.id= $1;`
 
@@ -190,18 +484,30 @@ func (m *MovieRepo) EditMovie(ctx context.Context, movieID int64) (*Movie, []*Ge
 		&movie.MPAARating,
 		&movie.Description,
 		&movie.Image,
+		&movie.Backdrop,
+		&movie.OriginalLanguage,
+		&movie.Tagline,
+		pq.Array(&movie.LockedFields),
+		&movie.SyncedAt,
+		&movie.PosterImageID,
+		&movie.BackdropImageID,
+		&movie.RatingCount,
+		&ratingSum,
 		&movie.CreatedAt,
 		&movie.UpdatedAt,
+		&movie.Version,
 	)
 	if err != nil {
-		return nil,nil, err
+		return nil,nil, dbError("movie", err)
 	}
+	movie.setArtwork()
+	movie.AverageRating = ratingAverage(ratingSum, movie.RatingCount)
 
 	qry = `select g.id, g.genre 
 		   from movies_genres mg 
 				left join genres g 
-				on mg.id =g.id 
-			where g.id =$1
+				on mg.genre_id =g.id 
+			where mg.movie_id =$1
 			order by g.genre;`
 
 	rows, err := m.DB.QueryContext(ctx,qry,movieID)
@@ -229,8 +535,13 @@ func (m *MovieRepo) EditMovie(ctx context.Context, movieID int64) (*Movie, []*Ge
 	movie.Genres=genres
 	movie.GenresArray = genresArray
 
+	movie.ExternalIDs, err = loadExternalIDs(ctx, m.DB, movie.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+
 	var allGenres []*Genre
-	qry = "select id, genre, from genres order by genre"
+	qry = "select id, genre from genres order by genre"
 	gRows, err := m.DB.QueryContext(ctx, qry)
 	if err != nil {
 		return nil, nil, err
@@ -254,7 +565,7 @@ func (m *MovieRepo) EditMovie(ctx context.Context, movieID int64) (*Movie, []*Ge
 }
 
 func (m *MovieRepo) GetAllGenres(ctx context.Context)([]*Genre, error){
-	qry := `select g.id ,g.genre ,g.created_at ,g.updated_at
+	qry := `select g.id ,g.genre ,g.tmdb_id ,g.created_at ,g.updated_at
 		    from genres g
 			order by g.genre;`
 
@@ -274,6 +585,7 @@ func (m *MovieRepo) GetAllGenres(ctx context.Context)([]*Genre, error){
 		err:= rows.Scan(
 			&g.ID,
 			&g.Genre,
+			&g.TMDBID,
 			&g.CreatedAt,
 			&g.UpdatedAt,
 		)
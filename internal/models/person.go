@@ -0,0 +1,272 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/iamYole/go-movies/internal/db"
+)
+
+// CreditRoles are the parts a person may have in a movie
+var CreditRoles = []string{"actor", "director", "writer", "composer"}
+
+func IsCreditRole(role string) bool {
+	for _, r := range CreditRoles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+type Person struct {
+	ID        int        `json:"id"`
+	Name      string     `json:"name" validate:"required,max=255"`
+	Biography string     `json:"biography"`
+	BirthDate *time.Time `json:"birth_date,omitempty"`
+	DeathDate *time.Time `json:"death_date,omitempty"`
+	CreatedAt time.Time  `json:"-"`
+	UpdatedAt time.Time  `json:"-"`
+	// Filmography lists the person's credits, newest movie first. It is
+	// read only and filled by GetPerson.
+	Filmography []*Credit `json:"filmography,omitempty"`
+}
+
+// Credit is a person's part in a movie. Lower billing orders are billed
+// first.
+type Credit struct {
+	ID           int    `json:"id"`
+	MovieID      int    `json:"movie_id"`
+	PersonID     int    `json:"person_id" validate:"required"`
+	Role         string `json:"role" validate:"required,credit_role"`
+	Character    string `json:"character,omitempty" validate:"max=255"`
+	BillingOrder int    `json:"billing_order" validate:"gte=0"`
+	// The name and title of the two sides of the credit, filled on reads
+	PersonName  string     `json:"person_name,omitempty"`
+	MovieTitle  string     `json:"movie_title,omitempty"`
+	ReleaseDate *time.Time `json:"release_date,omitempty"`
+}
+
+// PersonFilter narrows a people listing; Name matches anywhere in the name,
+// with names starting with it listed first
+type PersonFilter struct {
+	Name   string
+	Limit  int
+	Offset int
+}
+
+type PersonRepo struct {
+	DB *sql.DB
+}
+
+func (p *PersonRepo) GetPeople(ctx context.Context, filter PersonFilter) ([]*Person, error) {
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = 50
+	}
+	name := escapeLike(filter.Name)
+
+	qry := `select p.id, p.name, p.biography, p.birth_date, p.death_date, p.created_at, p.updated_at
+			from people p
+			where p.name ilike '%' || $1 || '%'
+			order by p.name ilike $1 || '%' desc, p.name, p.id
+			limit $2 offset $3;`
+
+	ctx, cancel := context.WithTimeout(ctx, db.QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := p.DB.QueryContext(ctx, qry, name, limit, filter.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	people := []*Person{}
+	for rows.Next() {
+		var person Person
+		err := rows.Scan(&person.ID, &person.Name, &person.Biography, &person.BirthDate, &person.DeathDate,
+			&person.CreatedAt, &person.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		people = append(people, &person)
+	}
+	return people, rows.Err()
+}
+
+// GetPerson returns a person with their filmography
+func (p *PersonRepo) GetPerson(ctx context.Context, id int) (*Person, error) {
+	qry := `select p.id, p.name, p.biography, p.birth_date, p.death_date, p.created_at, p.updated_at
+			from people p
+			where p.id = $1;`
+
+	ctx, cancel := context.WithTimeout(ctx, db.QueryTimeoutDuration)
+	defer cancel()
+
+	var person Person
+	err := p.DB.QueryRowContext(ctx, qry, id).Scan(&person.ID, &person.Name, &person.Biography,
+		&person.BirthDate, &person.DeathDate, &person.CreatedAt, &person.UpdatedAt)
+	if err != nil {
+		return nil, dbError("person", err)
+	}
+
+	qry = `select c.id, c.movie_id, c.person_id, c.role, c.character, c.billing_order, m.title, m.release_date
+			from movie_credits c
+				join movies m on m.id = c.movie_id
+			where c.person_id = $1
+			order by m.release_date desc, m.title, c.role;`
+
+	rows, err := p.DB.QueryContext(ctx, qry, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	person.Filmography = []*Credit{}
+	for rows.Next() {
+		var c Credit
+		var released time.Time
+		err := rows.Scan(&c.ID, &c.MovieID, &c.PersonID, &c.Role, &c.Character, &c.BillingOrder,
+			&c.MovieTitle, &released)
+		if err != nil {
+			return nil, err
+		}
+		c.ReleaseDate = &released
+		person.Filmography = append(person.Filmography, &c)
+	}
+	return &person, rows.Err()
+}
+
+func (p *PersonRepo) InsertPerson(ctx context.Context, person Person) (int, error) {
+	stmt := `insert into people (name, biography, birth_date, death_date, created_at, updated_at)
+			values ($1, $2, $3, $4, $5, $5)
+			returning id;`
+
+	ctx, cancel := context.WithTimeout(ctx, db.QueryTimeoutDuration)
+	defer cancel()
+
+	var id int
+	err := p.DB.QueryRowContext(ctx, stmt, person.Name, person.Biography, person.BirthDate, person.DeathDate,
+		time.Now()).Scan(&id)
+	if err != nil {
+		return 0, dbError("person", err)
+	}
+	return id, nil
+}
+
+func (p *PersonRepo) UpdatePerson(ctx context.Context, person Person) error {
+	stmt := `update people set name = $1, biography = $2, birth_date = $3, death_date = $4, updated_at = $5
+			where id = $6;`
+
+	ctx, cancel := context.WithTimeout(ctx, db.QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := p.DB.ExecContext(ctx, stmt, person.Name, person.Biography, person.BirthDate, person.DeathDate,
+		time.Now(), person.ID)
+	if err != nil {
+		return dbError("person", err)
+	}
+	return expectRow(res, "person")
+}
+
+// DeletePerson removes a person along with their credits
+func (p *PersonRepo) DeletePerson(ctx context.Context, id int) error {
+	ctx, cancel := context.WithTimeout(ctx, db.QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := p.DB.ExecContext(ctx, `delete from people where id = $1`, id)
+	if err != nil {
+		return err
+	}
+	return expectRow(res, "person")
+}
+
+// GetMovieCredits lists a movie's credits in billing order, optionally only
+// those in role and at most limit of them
+func (p *PersonRepo) GetMovieCredits(ctx context.Context, movieID int, role string, limit int) ([]*Credit, error) {
+	qry := `select c.id, c.movie_id, c.person_id, c.role, c.character, c.billing_order, p.name
+			from movie_credits c
+				join people p on p.id = c.person_id
+			where c.movie_id = $1 and ($2 = '' or c.role = $2)
+			order by c.billing_order, c.role, p.name
+			limit $3;`
+
+	var limitArg any
+	if limit > 0 {
+		limitArg = limit
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, db.QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := p.DB.QueryContext(ctx, qry, movieID, role, limitArg)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	credits := []*Credit{}
+	for rows.Next() {
+		var c Credit
+		err := rows.Scan(&c.ID, &c.MovieID, &c.PersonID, &c.Role, &c.Character, &c.BillingOrder, &c.PersonName)
+		if err != nil {
+			return nil, err
+		}
+		credits = append(credits, &c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(credits) == 0 {
+		if err := requireMovie(ctx, p.DB, movieID); err != nil {
+			return nil, err
+		}
+	}
+	return credits, nil
+}
+
+func (p *PersonRepo) InsertCredit(ctx context.Context, credit Credit) (int, error) {
+	stmt := `insert into movie_credits (movie_id, person_id, role, character, billing_order, created_at, updated_at)
+			values ($1, $2, $3, $4, $5, $6, $6)
+			returning id;`
+
+	ctx, cancel := context.WithTimeout(ctx, db.QueryTimeoutDuration)
+	defer cancel()
+
+	var id int
+	err := p.DB.QueryRowContext(ctx, stmt, credit.MovieID, credit.PersonID, credit.Role, credit.Character,
+		credit.BillingOrder, time.Now()).Scan(&id)
+	if err != nil {
+		return 0, dbError("credit", err)
+	}
+	return id, nil
+}
+
+// UpdateCredit saves a credit, which must belong to credit.MovieID
+func (p *PersonRepo) UpdateCredit(ctx context.Context, credit Credit) error {
+	stmt := `update movie_credits set person_id = $1, role = $2, character = $3, billing_order = $4, updated_at = $5
+			where id = $6 and movie_id = $7;`
+
+	ctx, cancel := context.WithTimeout(ctx, db.QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := p.DB.ExecContext(ctx, stmt, credit.PersonID, credit.Role, credit.Character, credit.BillingOrder,
+		time.Now(), credit.ID, credit.MovieID)
+	if err != nil {
+		return dbError("credit", err)
+	}
+	return expectRow(res, "credit")
+}
+
+func (p *PersonRepo) DeleteCredit(ctx context.Context, movieID, creditID int) error {
+	ctx, cancel := context.WithTimeout(ctx, db.QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := p.DB.ExecContext(ctx, `delete from movie_credits where id = $1 and movie_id = $2`, creditID, movieID)
+	if err != nil {
+		return err
+	}
+	return expectRow(res, "credit")
+}
@@ -0,0 +1,344 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/iamYole/go-movies/internal/db"
+	"github.com/lib/pq"
+)
+
+const (
+	ThumbUp   = 1
+	ThumbDown = -1
+)
+
+// Thumb is a user's thumbs up (1) or down (-1) on a movie
+type Thumb struct {
+	UserID    int
+	MovieID   int
+	Value     int
+	UpdatedAt time.Time
+}
+
+// ItemNeighbor is a movie liked by the same people as another, with the
+// cosine similarity of their thumbs
+type ItemNeighbor struct {
+	NeighborID int
+	Similarity float64
+}
+
+// Taste is what recommendations know of a user: their thumbs, the movies
+// they have watched, and how often each genre appears among the movies
+// they watched or liked
+type Taste struct {
+	Thumbs      map[int]int
+	Watched     map[int]bool
+	GenreCounts map[int]int
+}
+
+// Candidate is a movie that may be recommended. Popularity is its net
+// thumbs plus its rating popularity.
+type Candidate struct {
+	ID          int       `json:"id"`
+	Title       string    `json:"title"`
+	ReleaseDate time.Time `json:"release_date"`
+	MPAARating  string    `json:"mpaa_rating"`
+	Image       string    `json:"image"`
+	Genres      []int     `json:"-"`
+	Popularity  float64   `json:"-"`
+}
+
+// Recommendation is a movie picked for a user. Reason says which signal
+// picked it; BecauseOf is the liked movie behind a collaborative pick.
+type Recommendation struct {
+	*Candidate
+	Score     float64 `json:"score"`
+	Reason    string  `json:"reason"`
+	BecauseOf *int    `json:"because_of,omitempty"`
+}
+
+// Viewing is one row of a user's watch history
+type Viewing struct {
+	UserID  int
+	MovieID int
+}
+
+// ratingPopularity counts each rating of movie m as part of a thumb, up or
+// down by how far the movie's average sits from the middle of the 1 to 10
+// scale. The average is pulled towards the middle by five neutral ratings,
+// so a couple of glowing ratings weigh less than many good ones.
+const ratingPopularity = `(m.rating_count * (m.rating_sum - m.rating_count * 5.5)
+		/ ((m.rating_count + 5) * 4.5))::float`
+
+type RecommendRepo struct {
+	DB *sql.DB
+}
+
+func (rr *RecommendRepo) SetThumb(ctx context.Context, userID, movieID, value int) error {
+	ctx, cancel := context.WithTimeout(ctx, db.QueryTimeoutDuration)
+	defer cancel()
+
+	if err := requireMovie(ctx, rr.DB, movieID); err != nil {
+		return err
+	}
+
+	_, err := rr.DB.ExecContext(ctx, `insert into movie_thumbs (user_id, movie_id, value, created_at, updated_at)
+			values ($1, $2, $3, $4, $4)
+			on conflict (user_id, movie_id) do update set value = excluded.value, updated_at = excluded.updated_at`,
+		userID, movieID, value, time.Now())
+	return dbError("thumb", err)
+}
+
+func (rr *RecommendRepo) GetThumb(ctx context.Context, userID, movieID int) (*Thumb, error) {
+	ctx, cancel := context.WithTimeout(ctx, db.QueryTimeoutDuration)
+	defer cancel()
+
+	t := Thumb{UserID: userID, MovieID: movieID}
+	err := rr.DB.QueryRowContext(ctx, `select value, updated_at from movie_thumbs where user_id = $1 and movie_id = $2`,
+		userID, movieID).Scan(&t.Value, &t.UpdatedAt)
+	if err != nil {
+		return nil, dbError("thumb", err)
+	}
+	return &t, nil
+}
+
+func (rr *RecommendRepo) DeleteThumb(ctx context.Context, userID, movieID int) error {
+	ctx, cancel := context.WithTimeout(ctx, db.QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := rr.DB.ExecContext(ctx, `delete from movie_thumbs where user_id = $1 and movie_id = $2`, userID, movieID)
+	if err != nil {
+		return err
+	}
+	return expectRow(res, "thumb")
+}
+
+// AllThumbs loads the whole thumbs matrix for the batch job. It is not
+// bounded by the query timeout, since it grows with the user base.
+func (rr *RecommendRepo) AllThumbs(ctx context.Context) ([]Thumb, error) {
+	rows, err := rr.DB.QueryContext(ctx, `select user_id, movie_id, value, updated_at from movie_thumbs`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var thumbs []Thumb
+	for rows.Next() {
+		var t Thumb
+		if err := rows.Scan(&t.UserID, &t.MovieID, &t.Value, &t.UpdatedAt); err != nil {
+			return nil, err
+		}
+		thumbs = append(thumbs, t)
+	}
+	return thumbs, rows.Err()
+}
+
+// ReplaceItemNeighbors swaps in a freshly built set of neighbors. Movies
+// deleted while it was built are skipped.
+func (rr *RecommendRepo) ReplaceItemNeighbors(ctx context.Context, neighbors map[int][]ItemNeighbor) error {
+	var movieIDs, neighborIDs []int64
+	var similarities []float64
+	for id, ns := range neighbors {
+		for _, n := range ns {
+			movieIDs = append(movieIDs, int64(id))
+			neighborIDs = append(neighborIDs, int64(n.NeighborID))
+			similarities = append(similarities, n.Similarity)
+		}
+	}
+
+	tx, err := rr.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `delete from item_neighbors`); err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `insert into item_neighbors (movie_id, neighbor_id, similarity)
+			select s.movie_id, s.neighbor_id, s.similarity
+			from unnest($1::int[], $2::int[], $3::real[]) as s(movie_id, neighbor_id, similarity)
+				join movies a on a.id = s.movie_id
+				join movies b on b.id = s.neighbor_id`,
+		pq.Array(movieIDs), pq.Array(neighborIDs), pq.Array(similarities))
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ItemNeighbors returns the neighbors of each of the movies
+func (rr *RecommendRepo) ItemNeighbors(ctx context.Context, movieIDs []int) (map[int][]ItemNeighbor, error) {
+	ctx, cancel := context.WithTimeout(ctx, db.QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := rr.DB.QueryContext(ctx, `select movie_id, neighbor_id, similarity from item_neighbors
+			where movie_id = any($1)`, pq.Array(movieIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	neighbors := map[int][]ItemNeighbor{}
+	for rows.Next() {
+		var id int
+		var n ItemNeighbor
+		if err := rows.Scan(&id, &n.NeighborID, &n.Similarity); err != nil {
+			return nil, err
+		}
+		neighbors[id] = append(neighbors[id], n)
+	}
+	return neighbors, rows.Err()
+}
+
+// UserTaste gathers a user's thumbs, watched movies and genre counts
+func (rr *RecommendRepo) UserTaste(ctx context.Context, userID int) (*Taste, error) {
+	ctx, cancel := context.WithTimeout(ctx, db.QueryTimeoutDuration)
+	defer cancel()
+
+	taste := &Taste{Thumbs: map[int]int{}, Watched: map[int]bool{}, GenreCounts: map[int]int{}}
+
+	rows, err := rr.DB.QueryContext(ctx, `select movie_id, value from movie_thumbs where user_id = $1`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id, value int
+		if err := rows.Scan(&id, &value); err != nil {
+			return nil, err
+		}
+		taste.Thumbs[id] = value
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = rr.DB.QueryContext(ctx, `select distinct movie_id from watch_history where user_id = $1`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		taste.Watched[id] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	//every viewing counts, so rewatched movies weigh more
+	rows, err = rr.DB.QueryContext(ctx, `select mg.genre_id, count(*)
+			from (
+				select movie_id from watch_history where user_id = $1
+				union all
+				select movie_id from movie_thumbs where user_id = $1 and value = 1
+			) seen
+				join movies_genres mg on mg.movie_id = seen.movie_id
+			group by mg.genre_id`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var genre, n int
+		if err := rows.Scan(&genre, &n); err != nil {
+			return nil, err
+		}
+		taste.GenreCounts[genre] = n
+	}
+	return taste, rows.Err()
+}
+
+// RecommendationCandidates returns the movies with the given ids along with
+// the popular most popular ones
+func (rr *RecommendRepo) RecommendationCandidates(ctx context.Context, movieIDs []int, popular int) ([]*Candidate, error) {
+	qry := `with pop as (
+				select m.id, coalesce(t.net, 0) + ` + ratingPopularity + ` as popularity
+				from movies m
+					left join (select movie_id, sum(value) as net from movie_thumbs group by movie_id) t
+						on t.movie_id = m.id
+			)
+			select m.id, m.title, m.release_date, m.mpaa_rating, coalesce(m.image, ''),
+				array(select mg.genre_id from movies_genres mg where mg.movie_id = m.id order by 1), p.popularity
+			from movies m
+				join pop p on p.id = m.id
+			where m.id = any($1)
+				or m.id in (select id from pop order by popularity desc, id limit $2);`
+
+	ctx, cancel := context.WithTimeout(ctx, db.QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := rr.DB.QueryContext(ctx, qry, pq.Array(movieIDs), popular)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var candidates []*Candidate
+	for rows.Next() {
+		var c Candidate
+		var genres []int64
+		err := rows.Scan(&c.ID, &c.Title, &c.ReleaseDate, &c.MPAARating, &c.Image, pq.Array(&genres), &c.Popularity)
+		if err != nil {
+			return nil, err
+		}
+		c.Genres = intIDs(genres)
+		candidates = append(candidates, &c)
+	}
+	return candidates, rows.Err()
+}
+
+// AllViewings loads the watch history of every user for offline
+// evaluation, one row per viewing
+func (rr *RecommendRepo) AllViewings(ctx context.Context) ([]Viewing, error) {
+	rows, err := rr.DB.QueryContext(ctx, `select user_id, movie_id from watch_history`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var viewings []Viewing
+	for rows.Next() {
+		var v Viewing
+		if err := rows.Scan(&v.UserID, &v.MovieID); err != nil {
+			return nil, err
+		}
+		viewings = append(viewings, v)
+	}
+	return viewings, rows.Err()
+}
+
+// CatalogCandidates returns every movie as a candidate for offline
+// evaluation. Popularity is the rating popularity alone, since the
+// evaluation counts thumbs from its own training split.
+func (rr *RecommendRepo) CatalogCandidates(ctx context.Context) ([]*Candidate, error) {
+	qry := `select m.id, m.title, m.release_date, m.mpaa_rating, coalesce(m.image, ''),
+				array(select mg.genre_id from movies_genres mg where mg.movie_id = m.id order by 1),
+				` + ratingPopularity + `
+			from movies m`
+
+	rows, err := rr.DB.QueryContext(ctx, qry)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var candidates []*Candidate
+	for rows.Next() {
+		var c Candidate
+		var genres []int64
+		err := rows.Scan(&c.ID, &c.Title, &c.ReleaseDate, &c.MPAARating, &c.Image, pq.Array(&genres), &c.Popularity)
+		if err != nil {
+			return nil, err
+		}
+		c.Genres = intIDs(genres)
+		candidates = append(candidates, &c)
+	}
+	return candidates, rows.Err()
+}
@@ -0,0 +1,407 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/iamYole/go-movies/internal/db"
+)
+
+// Rating is a user's score for a movie, from 1 to 10
+type Rating struct {
+	MovieID   int       `json:"movie_id"`
+	UserID    int       `json:"user_id"`
+	Rating    int       `json:"rating" validate:"gte=1,lte=10"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Review is a user's write up of a movie. Rating is the author's current
+// rating of the movie, which they may have withdrawn since.
+type Review struct {
+	ID           int       `json:"id"`
+	MovieID      int       `json:"movie_id"`
+	UserID       int       `json:"user_id"`
+	Author       string    `json:"author"`
+	Rating       int       `json:"rating,omitempty" validate:"gte=1,lte=10"`
+	Title        string    `json:"title" validate:"required,max=255"`
+	Body         string    `json:"body" validate:"required,max=20000"`
+	Spoiler      bool      `json:"spoiler"`
+	HelpfulCount int       `json:"helpful_count"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// ReviewSorts are the orders reviews can be listed in
+var ReviewSorts = []string{"newest", "helpful"}
+
+type ReviewFilter struct {
+	MovieID int
+	// Sort is one of ReviewSorts, newest when empty
+	Sort   string
+	Limit  int
+	Offset int
+}
+
+// ratingAverage is the mean of count ratings adding up to sum, to two places
+func ratingAverage(sum, count int) float64 {
+	if count == 0 {
+		return 0
+	}
+	return math.Round(float64(sum)/float64(count)*100) / 100
+}
+
+type rowQueryer interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// requireMovie reports a not found error when the movie does not exist
+func requireMovie(ctx context.Context, q rowQueryer, movieID int) error {
+	var exists bool
+	err := q.QueryRowContext(ctx, `select exists(select 1 from movies where id = $1)`, movieID).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return NotFound("movie")
+	}
+	return nil
+}
+
+type ReviewRepo struct {
+	DB *sql.DB
+}
+
+// setRating records a user's rating and moves the movie's running totals by
+// the difference. The movie row is locked first, so concurrent ratings of a
+// movie apply their differences one at a time.
+func setRating(ctx context.Context, tx *sql.Tx, movieID, userID, rating int) error {
+	var locked int
+	err := tx.QueryRowContext(ctx, `select id from movies where id = $1 for no key update`, movieID).Scan(&locked)
+	if err != nil {
+		return dbError("movie", err)
+	}
+
+	var old sql.NullInt64
+	err = tx.QueryRowContext(ctx, `select rating from ratings where movie_id = $1 and user_id = $2`,
+		movieID, userID).Scan(&old)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	sumDelta, countDelta := rating, 1
+	if old.Valid {
+		sumDelta, countDelta = rating-int(old.Int64), 0
+		_, err = tx.ExecContext(ctx, `update ratings set rating = $1, updated_at = $2 where movie_id = $3 and user_id = $4`,
+			rating, time.Now(), movieID, userID)
+	} else {
+		_, err = tx.ExecContext(ctx, `insert into ratings (movie_id, user_id, rating, created_at, updated_at)
+				values ($1, $2, $3, $4, $4)`, movieID, userID, rating, time.Now())
+	}
+	if err != nil {
+		return dbError("rating", err)
+	}
+
+	if sumDelta == 0 && countDelta == 0 {
+		return nil
+	}
+	_, err = tx.ExecContext(ctx, `update movies set rating_sum = rating_sum + $1, rating_count = rating_count + $2 where id = $3`,
+		sumDelta, countDelta, movieID)
+	return err
+}
+
+// SetRating rates a movie for a user, replacing their earlier rating
+func (rv *ReviewRepo) SetRating(ctx context.Context, movieID, userID, rating int) error {
+	ctx, cancel := context.WithTimeout(ctx, db.QueryTimeoutDuration)
+	defer cancel()
+
+	tx, err := rv.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := setRating(ctx, tx, movieID, userID, rating); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (rv *ReviewRepo) GetRating(ctx context.Context, movieID, userID int) (*Rating, error) {
+	qry := `select movie_id, user_id, rating, updated_at from ratings where movie_id = $1 and user_id = $2;`
+
+	ctx, cancel := context.WithTimeout(ctx, db.QueryTimeoutDuration)
+	defer cancel()
+
+	var rating Rating
+	err := rv.DB.QueryRowContext(ctx, qry, movieID, userID).Scan(&rating.MovieID, &rating.UserID, &rating.Rating,
+		&rating.UpdatedAt)
+	if err != nil {
+		return nil, dbError("rating", err)
+	}
+	return &rating, nil
+}
+
+// DeleteRating withdraws a user's rating of a movie. Their review, if any,
+// stays.
+func (rv *ReviewRepo) DeleteRating(ctx context.Context, movieID, userID int) error {
+	ctx, cancel := context.WithTimeout(ctx, db.QueryTimeoutDuration)
+	defer cancel()
+
+	tx, err := rv.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var locked int
+	err = tx.QueryRowContext(ctx, `select id from movies where id = $1 for no key update`, movieID).Scan(&locked)
+	if err != nil {
+		return dbError("movie", err)
+	}
+
+	var old int
+	err = tx.QueryRowContext(ctx, `delete from ratings where movie_id = $1 and user_id = $2 returning rating`,
+		movieID, userID).Scan(&old)
+	if err != nil {
+		return dbError("rating", err)
+	}
+
+	_, err = tx.ExecContext(ctx, `update movies set rating_sum = rating_sum - $1, rating_count = rating_count - 1 where id = $2`,
+		old, movieID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+const reviewColumns = `r.id, r.movie_id, r.user_id, u.first_name || ' ' || left(u.last_name, 1) || '.',
+			coalesce(rt.rating, 0), r.title, r.body, r.spoiler, r.helpful_count, r.created_at, r.updated_at`
+
+const reviewJoins = `reviews r
+				join users u on u.id = r.user_id
+				left join ratings rt on rt.movie_id = r.movie_id and rt.user_id = r.user_id`
+
+func scanReview(row interface{ Scan(...any) error }) (*Review, error) {
+	var r Review
+	err := row.Scan(&r.ID, &r.MovieID, &r.UserID, &r.Author, &r.Rating, &r.Title, &r.Body, &r.Spoiler,
+		&r.HelpfulCount, &r.CreatedAt, &r.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// GetReviews lists a movie's reviews, newest or most helpful first
+func (rv *ReviewRepo) GetReviews(ctx context.Context, filter ReviewFilter) ([]*Review, error) {
+	order := "r.created_at desc, r.id desc"
+	if filter.Sort == "helpful" {
+		order = "r.helpful_count desc, " + order
+	}
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = 20
+	}
+
+	qry := fmt.Sprintf(`select %s
+			from %s
+			where r.movie_id = $1
+			order by %s
+			limit $2 offset $3;`, reviewColumns, reviewJoins, order)
+
+	ctx, cancel := context.WithTimeout(ctx, db.QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := rv.DB.QueryContext(ctx, qry, filter.MovieID, limit, filter.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reviews := []*Review{}
+	for rows.Next() {
+		review, err := scanReview(rows)
+		if err != nil {
+			return nil, err
+		}
+		reviews = append(reviews, review)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(reviews) == 0 && filter.Offset == 0 {
+		if err := requireMovie(ctx, rv.DB, filter.MovieID); err != nil {
+			return nil, err
+		}
+	}
+	return reviews, nil
+}
+
+func (rv *ReviewRepo) GetReview(ctx context.Context, movieID, reviewID int) (*Review, error) {
+	qry := fmt.Sprintf(`select %s
+			from %s
+			where r.id = $1 and r.movie_id = $2;`, reviewColumns, reviewJoins)
+
+	ctx, cancel := context.WithTimeout(ctx, db.QueryTimeoutDuration)
+	defer cancel()
+
+	review, err := scanReview(rv.DB.QueryRowContext(ctx, qry, reviewID, movieID))
+	if err != nil {
+		return nil, dbError("review", err)
+	}
+	return review, nil
+}
+
+// InsertReview saves a new review along with the author's rating
+func (rv *ReviewRepo) InsertReview(ctx context.Context, review Review) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, db.QueryTimeoutDuration)
+	defer cancel()
+
+	tx, err := rv.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if err := setRating(ctx, tx, review.MovieID, review.UserID, review.Rating); err != nil {
+		return 0, err
+	}
+
+	stmt := `insert into reviews (movie_id, user_id, title, body, spoiler, created_at, updated_at)
+			values ($1, $2, $3, $4, $5, $6, $6)
+			returning id;`
+
+	var id int
+	err = tx.QueryRowContext(ctx, stmt, review.MovieID, review.UserID, review.Title, review.Body, review.Spoiler,
+		time.Now()).Scan(&id)
+	if err != nil {
+		err = dbError("review", err)
+		if errors.Is(err, ErrConflict) {
+			return 0, Conflict("review", "you have already reviewed this movie")
+		}
+		return 0, err
+	}
+
+	return id, tx.Commit()
+}
+
+// UpdateReview saves an edit to a review and the author's rating. Only the
+// author may edit a review.
+func (rv *ReviewRepo) UpdateReview(ctx context.Context, review Review) error {
+	ctx, cancel := context.WithTimeout(ctx, db.QueryTimeoutDuration)
+	defer cancel()
+
+	tx, err := rv.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := reviewOwner(ctx, tx, review.MovieID, review.ID, review.UserID, "edit"); err != nil {
+		return err
+	}
+	if err := setRating(ctx, tx, review.MovieID, review.UserID, review.Rating); err != nil {
+		return err
+	}
+
+	stmt := `update reviews set title = $1, body = $2, spoiler = $3, updated_at = $4 where id = $5;`
+	if _, err := tx.ExecContext(ctx, stmt, review.Title, review.Body, review.Spoiler, time.Now(), review.ID); err != nil {
+		return dbError("review", err)
+	}
+	return tx.Commit()
+}
+
+// DeleteReview removes a review by its author. The author's rating stays.
+func (rv *ReviewRepo) DeleteReview(ctx context.Context, movieID, reviewID, userID int) error {
+	ctx, cancel := context.WithTimeout(ctx, db.QueryTimeoutDuration)
+	defer cancel()
+
+	tx, err := rv.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := reviewOwner(ctx, tx, movieID, reviewID, userID, "delete"); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `delete from reviews where id = $1`, reviewID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// reviewOwner locks a review and checks that userID wrote it
+func reviewOwner(ctx context.Context, tx *sql.Tx, movieID, reviewID, userID int, action string) error {
+	var owner int
+	err := tx.QueryRowContext(ctx, `select user_id from reviews where id = $1 and movie_id = $2 for update`,
+		reviewID, movieID).Scan(&owner)
+	if err != nil {
+		return dbError("review", err)
+	}
+	if owner != userID {
+		return Forbidden("you can only " + action + " your own reviews")
+	}
+	return nil
+}
+
+// VoteHelpful marks a review as helpful to a user, once per user; voting
+// again changes nothing. Authors cannot vote for their own reviews.
+func (rv *ReviewRepo) VoteHelpful(ctx context.Context, movieID, reviewID, userID int) (int, error) {
+	return rv.helpfulVote(ctx, movieID, reviewID, userID, true)
+}
+
+// UnvoteHelpful withdraws a user's helpful vote
+func (rv *ReviewRepo) UnvoteHelpful(ctx context.Context, movieID, reviewID, userID int) (int, error) {
+	return rv.helpfulVote(ctx, movieID, reviewID, userID, false)
+}
+
+// helpfulVote adds or removes a vote and returns the review's new count,
+// which moves only when a vote was actually added or removed
+func (rv *ReviewRepo) helpfulVote(ctx context.Context, movieID, reviewID, userID int, vote bool) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, db.QueryTimeoutDuration)
+	defer cancel()
+
+	tx, err := rv.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var owner, count int
+	err = tx.QueryRowContext(ctx, `select user_id, helpful_count from reviews where id = $1 and movie_id = $2 for update`,
+		reviewID, movieID).Scan(&owner, &count)
+	if err != nil {
+		return 0, dbError("review", err)
+	}
+	if vote && owner == userID {
+		return 0, Forbidden("you cannot vote for your own review")
+	}
+
+	var res sql.Result
+	delta := 1
+	if vote {
+		res, err = tx.ExecContext(ctx, `insert into review_votes (review_id, user_id, created_at) values ($1, $2, $3)
+				on conflict do nothing`, reviewID, userID, time.Now())
+	} else {
+		delta = -1
+		res, err = tx.ExecContext(ctx, `delete from review_votes where review_id = $1 and user_id = $2`, reviewID, userID)
+	}
+	if err != nil {
+		return 0, err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return count, err
+	}
+
+	err = tx.QueryRowContext(ctx, `update reviews set helpful_count = helpful_count + $1 where id = $2 returning helpful_count`,
+		delta, reviewID).Scan(&count)
+	if err != nil {
+		return 0, err
+	}
+	return count, tx.Commit()
+}
@@ -0,0 +1,160 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"reflect"
+	"time"
+
+	"github.com/iamYole/go-movies/internal/db"
+)
+
+type MovieRevision struct {
+	ID        int       `json:"id"`
+	MovieID   int       `json:"movie_id"`
+	Revision  int       `json:"revision"`
+	Snapshot  Movie     `json:"snapshot"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type FieldChange struct {
+	Field string `json:"field"`
+	From  any    `json:"from"`
+	To    any    `json:"to"`
+}
+
+// DiffMovies lists the editable fields that differ between two movie snapshots
+func DiffMovies(from, to Movie) []FieldChange {
+	changes := []FieldChange{}
+
+	add := func(field string, a, b any) {
+		if !reflect.DeepEqual(a, b) {
+			changes = append(changes, FieldChange{Field: field, From: a, To: b})
+		}
+	}
+
+	add("title", from.Title, to.Title)
+	add("release_date", from.ReleaseDate.UTC(), to.ReleaseDate.UTC())
+	add("runtime", from.Runtime, to.Runtime)
+	add("mpaa_rating", from.MPAARating, to.MPAARating)
+	add("description", from.Description, to.Description)
+	add("image", from.Image, to.Image)
+	add("backdrop", from.Backdrop, to.Backdrop)
+	add("original_language", from.OriginalLanguage, to.OriginalLanguage)
+	add("tagline", from.Tagline, to.Tagline)
+	add("locked_fields", normaliseFields(from.LockedFields), normaliseFields(to.LockedFields))
+	add("genres_array", normaliseIDs(from.GenresArray), normaliseIDs(to.GenresArray))
+
+	return changes
+}
+
+func normaliseFields(fields []string) []string {
+	if len(fields) == 0 {
+		return []string{}
+	}
+	return fields
+}
+
+func normaliseIDs(ids []int) []int {
+	if len(ids) == 0 {
+		return []int{}
+	}
+	return ids
+}
+
+// insertRevision stores a snapshot of movie as the next numbered revision.
+// The movie row is locked first so two transactions cannot both read the
+// same latest revision and number theirs alike.
+func insertRevision(ctx context.Context, tx *sql.Tx, movie Movie) (int, error) {
+	snapshot, err := json.Marshal(movie)
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err := tx.ExecContext(ctx, `select 1 from movies where id = $1 for update`, movie.ID); err != nil {
+		return 0, err
+	}
+
+	stmt := `insert into movie_revisions (movie_id, revision, snapshot, created_at)
+			select $1, coalesce(max(r.revision), 0) + 1, $2, $3
+			from movie_revisions r
+			where r.movie_id = $1
+			RETURNING revision;`
+
+	var revision int
+	err = tx.QueryRowContext(ctx, stmt, movie.ID, snapshot, time.Now()).Scan(&revision)
+	if err != nil {
+		return 0, err
+	}
+
+	return revision, nil
+}
+
+func (m *MovieRepo) GetMovieRevisions(ctx context.Context, movieID int64) ([]*MovieRevision, error) {
+	qry := `select r.id, r.movie_id, r.revision, r.snapshot, r.created_at
+			from movie_revisions r
+			where r.movie_id = $1
+			order by r.revision desc;`
+
+	ctx, cancel := context.WithTimeout(ctx, db.QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, qry, movieID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revisions := []*MovieRevision{}
+	for rows.Next() {
+		rev, err := scanRevision(rows)
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, rev)
+	}
+
+	return revisions, rows.Err()
+}
+
+func (m *MovieRepo) GetMovieRevision(ctx context.Context, movieID int64, revision int) (*MovieRevision, error) {
+	qry := `select r.id, r.movie_id, r.revision, r.snapshot, r.created_at
+			from movie_revisions r
+			where r.movie_id = $1 and r.revision = $2;`
+
+	ctx, cancel := context.WithTimeout(ctx, db.QueryTimeoutDuration)
+	defer cancel()
+
+	rev, err := scanRevision(m.DB.QueryRowContext(ctx, qry, movieID, revision))
+	if err != nil {
+		return nil, dbError("revision", err)
+	}
+	return rev, nil
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanRevision(row rowScanner) (*MovieRevision, error) {
+	var rev MovieRevision
+	var snapshot []byte
+
+	err := row.Scan(
+		&rev.ID,
+		&rev.MovieID,
+		&rev.Revision,
+		&snapshot,
+		&rev.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(snapshot, &rev.Snapshot); err != nil {
+		return nil, err
+	}
+
+	return &rev, nil
+}
@@ -0,0 +1,179 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/iamYole/go-movies/internal/db"
+	"github.com/lib/pq"
+)
+
+// MovieFeatures is what similarity scoring knows about a movie. Genres and
+// People hold sorted ids; People are the crew and top billed cast.
+type MovieFeatures struct {
+	ID         int
+	Genres     []int
+	People     []int
+	Year       int
+	MPAARating string
+}
+
+// SimilarScore is how closely one movie matches another, from 0 to 1
+type SimilarScore struct {
+	SimilarID int
+	Score     float64
+}
+
+// SimilarMovie is a precomputed match for a movie
+type SimilarMovie struct {
+	ID          int       `json:"id"`
+	Title       string    `json:"title"`
+	ReleaseDate time.Time `json:"release_date"`
+	MPAARating  string    `json:"mpaa_rating"`
+	Image       string    `json:"image"`
+	Score       float64   `json:"score"`
+}
+
+// similarCastSize is how far down the billing actors count as shared cast
+const similarCastSize = 10
+
+type SimilarRepo struct {
+	DB *sql.DB
+}
+
+// SimilarityFeatures loads the features of every movie in the catalog
+func (s *SimilarRepo) SimilarityFeatures(ctx context.Context) ([]*MovieFeatures, error) {
+	qry := `select m.id, extract(year from m.release_date)::int, m.mpaa_rating,
+				array(select distinct mg.genre_id from movies_genres mg where mg.movie_id = m.id order by 1),
+				array(select distinct c.person_id from movie_credits c
+					where c.movie_id = m.id and (c.role <> 'actor' or c.billing_order < $1) order by 1)
+			from movies m
+			order by m.id;`
+
+	ctx, cancel := context.WithTimeout(ctx, db.QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.DB.QueryContext(ctx, qry, similarCastSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var all []*MovieFeatures
+	for rows.Next() {
+		var f MovieFeatures
+		var genres, people []int64
+		if err := rows.Scan(&f.ID, &f.Year, &f.MPAARating, pq.Array(&genres), pq.Array(&people)); err != nil {
+			return nil, err
+		}
+		f.Genres = intIDs(genres)
+		f.People = intIDs(people)
+		all = append(all, &f)
+	}
+	return all, rows.Err()
+}
+
+func intIDs(ids []int64) []int {
+	out := make([]int, len(ids))
+	for i, id := range ids {
+		out[i] = int(id)
+	}
+	return out
+}
+
+// ReplaceSimilar stores a movie's ranked matches in place of its old ones
+func (s *SimilarRepo) ReplaceSimilar(ctx context.Context, movieID int, scores []SimilarScore) error {
+	ctx, cancel := context.WithTimeout(ctx, db.QueryTimeoutDuration)
+	defer cancel()
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `delete from movie_similar where movie_id = $1`, movieID); err != nil {
+		return err
+	}
+
+	if len(scores) > 0 {
+		ids := make([]int64, len(scores))
+		values := make([]float64, len(scores))
+		for i, sc := range scores {
+			ids[i], values[i] = int64(sc.SimilarID), sc.Score
+		}
+		//movies deleted since the features were read are skipped
+		_, err := tx.ExecContext(ctx, `insert into movie_similar (movie_id, similar_id, score, computed_at)
+				select $1, s.id, s.score, $4
+				from unnest($2::int[], $3::real[]) as s(id, score)
+				where exists (select 1 from movies m where m.id = s.id)
+					and exists (select 1 from movies m where m.id = $1)`,
+			movieID, pq.Array(ids), pq.Array(values), time.Now())
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// SimilarReferrers lists the movies whose matches include movieID
+func (s *SimilarRepo) SimilarReferrers(ctx context.Context, movieID int) ([]int, error) {
+	ctx, cancel := context.WithTimeout(ctx, db.QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.DB.QueryContext(ctx, `select movie_id from movie_similar where similar_id = $1`, movieID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// GetSimilarMovies returns a movie's best matches, best first
+func (s *SimilarRepo) GetSimilarMovies(ctx context.Context, movieID, limit int) ([]*SimilarMovie, error) {
+	qry := `select m.id, m.title, m.release_date, m.mpaa_rating, coalesce(m.image, ''), s.score
+			from movie_similar s
+				join movies m on m.id = s.similar_id
+			where s.movie_id = $1
+			order by s.score desc, m.id
+			limit $2;`
+
+	ctx, cancel := context.WithTimeout(ctx, db.QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.DB.QueryContext(ctx, qry, movieID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	movies := []*SimilarMovie{}
+	for rows.Next() {
+		var m SimilarMovie
+		if err := rows.Scan(&m.ID, &m.Title, &m.ReleaseDate, &m.MPAARating, &m.Image, &m.Score); err != nil {
+			return nil, err
+		}
+		movies = append(movies, &m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(movies) == 0 {
+		if err := requireMovie(ctx, s.DB, movieID); err != nil {
+			return nil, err
+		}
+	}
+	return movies, nil
+}
@@ -0,0 +1,49 @@
+package models
+
+import (
+	"context"
+	"time"
+
+	"github.com/iamYole/go-movies/internal/db"
+)
+
+// StaleMovies returns up to limit movies never synced with TMDB or last
+// synced before the given time, least recently synced first
+func (m *MovieRepo) StaleMovies(ctx context.Context, before time.Time, limit int) ([]int, error) {
+	qry := `select m.id from movies m
+			where m.tmdb_synced_at is null or m.tmdb_synced_at < $1
+			order by m.tmdb_synced_at nulls first, m.id
+			limit $2;`
+
+	ctx, cancel := context.WithTimeout(ctx, db.QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, qry, before, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// MarkMovieSynced records when a movie was last compared with TMDB. It is
+// bookkeeping rather than an edit, so the version is left alone.
+func (m *MovieRepo) MarkMovieSynced(ctx context.Context, movieID int, at time.Time) error {
+	ctx, cancel := context.WithTimeout(ctx, db.QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx, `update movies set tmdb_synced_at = $2 where id = $1;`, movieID, at)
+	if err != nil {
+		return err
+	}
+	return expectRow(res, "movie")
+}
@@ -15,9 +15,14 @@ type User struct {
 	FirstName string    `json:"first_name"`
 	LastName  string    `json:"last_name"`
 	Email     string    `json:"email"`
-	Password  password  `json:"-"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	Password   password   `json:"-"`
+	IsAdmin    bool       `json:"is_admin"`
+	DisabledAt *time.Time `json:"disabled_at,omitempty"`
+	// WarningCount and SuspendedUntil are set by moderators
+	WarningCount   int        `json:"warning_count"`
+	SuspendedUntil *time.Time `json:"suspended_until,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
 }
 type password struct {
 	text *string
@@ -57,7 +62,7 @@ type UserRepo struct {
 func (u *UserRepo) GetUserByEmail(ctx context.Context, email string) (*User, error) {
 	var user User
 	qry := `select 
-				u.id ,u.first_name, u.last_name, u.email ,u."password" ,u.created_at ,u.updated_at  
+				u.id ,u.first_name, u.last_name, u.email ,u."password" ,u.is_admin ,u.disabled_at ,u.warning_count ,u.suspended_until ,u.created_at ,u.updated_at  
 			from users u
 			where u.email = $1;`
 
@@ -71,36 +76,41 @@ func (u *UserRepo) GetUserByEmail(ctx context.Context, email string) (*User, err
 		&user.LastName,
 		&user.Email,
 		&user.Password.hash,
+		&user.IsAdmin,
+		&user.DisabledAt,
+		&user.WarningCount,
+		&user.SuspendedUntil,
 		&user.CreatedAt,
 		&user.UpdatedAt,
 	)
 	if err != nil {
-		return nil, err
+		return nil, dbError("user", err)
 	}
 	return &user, nil
 }
 
-func (u *UserRepo) CreateUser(ctx context.Context, user User) error {
-	stmt := `insert into users (first_name, last_name, email,password,created_at, updated_at)
-			values($1,$2,$3,$4,$5,$6) RETURNING id, created_at;`
+// CreateUser inserts user and returns its new id
+func (u *UserRepo) CreateUser(ctx context.Context, user User) (int, error) {
+	stmt := `insert into users (first_name, last_name, email,password,is_admin,created_at, updated_at)
+			values($1,$2,$3,$4,$5,$6,$7) RETURNING id;`
 
 	ctx, cancel := context.WithTimeout(ctx, db.QueryTimeoutDuration)
 	defer cancel()
 
 	err := u.DB.QueryRowContext(ctx, stmt, user.FirstName,
-		user.LastName, user.Email, user.Password.hash, time.Now(), time.Now()).Scan(&user.ID, &user.CreatedAt)
+		user.LastName, user.Email, user.Password.hash, user.IsAdmin, time.Now(), time.Now()).Scan(&user.ID)
 	if err != nil {
-		return err
+		return 0, dbError("user", err)
 	}
 
-	return nil
+	return user.ID, nil
 }
 
 func (u *UserRepo) GetUserByID(ctx context.Context, userID int64)(*User, error){
 	var user User
 	qry := `select 
 				u.id ,u.first_name,u.last_name t_name,u.email ,
-				u."password" ,u.created_at ,u.updated_at  
+				u."password" ,u.is_admin ,u.disabled_at ,u.warning_count ,u.suspended_until ,u.created_at ,u.updated_at  
 			from users u
 			where u.id=$1;`
 
@@ -114,12 +124,90 @@ func (u *UserRepo) GetUserByID(ctx context.Context, userID int64)(*User, error){
 		&user.LastName,
 		&user.Email,
 		&user.Password.hash,
+		&user.IsAdmin,
+		&user.DisabledAt,
+		&user.WarningCount,
+		&user.SuspendedUntil,
 		&user.CreatedAt,
 		&user.UpdatedAt,
 	)
 
 	if err!=nil{
-		return nil,err
+		return nil,dbError("user", err)
 	}
 	return &user,nil
 }
+
+func (u *UserRepo) GetUsers(ctx context.Context) ([]*User, error) {
+	qry := `select 
+				u.id ,u.first_name ,u.last_name ,u.email ,u.is_admin ,u.disabled_at ,u.warning_count ,u.suspended_until ,u.created_at ,u.updated_at
+			from users u
+			order by u.email;`
+
+	ctx, cancel := context.WithTimeout(ctx, db.QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := u.DB.QueryContext(ctx, qry)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []*User
+	for rows.Next() {
+		var user User
+		err := rows.Scan(
+			&user.ID,
+			&user.FirstName,
+			&user.LastName,
+			&user.Email,
+			&user.IsAdmin,
+			&user.DisabledAt,
+			&user.WarningCount,
+			&user.SuspendedUntil,
+			&user.CreatedAt,
+			&user.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, &user)
+	}
+
+	return users, rows.Err()
+}
+
+// UpdatePassword stores the password hash already set on user
+func (u *UserRepo) UpdatePassword(ctx context.Context, user User) error {
+	stmt := `update users set password = $1, updated_at = $2 where id = $3;`
+
+	ctx, cancel := context.WithTimeout(ctx, db.QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := u.DB.ExecContext(ctx, stmt, user.Password.hash, time.Now(), user.ID)
+	if err != nil {
+		return err
+	}
+	return expectRow(res, "user")
+}
+
+// SetUserDisabled disables a user, or enables them again
+func (u *UserRepo) SetUserDisabled(ctx context.Context, userID int64, disabled bool) error {
+	stmt := `update users set 
+				disabled_at = case when $1 then coalesce(disabled_at, $2) end, updated_at = $2
+			where id = $3;`
+
+	ctx, cancel := context.WithTimeout(ctx, db.QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := u.DB.ExecContext(ctx, stmt, disabled, time.Now(), userID)
+	if err != nil {
+		return err
+	}
+	return expectRow(res, "user")
+}
+
+// Suspended reports whether a moderator has suspended the user from posting
+func (u *User) Suspended() bool {
+	return u.SuspendedUntil != nil && u.SuspendedUntil.After(time.Now())
+}
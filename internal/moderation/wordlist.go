@@ -0,0 +1,90 @@
+// Package moderation holds the automatic checks that send comments to the
+// moderation queue.
+package moderation
+
+import (
+	"bufio"
+	"os"
+	"strings"
+	"unicode"
+)
+
+// WordList matches text against blocked words and phrases. Matching ignores
+// case and punctuation and works on whole words, so a blocked word inside a
+// longer, innocent word does not match.
+type WordList struct {
+	phrases [][]string
+}
+
+// NewWordList builds a list from words or phrases; blank entries are skipped
+func NewWordList(entries []string) *WordList {
+	l := &WordList{}
+	for _, e := range entries {
+		if words := tokenize(e); len(words) > 0 {
+			l.phrases = append(l.phrases, words)
+		}
+	}
+	return l
+}
+
+// LoadWordList builds a list from extra and, when path is set, the file at
+// path, which holds one entry per line. Lines starting with # are comments.
+func LoadWordList(path string, extra []string) (*WordList, error) {
+	entries := extra
+	if path != "" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			entries = append(entries, line)
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return NewWordList(entries), nil
+}
+
+// Len is the number of entries in the list
+func (l *WordList) Len() int {
+	return len(l.phrases)
+}
+
+// Match returns the first entry found in text
+func (l *WordList) Match(text string) (string, bool) {
+	if len(l.phrases) == 0 {
+		return "", false
+	}
+	words := tokenize(text)
+	for _, phrase := range l.phrases {
+		for i := 0; i+len(phrase) <= len(words); i++ {
+			if equalWords(words[i:i+len(phrase)], phrase) {
+				return strings.Join(phrase, " "), true
+			}
+		}
+	}
+	return "", false
+}
+
+func tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+func equalWords(a, b []string) bool {
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,262 @@
+package recommend
+
+import (
+	"context"
+	"math/rand"
+	"sort"
+
+	"github.com/iamYole/go-movies/internal/models"
+)
+
+// Evaluation is the outcome of an offline evaluation. Precision is the
+// mean precision@K of the blended recommendations over the evaluated
+// users, and PopularityPrecision that of recommending the most popular
+// movies to everyone, as a baseline.
+type Evaluation struct {
+	K                   int
+	Users               int
+	HeldOut             int
+	Precision           float64
+	PopularityPrecision float64
+}
+
+// EvalOptions configure an offline evaluation. The service settings are
+// those of Service, and should match the ones the API runs with.
+type EvalOptions struct {
+	K int
+	// Holdout is the fraction of each user's thumbs up that is hidden
+	// from training and must be recommended back
+	Holdout float64
+	Seed    int64
+	Weights Weights
+
+	Neighbors int
+	MinCommon int
+	Pool      int
+}
+
+// EvalData is what an evaluation runs on. Catalog holds every movie, with
+// a popularity counting ratings only; thumbs are added from the training
+// split.
+type EvalData struct {
+	Thumbs   []models.Thumb
+	Viewings []models.Viewing
+	Catalog  []*models.Candidate
+}
+
+// Evaluate holds out part of each user's thumbs up, along with their
+// viewings of those movies, and measures how many of the held out movies
+// each user's top K recommendations recover. The rest is served to a
+// Service from memory, so neighbors, tastes, candidates and scores go
+// through the same code as the API. Users with fewer than two thumbs up
+// are left out, since nothing would be left to train on.
+func Evaluate(ctx context.Context, data EvalData, opts EvalOptions) (Evaluation, error) {
+	rng := rand.New(rand.NewSource(opts.Seed))
+
+	byUser := map[int][]models.Thumb{}
+	var userIDs []int
+	for _, t := range data.Thumbs {
+		if _, ok := byUser[t.UserID]; !ok {
+			userIDs = append(userIDs, t.UserID)
+		}
+		byUser[t.UserID] = append(byUser[t.UserID], t)
+	}
+	//map order would make the split differ between runs with one seed
+	sort.Ints(userIDs)
+
+	var train []models.Thumb
+	heldOut := map[int]map[int]bool{}
+	for _, userID := range userIDs {
+		ts := byUser[userID]
+		sort.Slice(ts, func(i, j int) bool { return ts[i].MovieID < ts[j].MovieID })
+
+		var likes []int
+		for i, t := range ts {
+			if t.Value == models.ThumbUp {
+				likes = append(likes, i)
+			}
+		}
+		n := int(float64(len(likes))*opts.Holdout + 0.5)
+		if len(likes) < 2 || n == 0 {
+			train = append(train, ts...)
+			continue
+		}
+		n = min(n, len(likes)-1)
+
+		rng.Shuffle(len(likes), func(i, j int) { likes[i], likes[j] = likes[j], likes[i] })
+		hidden := map[int]bool{}
+		for _, i := range likes[:n] {
+			hidden[i] = true
+		}
+		heldOut[userID] = map[int]bool{}
+		for i, t := range ts {
+			if hidden[i] {
+				heldOut[userID][t.MovieID] = true
+			} else {
+				train = append(train, t)
+			}
+		}
+	}
+
+	//a viewing of a held out movie would give it away, both by excluding
+	//it from the user's recommendations and by adding to their genres
+	var viewings []models.Viewing
+	for _, v := range data.Viewings {
+		if !heldOut[v.UserID][v.MovieID] {
+			viewings = append(viewings, v)
+		}
+	}
+
+	store := newEvalStore(train, viewings, data.Catalog)
+	svc := &Service{Store: store, Weights: opts.Weights, Neighbors: opts.Neighbors, MinCommon: opts.MinCommon, Pool: opts.Pool}
+	baseline := &Service{Store: store, Weights: Weights{Popularity: 1}, Pool: opts.Pool}
+
+	ev := Evaluation{K: opts.K}
+	if opts.K <= 0 {
+		return ev, nil
+	}
+	if err := svc.Handle(ctx, nil); err != nil {
+		return ev, err
+	}
+
+	var precision, popular float64
+	for _, userID := range userIDs {
+		hidden := heldOut[userID]
+		if hidden == nil {
+			continue
+		}
+		recs, err := svc.ForUser(ctx, userID, opts.K)
+		if err != nil {
+			return ev, err
+		}
+		precision += hits(recs, hidden)
+		recs, err = baseline.ForUser(ctx, userID, opts.K)
+		if err != nil {
+			return ev, err
+		}
+		popular += hits(recs, hidden)
+		ev.Users++
+		ev.HeldOut += len(hidden)
+	}
+	if ev.Users > 0 {
+		ev.Precision = precision / float64(ev.Users*opts.K)
+		ev.PopularityPrecision = popular / float64(ev.Users*opts.K)
+	}
+	return ev, nil
+}
+
+// evalStore is a Store over a training split held in memory. Its answers
+// follow the repository's queries.
+type evalStore struct {
+	thumbs    []models.Thumb
+	byUser    map[int]map[int]int
+	viewings  map[int][]int
+	genres    map[int][]int
+	neighbors map[int][]models.ItemNeighbor
+	// catalog is sorted by popularity, most popular first
+	catalog []*models.Candidate
+}
+
+func newEvalStore(thumbs []models.Thumb, viewings []models.Viewing, catalog []*models.Candidate) *evalStore {
+	s := &evalStore{
+		thumbs:   thumbs,
+		byUser:   map[int]map[int]int{},
+		viewings: map[int][]int{},
+		genres:   map[int][]int{},
+	}
+
+	net := map[int]float64{}
+	for _, t := range thumbs {
+		if s.byUser[t.UserID] == nil {
+			s.byUser[t.UserID] = map[int]int{}
+		}
+		s.byUser[t.UserID][t.MovieID] = t.Value
+		net[t.MovieID] += float64(t.Value)
+	}
+	for _, v := range viewings {
+		s.viewings[v.UserID] = append(s.viewings[v.UserID], v.MovieID)
+	}
+
+	for _, c := range catalog {
+		candidate := *c
+		candidate.Popularity += net[c.ID]
+		s.catalog = append(s.catalog, &candidate)
+		s.genres[c.ID] = c.Genres
+	}
+	sort.Slice(s.catalog, func(i, j int) bool {
+		if s.catalog[i].Popularity != s.catalog[j].Popularity {
+			return s.catalog[i].Popularity > s.catalog[j].Popularity
+		}
+		return s.catalog[i].ID < s.catalog[j].ID
+	})
+	return s
+}
+
+func (s *evalStore) AllThumbs(context.Context) ([]models.Thumb, error) {
+	return s.thumbs, nil
+}
+
+func (s *evalStore) ReplaceItemNeighbors(_ context.Context, neighbors map[int][]models.ItemNeighbor) error {
+	s.neighbors = neighbors
+	return nil
+}
+
+func (s *evalStore) ItemNeighbors(_ context.Context, movieIDs []int) (map[int][]models.ItemNeighbor, error) {
+	neighbors := map[int][]models.ItemNeighbor{}
+	for _, id := range movieIDs {
+		if ns, ok := s.neighbors[id]; ok {
+			neighbors[id] = ns
+		}
+	}
+	return neighbors, nil
+}
+
+func (s *evalStore) UserTaste(_ context.Context, userID int) (*models.Taste, error) {
+	taste := &models.Taste{Thumbs: map[int]int{}, Watched: map[int]bool{}, GenreCounts: map[int]int{}}
+	for id, value := range s.byUser[userID] {
+		taste.Thumbs[id] = value
+		if value == models.ThumbUp {
+			for _, g := range s.genres[id] {
+				taste.GenreCounts[g]++
+			}
+		}
+	}
+	//every viewing counts, as in UserTaste
+	for _, id := range s.viewings[userID] {
+		taste.Watched[id] = true
+		for _, g := range s.genres[id] {
+			taste.GenreCounts[g]++
+		}
+	}
+	return taste, nil
+}
+
+func (s *evalStore) RecommendationCandidates(_ context.Context, movieIDs []int, popular int) ([]*models.Candidate, error) {
+	wanted := make(map[int]bool, len(movieIDs))
+	for _, id := range movieIDs {
+		wanted[id] = true
+	}
+	var candidates []*models.Candidate
+	for i, c := range s.catalog {
+		if i < popular || wanted[c.ID] {
+			candidates = append(candidates, c)
+		}
+	}
+	return candidates, nil
+}
+func hits(recs []*models.Recommendation, want map[int]bool) float64 {
+	var n float64
+	for _, r := range recs {
+		if want[r.ID] {
+			n++
+		}
+	}
+	return n
+}
+
+func defaultInt(n, def int) int {
+	if n <= 0 {
+		return def
+	}
+	return n
+}
@@ -0,0 +1,81 @@
+package recommend
+
+import (
+	"math"
+	"sort"
+
+	"github.com/iamYole/go-movies/internal/models"
+)
+
+// maxUserThumbs bounds the pairs a single prolific user adds to the build
+const maxUserThumbs = 500
+
+// BuildNeighbors computes item-item similarities over the thumbs matrix.
+// Each movie is a vector of its users' thumbs, and two movies are as alike
+// as the cosine of their vectors. Pairs with fewer than minCommon users in
+// common are too thin to trust and are left out, as are pairs the common
+// users disagree on. Each movie keeps its topK nearest neighbors.
+func BuildNeighbors(thumbs []models.Thumb, topK, minCommon int) map[int][]models.ItemNeighbor {
+	byUser := map[int][]models.Thumb{}
+	raters := map[int]int{}
+	for _, t := range thumbs {
+		byUser[t.UserID] = append(byUser[t.UserID], t)
+		raters[t.MovieID]++
+	}
+
+	type pair struct{ a, b int }
+	type overlap struct {
+		dot    float64
+		common int
+	}
+	pairs := map[pair]*overlap{}
+	for _, ts := range byUser {
+		if len(ts) > maxUserThumbs {
+			sort.Slice(ts, func(i, j int) bool { return ts[i].UpdatedAt.After(ts[j].UpdatedAt) })
+			ts = ts[:maxUserThumbs]
+		}
+		for i := range ts {
+			for j := i + 1; j < len(ts); j++ {
+				p := pair{ts[i].MovieID, ts[j].MovieID}
+				if p.a > p.b {
+					p.a, p.b = p.b, p.a
+				}
+				o := pairs[p]
+				if o == nil {
+					o = &overlap{}
+					pairs[p] = o
+				}
+				o.dot += float64(ts[i].Value * ts[j].Value)
+				o.common++
+			}
+		}
+	}
+
+	neighbors := map[int][]models.ItemNeighbor{}
+	for p, o := range pairs {
+		if o.common < minCommon {
+			continue
+		}
+		//thumbs are ±1, so a vector's length is the root of its raters
+		sim := o.dot / math.Sqrt(float64(raters[p.a]*raters[p.b]))
+		if sim <= 0 {
+			continue
+		}
+		sim = math.Round(sim*1000) / 1000
+		neighbors[p.a] = append(neighbors[p.a], models.ItemNeighbor{NeighborID: p.b, Similarity: sim})
+		neighbors[p.b] = append(neighbors[p.b], models.ItemNeighbor{NeighborID: p.a, Similarity: sim})
+	}
+
+	for id, ns := range neighbors {
+		sort.Slice(ns, func(i, j int) bool {
+			if ns[i].Similarity != ns[j].Similarity {
+				return ns[i].Similarity > ns[j].Similarity
+			}
+			return ns[i].NeighborID < ns[j].NeighborID
+		})
+		if len(ns) > topK {
+			neighbors[id] = ns[:topK]
+		}
+	}
+	return neighbors
+}
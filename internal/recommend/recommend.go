@@ -0,0 +1,203 @@
+// Package recommend picks movies for a user by blending item-item
+// collaborative filtering over thumbs with the genres the user watches
+// and likes, falling back to popularity for users it knows nothing about.
+// The item neighbors are rebuilt by a periodic batch job.
+package recommend
+
+import (
+	"context"
+	"log"
+	"math"
+	"sort"
+
+	"github.com/iamYole/go-movies/internal/models"
+)
+
+// JobKind is the job kind handled by Service.Handle
+const JobKind = "build_item_neighbors"
+
+// Reasons a movie was recommended
+const (
+	ReasonLiked   = "liked_similar"
+	ReasonGenres  = "genres"
+	ReasonPopular = "popular"
+)
+
+// Store is the part of the recommendation repository the service needs
+type Store interface {
+	AllThumbs(context.Context) ([]models.Thumb, error)
+	ReplaceItemNeighbors(context.Context, map[int][]models.ItemNeighbor) error
+	ItemNeighbors(ctx context.Context, movieIDs []int) (map[int][]models.ItemNeighbor, error)
+	UserTaste(ctx context.Context, userID int) (*models.Taste, error)
+	RecommendationCandidates(ctx context.Context, movieIDs []int, popular int) ([]*models.Candidate, error)
+}
+
+// Weights are each signal's share of a recommendation's score
+type Weights struct {
+	Collaborative float64
+	Genre         float64
+	Popularity    float64
+}
+
+// DefaultWeights lean on what similar users liked, then on genre taste,
+// with popularity breaking ties
+var DefaultWeights = Weights{Collaborative: 0.6, Genre: 0.3, Popularity: 0.1}
+
+type Service struct {
+	Store   Store
+	Weights Weights
+
+	// Neighbors is how many neighbors the batch job keeps per movie
+	Neighbors int
+	// MinCommon is how many users must have thumbed both movies of a pair
+	MinCommon int
+	// Pool is how many popular movies are considered besides neighbors
+	Pool int
+}
+
+// Handle is the jobs.Handler for JobKind, which rebuilds every movie's
+// neighbors from the current thumbs
+func (s *Service) Handle(ctx context.Context, job *models.Job) error {
+	thumbs, err := s.Store.AllThumbs(ctx)
+	if err != nil {
+		return err
+	}
+	neighbors := BuildNeighbors(thumbs, s.neighbors(), s.minCommon())
+	if err := s.Store.ReplaceItemNeighbors(ctx, neighbors); err != nil {
+		return err
+	}
+	log.Printf("recommend: built neighbors for %d movies from %d thumbs", len(neighbors), len(thumbs))
+	return nil
+}
+
+// ForUser returns up to limit recommendations for a user, best first
+func (s *Service) ForUser(ctx context.Context, userID, limit int) ([]*models.Recommendation, error) {
+	taste, err := s.Store.UserTaste(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	thumbed := make([]int, 0, len(taste.Thumbs))
+	for id := range taste.Thumbs {
+		thumbed = append(thumbed, id)
+	}
+	neighbors, err := s.Store.ItemNeighbors(ctx, thumbed)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := map[int]bool{}
+	var ids []int
+	for _, ns := range neighbors {
+		for _, n := range ns {
+			if !seen[n.NeighborID] {
+				seen[n.NeighborID] = true
+				ids = append(ids, n.NeighborID)
+			}
+		}
+	}
+	candidates, err := s.Store.RecommendationCandidates(ctx, ids, s.pool())
+	if err != nil {
+		return nil, err
+	}
+
+	return Recommend(taste, neighbors, candidates, limit, s.weights()), nil
+}
+
+func (s *Service) weights() Weights {
+	if s.Weights == (Weights{}) {
+		return DefaultWeights
+	}
+	return s.Weights
+}
+
+func (s *Service) neighbors() int { return defaultInt(s.Neighbors, 50) }
+
+func (s *Service) minCommon() int { return defaultInt(s.MinCommon, 2) }
+
+func (s *Service) pool() int { return defaultInt(s.Pool, 200) }
+
+// Recommend scores the candidates for a user and returns the best k they
+// have neither watched nor thumbed. Each signal is scaled to at most 1
+// before weighting: neighbors of liked movies gain and neighbors of
+// disliked ones lose, genres count by how often the user picks them, and
+// popularity is relative to the most popular candidate. A user with no
+// thumbs or history gets the most popular movies.
+func Recommend(taste *models.Taste, neighbors map[int][]models.ItemNeighbor, candidates []*models.Candidate, k int, w Weights) []*models.Recommendation {
+	cf := map[int]float64{}
+	because := map[int]int{}
+	best := map[int]float64{}
+	for movieID, value := range taste.Thumbs {
+		for _, n := range neighbors[movieID] {
+			contrib := float64(value) * n.Similarity
+			cf[n.NeighborID] += contrib
+			if contrib > best[n.NeighborID] {
+				best[n.NeighborID] = contrib
+				because[n.NeighborID] = movieID
+			}
+		}
+	}
+
+	var maxCF, maxPop float64
+	for _, v := range cf {
+		maxCF = math.Max(maxCF, math.Abs(v))
+	}
+	for _, c := range candidates {
+		maxPop = math.Max(maxPop, c.Popularity)
+	}
+	var maxGenre int
+	for _, n := range taste.GenreCounts {
+		maxGenre = max(maxGenre, n)
+	}
+
+	recs := []*models.Recommendation{}
+	for _, c := range candidates {
+		if taste.Watched[c.ID] {
+			continue
+		}
+		if _, ok := taste.Thumbs[c.ID]; ok {
+			continue
+		}
+
+		var cfScore, genreScore, popScore float64
+		if maxCF > 0 {
+			cfScore = cf[c.ID] / maxCF
+		}
+		if maxGenre > 0 && len(c.Genres) > 0 {
+			for _, g := range c.Genres {
+				genreScore += float64(taste.GenreCounts[g]) / float64(maxGenre)
+			}
+			genreScore /= float64(len(c.Genres))
+		}
+		if maxPop > 0 && c.Popularity > 0 {
+			popScore = c.Popularity / maxPop
+		}
+
+		parts := [3]float64{w.Collaborative * cfScore, w.Genre * genreScore, w.Popularity * popScore}
+		rec := &models.Recommendation{
+			Candidate: c,
+			Score:     math.Round((parts[0]+parts[1]+parts[2])*1000) / 1000,
+			Reason:    ReasonPopular,
+		}
+		switch {
+		case parts[0] > 0 && parts[0] >= parts[1] && parts[0] >= parts[2]:
+			rec.Reason = ReasonLiked
+			id := because[c.ID]
+			rec.BecauseOf = &id
+		case parts[1] > 0 && parts[1] >= parts[2]:
+			rec.Reason = ReasonGenres
+		}
+		recs = append(recs, rec)
+	}
+
+	sort.Slice(recs, func(i, j int) bool {
+		if recs[i].Score != recs[j].Score {
+			return recs[i].Score > recs[j].Score
+		}
+		return recs[i].ID < recs[j].ID
+	})
+	if len(recs) > k {
+		recs = recs[:k]
+	}
+	return recs
+}
@@ -0,0 +1,14 @@
+package repository
+
+import "github.com/iamYole/go-movies/internal/models"
+
+// Domain errors returned by the repositories. Match them with errors.Is;
+// database errors such as sql.ErrNoRows never reach callers directly.
+var (
+	ErrNotFound     = models.ErrNotFound
+	ErrConflict     = models.ErrConflict
+	ErrEditConflict = models.ErrEditConflict
+	ErrValidation   = models.ErrValidation
+	ErrUnauthorized = models.ErrUnauthorized
+	ErrForbidden    = models.ErrForbidden
+)
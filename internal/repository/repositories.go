@@ -3,29 +3,157 @@ package repository
 import (
 	"context"
 	"database/sql"
+	"time"
 
 	"github.com/iamYole/go-movies/internal/models"
 )
 
 type Repository struct {
 	Movies interface {
-		GetMovies(context.Context) ([]*models.Movie, error)
+		GetMovies(context.Context, models.MovieFilter) ([]*models.Movie, error)
+		GetFacets(ctx context.Context, filter models.MovieFilter, facets []string) (map[string][]*models.FacetBucket, error)
+		StreamMovies(context.Context, models.MovieFilter, func(*models.Movie) error) error
 		GetMovieByID(context.Context, int64) (*models.Movie, error)
 		EditMovie(context.Context, int64) (*models.Movie,[]*models.Genre, error)
 		GetAllGenres(context.Context)([]*models.Genre, error)
 		InsertMovie(context.Context, models.Movie)(int64, error)
 		UpdateMovieGenres(ctx context.Context, id int, genreIDs []int) error
+		UpdateMovie(context.Context, models.Movie) (int, int, error)
+		PatchMovie(context.Context, models.Movie, []string) (int, int, error)
+		DeleteMovie(context.Context, int64, int) error
+		ImportMovies(context.Context, []models.ImportMovie) ([]int, int, int, error)
+		UpsertMoviesByExternalID(ctx context.Context, source string, movies []models.ImportMovie) (int, int, error)
+		GetMovieByExternalID(ctx context.Context, source, externalID string) (*models.Movie, error)
+		SetExternalID(ctx context.Context, movieID int, source, externalID string) error
+		UpsertMovieByExternalID(ctx context.Context, source, externalID string, movie models.Movie) (bool, int, int, int, error)
+		StaleMovies(ctx context.Context, before time.Time, limit int) ([]int, error)
+		MarkMovieSynced(ctx context.Context, movieID int, at time.Time) error
+		SetMovieImage(ctx context.Context, movieID int, kind string, imageID int64, version int) (int, error)
+		GetMovieRevisions(context.Context, int64) ([]*models.MovieRevision, error)
+		GetMovieRevision(context.Context, int64, int) (*models.MovieRevision, error)
 	}
 	Users interface {
 		GetUserByEmail(context.Context, string) (*models.User, error)
 		GetUserByID(context.Context, int64)(*models.User, error)
-		CreateUser(context.Context, models.User) error
+		CreateUser(context.Context, models.User) (int, error)
+		GetUsers(context.Context) ([]*models.User, error)
+		UpdatePassword(context.Context, models.User) error
+		SetUserDisabled(context.Context, int64, bool) error
+	}
+	Jobs interface {
+		EnqueueJob(context.Context, models.Job) (int64, error)
+		EnqueueJobs(context.Context, []models.Job) error
+		ClaimJob(ctx context.Context, kinds []string, worker string, lease time.Duration) (*models.Job, error)
+		CompleteJob(ctx context.Context, id int64, worker string) error
+		FailJob(ctx context.Context, id int64, worker string, message string, retryAt time.Time, dead bool) error
+		RetryJob(context.Context, int64) (*models.Job, error)
+		GetJob(context.Context, int64) (*models.Job, error)
+		GetJobs(context.Context, models.JobFilter) ([]*models.Job, error)
+		PruneJobs(context.Context, time.Time) (int64, error)
+	}
+	People interface {
+		GetPeople(context.Context, models.PersonFilter) ([]*models.Person, error)
+		GetPerson(context.Context, int) (*models.Person, error)
+		InsertPerson(context.Context, models.Person) (int, error)
+		UpdatePerson(context.Context, models.Person) error
+		DeletePerson(context.Context, int) error
+		GetMovieCredits(ctx context.Context, movieID int, role string, limit int) ([]*models.Credit, error)
+		InsertCredit(context.Context, models.Credit) (int, error)
+		UpdateCredit(context.Context, models.Credit) error
+		DeleteCredit(ctx context.Context, movieID, creditID int) error
+	}
+	Reviews interface {
+		SetRating(ctx context.Context, movieID, userID, rating int) error
+		GetRating(ctx context.Context, movieID, userID int) (*models.Rating, error)
+		DeleteRating(ctx context.Context, movieID, userID int) error
+		GetReviews(context.Context, models.ReviewFilter) ([]*models.Review, error)
+		GetReview(ctx context.Context, movieID, reviewID int) (*models.Review, error)
+		InsertReview(context.Context, models.Review) (int, error)
+		UpdateReview(context.Context, models.Review) error
+		DeleteReview(ctx context.Context, movieID, reviewID, userID int) error
+		VoteHelpful(ctx context.Context, movieID, reviewID, userID int) (int, error)
+		UnvoteHelpful(ctx context.Context, movieID, reviewID, userID int) (int, error)
+	}
+	Comments interface {
+		InsertComment(ctx context.Context, comment models.Comment, queueReason string) (int, error)
+		GetCommentThreads(context.Context, models.CommentFilter) ([]*models.Comment, error)
+		GetComment(context.Context, int) (*models.Comment, error)
+		ReportComment(ctx context.Context, movieID, commentID, userID int, reason, details string, threshold int) (bool, error)
+		GetModerationQueue(ctx context.Context, limit, offset int) ([]*models.QueuedComment, error)
+		ModerateComment(ctx context.Context, commentID, moderatorID int, action, reason string) error
+		WarnUser(ctx context.Context, userID, moderatorID int, commentID *int, reason string) error
+		SuspendUser(ctx context.Context, userID, moderatorID int, commentID *int, until time.Time, reason string) error
+		GetModerationActions(context.Context, models.ActionFilter) ([]*models.ModerationAction, error)
+	}
+	Lists interface {
+		WatchlistID(ctx context.Context, userID int) (int, error)
+		GetLists(ctx context.Context, userID int) ([]*models.List, error)
+		GetList(ctx context.Context, userID, listID int) (*models.List, error)
+		GetListBySlug(context.Context, string) (*models.List, error)
+		InsertList(context.Context, models.List) (int, error)
+		UpdateList(context.Context, models.List) error
+		DeleteList(ctx context.Context, userID, listID int) error
+		AddListItem(ctx context.Context, userID, listID int, item models.ListItem) error
+		UpdateListItem(ctx context.Context, userID, listID, movieID int, note string) error
+		RemoveListItem(ctx context.Context, userID, listID, movieID int) error
+		ReorderList(ctx context.Context, userID, listID int, movieIDs []int) error
+		WatchlistFlags(ctx context.Context, userID int, movieIDs []int) (map[int]bool, error)
+	}
+	History interface {
+		AddWatch(ctx context.Context, userID, movieID int, watchedOn time.Time, rating int) (int, error)
+		GetWatch(ctx context.Context, userID, watchID int) (*models.Watch, error)
+		GetHistory(context.Context, models.HistoryFilter) ([]*models.HistoryMonth, error)
+		DeleteWatch(ctx context.Context, userID, watchID int) error
+		GetWatchStats(ctx context.Context, userID int) (*models.WatchStats, error)
+	}
+	Similar interface {
+		SimilarityFeatures(context.Context) ([]*models.MovieFeatures, error)
+		ReplaceSimilar(ctx context.Context, movieID int, scores []models.SimilarScore) error
+		SimilarReferrers(ctx context.Context, movieID int) ([]int, error)
+		GetSimilarMovies(ctx context.Context, movieID, limit int) ([]*models.SimilarMovie, error)
+	}
+	Recommendations interface {
+		SetThumb(ctx context.Context, userID, movieID, value int) error
+		GetThumb(ctx context.Context, userID, movieID int) (*models.Thumb, error)
+		DeleteThumb(ctx context.Context, userID, movieID int) error
+		AllThumbs(context.Context) ([]models.Thumb, error)
+		ReplaceItemNeighbors(context.Context, map[int][]models.ItemNeighbor) error
+		ItemNeighbors(ctx context.Context, movieIDs []int) (map[int][]models.ItemNeighbor, error)
+		UserTaste(ctx context.Context, userID int) (*models.Taste, error)
+		RecommendationCandidates(ctx context.Context, movieIDs []int, popular int) ([]*models.Candidate, error)
+		AllViewings(context.Context) ([]models.Viewing, error)
+		CatalogCandidates(context.Context) ([]*models.Candidate, error)
+	}
+	Events interface {
+		InsertEvents(context.Context, []models.Event) error
+		RefreshTrending(ctx context.Context, period string, window, halfLife time.Duration, w models.TrendingWeights) error
+		PruneEvents(ctx context.Context, cutoff time.Time) (int64, error)
+		GetTrending(ctx context.Context, period string, limit int) ([]*models.TrendingMovie, error)
+		GetTrendingSearches(ctx context.Context, period string, limit int) ([]*models.TrendingSearch, error)
+	}
+	Autocomplete interface {
+		Autocomplete(ctx context.Context, q string, limit int) ([]*models.Suggestion, error)
+	}
+	Images interface {
+		InsertImage(context.Context, models.Image) (int64, error)
+		GetImage(context.Context, int64) (*models.Image, error)
 	}
 }
 
 func NewDbConn(db *sql.DB) Repository {
 	return Repository{
-		Movies: &models.MovieRepo{DB: db},
-		Users:  &models.UserRepo{DB: db},
+		Movies:          &models.MovieRepo{DB: db},
+		Users:           &models.UserRepo{DB: db},
+		Jobs:            &models.JobRepo{DB: db},
+		People:          &models.PersonRepo{DB: db},
+		Reviews:         &models.ReviewRepo{DB: db},
+		Comments:        &models.CommentRepo{DB: db},
+		Lists:           &models.ListRepo{DB: db},
+		History:         &models.HistoryRepo{DB: db},
+		Similar:         &models.SimilarRepo{DB: db},
+		Recommendations: &models.RecommendRepo{DB: db},
+		Events:          &models.EventRepo{DB: db},
+		Autocomplete:    &models.AutocompleteRepo{DB: db},
+		Images:          &models.ImageRepo{DB: db},
 	}
 }
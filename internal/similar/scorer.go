@@ -0,0 +1,133 @@
+package similar
+
+import (
+	"math"
+
+	"github.com/iamYole/go-movies/internal/models"
+)
+
+// Scorer rates how alike two movies are, from 0 to 1. It reports false
+// when it has nothing to go on, such as credits neither movie has, so the
+// comparison is left to the other scorers.
+type Scorer interface {
+	Score(a, b *models.MovieFeatures) (float64, bool)
+}
+
+// GenreOverlap is the Jaccard index of the two movies' genres
+type GenreOverlap struct{}
+
+func (GenreOverlap) Score(a, b *models.MovieFeatures) (float64, bool) {
+	if len(a.Genres) == 0 || len(b.Genres) == 0 {
+		return 0, false
+	}
+	return jaccard(a.Genres, b.Genres), true
+}
+
+// SharedCredits is the Jaccard index of the people credited on the two
+// movies. It only applies when both have credits.
+type SharedCredits struct{}
+
+func (SharedCredits) Score(a, b *models.MovieFeatures) (float64, bool) {
+	if len(a.People) == 0 || len(b.People) == 0 {
+		return 0, false
+	}
+	return jaccard(a.People, b.People), true
+}
+
+// YearProximity falls from 1 for movies released the same year to 0 for
+// those Window or more years apart
+type YearProximity struct {
+	Window int
+}
+
+func (y YearProximity) Score(a, b *models.MovieFeatures) (float64, bool) {
+	if a.Year == 0 || b.Year == 0 || y.Window <= 0 {
+		return 0, false
+	}
+	gap := math.Abs(float64(a.Year - b.Year))
+	return math.Max(0, 1-gap/float64(y.Window)), true
+}
+
+// mpaaLevels orders the ratings by audience; 18A sits with R and unrated
+// movies are left out
+var mpaaLevels = map[string]int{"G": 0, "PG": 1, "PG13": 2, "R": 3, "18A": 3, "NC17": 4}
+
+// RatingCompatibility scores movies for the same audience 1, a step apart
+// 0.5 and further apart 0
+type RatingCompatibility struct{}
+
+func (RatingCompatibility) Score(a, b *models.MovieFeatures) (float64, bool) {
+	la, okA := mpaaLevels[a.MPAARating]
+	lb, okB := mpaaLevels[b.MPAARating]
+	if !okA || !okB {
+		return 0, false
+	}
+	switch gap := la - lb; {
+	case gap == 0:
+		return 1, true
+	case gap == 1 || gap == -1:
+		return 0.5, true
+	}
+	return 0, true
+}
+
+// Weight is a scorer's share of a Weighted score
+type Weight struct {
+	Scorer Scorer
+	Weight float64
+}
+
+// Weighted averages its scorers by weight. A scorer that does not apply
+// counts as 0 rather than dropping out, so movies alike in a few minor ways
+// cannot score as high as ones alike in every way.
+type Weighted []Weight
+
+func (ws Weighted) Score(a, b *models.MovieFeatures) (float64, bool) {
+	var sum, total float64
+	var applied bool
+	for _, w := range ws {
+		total += w.Weight
+		if s, ok := w.Scorer.Score(a, b); ok {
+			sum += s * w.Weight
+			applied = true
+		}
+	}
+	if !applied || total == 0 {
+		return 0, false
+	}
+	return sum / total, true
+}
+
+// Default weighs genre overlap most, then shared cast and crew, release
+// year and audience
+func Default() Scorer {
+	return Weighted{
+		{GenreOverlap{}, 0.5},
+		{SharedCredits{}, 0.25},
+		{YearProximity{Window: 20}, 0.15},
+		{RatingCompatibility{}, 0.1},
+	}
+}
+
+// jaccard is the size of the intersection of two sorted id lists over the
+// size of their union
+func jaccard(a, b []int) float64 {
+	var shared, i, j int
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			shared++
+			i++
+			j++
+		case a[i] < b[j]:
+			i++
+		default:
+			j++
+		}
+	}
+	union := len(a) + len(b) - shared
+	if union == 0 {
+		return 0
+	}
+	return float64(shared) / float64(union)
+}
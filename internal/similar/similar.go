@@ -0,0 +1,182 @@
+// Package similar precomputes each movie's most similar movies as
+// background jobs, so reading them is a single indexed query.
+package similar
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strconv"
+
+	"github.com/iamYole/go-movies/internal/jobs"
+	"github.com/iamYole/go-movies/internal/models"
+)
+
+const (
+	// JobKind is the job kind handled by Refresher.Handle
+	JobKind = "refresh_similar"
+	// RebuildJobKind is the job kind handled by Refresher.HandleRebuild
+	RebuildJobKind = "rebuild_similar"
+)
+
+// Payload is the JobKind payload
+type Payload struct {
+	MovieID int `json:"movie_id"`
+}
+
+// Store is the part of the similar movie repository the refresher needs
+type Store interface {
+	SimilarityFeatures(context.Context) ([]*models.MovieFeatures, error)
+	ReplaceSimilar(ctx context.Context, movieID int, scores []models.SimilarScore) error
+	SimilarReferrers(ctx context.Context, movieID int) ([]int, error)
+}
+
+type Refresher struct {
+	Store  Store
+	Scorer Scorer
+
+	// Limit is how many matches are kept per movie
+	Limit int
+	// MinScore leaves out matches too weak to be worth showing
+	MinScore float64
+}
+
+// Enqueue queues a refresh after a movie, its genres or its credits change.
+// Jobs are keyed by movie, so a burst of edits leads to a single refresh.
+func Enqueue(ctx context.Context, store jobs.Store, movieID int) error {
+	key := "movie:" + strconv.Itoa(movieID)
+	return jobs.Enqueue(ctx, store, JobKind, key, Payload{MovieID: movieID})
+}
+
+// EnqueueRebuild queues a rebuild of every movie's matches, which is what
+// an import needs: each per movie refresh scores the whole catalog, so
+// queueing one per imported movie would cost far more than a single pass.
+// The job shares its key with the scheduled rebuild, so a pending one
+// absorbs it.
+func EnqueueRebuild(ctx context.Context, store jobs.Store) error {
+	return jobs.Enqueue(ctx, store, RebuildJobKind, RebuildJobKind, struct{}{})
+}
+
+// Handle is the jobs.Handler for JobKind. Besides the movie itself, the
+// movies that listed it and the movies it now matches are refreshed, since
+// those are the rankings its change is most likely to move. The scheduled
+// rebuild settles the rest.
+func (f *Refresher) Handle(ctx context.Context, job *models.Job) error {
+	var p Payload
+	if err := json.Unmarshal(job.Payload, &p); err != nil {
+		return jobs.Permanent(fmt.Errorf("decoding payload: %w", err))
+	}
+
+	all, err := f.Store.SimilarityFeatures(ctx)
+	if err != nil {
+		return err
+	}
+	movie := find(all, p.MovieID)
+	if movie == nil {
+		//deleted since it was queued; its rows went with it
+		return nil
+	}
+
+	referrers, err := f.Store.SimilarReferrers(ctx, p.MovieID)
+	if err != nil {
+		return err
+	}
+
+	scores, err := f.refresh(ctx, movie, all)
+	if err != nil {
+		return err
+	}
+
+	seen := map[int]bool{p.MovieID: true}
+	for _, id := range referrers {
+		seen[id] = true
+	}
+	for _, s := range scores {
+		if !seen[s.SimilarID] {
+			referrers = append(referrers, s.SimilarID)
+			seen[s.SimilarID] = true
+		}
+	}
+	for _, id := range referrers {
+		if other := find(all, id); other != nil {
+			if _, err := f.refresh(ctx, other, all); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// HandleRebuild is the jobs.Handler for RebuildJobKind, which recomputes
+// the matches of every movie
+func (f *Refresher) HandleRebuild(ctx context.Context, job *models.Job) error {
+	all, err := f.Store.SimilarityFeatures(ctx)
+	if err != nil {
+		return err
+	}
+	for _, movie := range all {
+		if _, err := f.refresh(ctx, movie, all); err != nil {
+			return fmt.Errorf("movie %d: %w", movie.ID, err)
+		}
+	}
+	log.Printf("similar: rebuilt matches for %d movies", len(all))
+	return nil
+}
+
+func (f *Refresher) refresh(ctx context.Context, movie *models.MovieFeatures, all []*models.MovieFeatures) ([]models.SimilarScore, error) {
+	scores := Rank(f.scorer(), movie, all, f.limit(), f.MinScore)
+	return scores, f.Store.ReplaceSimilar(ctx, movie.ID, scores)
+}
+
+func (f *Refresher) scorer() Scorer {
+	if f.Scorer == nil {
+		return Default()
+	}
+	return f.Scorer
+}
+
+func (f *Refresher) limit() int {
+	if f.Limit <= 0 {
+		return 20
+	}
+	return f.Limit
+}
+
+// Rank scores movie against every other candidate and returns the best
+// limit of them scoring above minScore, best first
+func Rank(scorer Scorer, movie *models.MovieFeatures, candidates []*models.MovieFeatures, limit int, minScore float64) []models.SimilarScore {
+	var scores []models.SimilarScore
+	for _, c := range candidates {
+		if c.ID == movie.ID {
+			continue
+		}
+		s, ok := scorer.Score(movie, c)
+		if !ok || s <= minScore {
+			continue
+		}
+		scores = append(scores, models.SimilarScore{SimilarID: c.ID, Score: math.Round(s*1000) / 1000})
+	}
+
+	sort.Slice(scores, func(i, j int) bool {
+		if scores[i].Score != scores[j].Score {
+			return scores[i].Score > scores[j].Score
+		}
+		return scores[i].SimilarID < scores[j].SimilarID
+	})
+	if len(scores) > limit {
+		scores = scores[:limit]
+	}
+	return scores
+}
+
+// find looks a movie up in features sorted by id
+func find(all []*models.MovieFeatures, id int) *models.MovieFeatures {
+	i := sort.Search(len(all), func(i int) bool { return all[i].ID >= id })
+	if i < len(all) && all[i].ID == id {
+		return all[i]
+	}
+	return nil
+}
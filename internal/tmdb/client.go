@@ -0,0 +1,253 @@
+// Package tmdb looks movies up on The Movie Database.
+package tmdb
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultBaseURL  = "https://api.themoviedb.org/3"
+	DefaultImageURL = "https://image.tmdb.org/t/p/"
+)
+
+// Config holds the client settings. Zero values fall back to sensible
+// defaults, except APIKey which must be set for any request to be made.
+type Config struct {
+	// APIKey is either a v3 api key, sent as the api_key parameter, or a v4
+	// read access token, sent as a bearer token
+	APIKey string
+
+	// BaseURL is the API root, DefaultBaseURL when empty
+	BaseURL string
+
+	// SearchURL is the older way of configuring the client: a full search
+	// url with the api key in its query. BaseURL and APIKey are taken from
+	// it when they are not set themselves.
+	SearchURL string
+
+	Timeout    time.Duration
+	MaxRetries int
+
+	// RequestsPerSecond caps the request rate of the client
+	RequestsPerSecond float64
+
+	// HTTPClient replaces the default client, mostly for tests
+	HTTPClient *http.Client
+}
+
+// Client is a TMDB API client, safe for concurrent use
+type Client struct {
+	baseURL    string
+	apiKey     string
+	bearer     bool
+	http       *http.Client
+	maxRetries int
+	limiter    *limiter
+}
+
+// New builds a client from cfg. A missing api key is not an error here;
+// every call on such a client fails with ErrNotConfigured instead, so
+// callers can run without TMDB.
+func New(cfg Config) (*Client, error) {
+	if cfg.SearchURL != "" {
+		u, err := url.Parse(cfg.SearchURL)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return nil, fmt.Errorf("tmdb: invalid search url %q", cfg.SearchURL)
+		}
+		if cfg.APIKey == "" {
+			cfg.APIKey = u.Query().Get("api_key")
+		}
+		if cfg.BaseURL == "" {
+			u.RawQuery = ""
+			u.Path = strings.TrimSuffix(u.Path, "/search/movie")
+			cfg.BaseURL = u.String()
+		}
+	}
+
+	if cfg.BaseURL == "" {
+		cfg.BaseURL = DefaultBaseURL
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	if cfg.MaxRetries < 0 {
+		cfg.MaxRetries = 0
+	}
+	if cfg.RequestsPerSecond <= 0 {
+		//TMDB allows around 50 per second per ip; stay well below it
+		cfg.RequestsPerSecond = 20
+	}
+
+	httpClient := cfg.HTTPClient
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: cfg.Timeout}
+	}
+
+	return &Client{
+		baseURL:    strings.TrimRight(cfg.BaseURL, "/"),
+		apiKey:     cfg.APIKey,
+		bearer:     strings.Count(cfg.APIKey, ".") == 2,
+		http:       httpClient,
+		maxRetries: cfg.MaxRetries,
+		limiter:    newLimiter(cfg.RequestsPerSecond),
+	}, nil
+}
+
+// Configured reports whether the client has an api key to call TMDB with
+func (c *Client) Configured() bool {
+	return c != nil && c.apiKey != ""
+}
+
+// get calls path with params and decodes the JSON response into dst.
+// Network errors, 429s and 5xx answers are retried with exponential backoff.
+func (c *Client) get(ctx context.Context, path string, params url.Values, dst any) error {
+	if !c.Configured() {
+		return ErrNotConfigured
+	}
+
+	if params == nil {
+		params = url.Values{}
+	}
+	if !c.bearer {
+		params.Set("api_key", c.apiKey)
+	}
+	endpoint := c.baseURL + path + "?" + params.Encode()
+
+	var err error
+	for attempt := 0; ; attempt++ {
+		var retryAfter time.Duration
+		retryAfter, err = c.try(ctx, endpoint, dst)
+		if err == nil || !retryable(err) || attempt >= c.maxRetries {
+			return err
+		}
+
+		wait := backoff(attempt)
+		if retryAfter > wait {
+			wait = retryAfter
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+// try makes a single request. It returns how long the server asked us to
+// wait, if it did.
+func (c *Client) try(ctx context.Context, endpoint string, dst any) (time.Duration, error) {
+	if err := c.limiter.wait(ctx); err != nil {
+		return 0, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if c.bearer {
+		req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	}
+
+	res, err := c.http.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return 0, ctx.Err()
+		}
+		return 0, &temporaryError{err}
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(res.Body, 4<<20))
+	if err != nil {
+		return 0, &temporaryError{err}
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return retryAfter(res.Header.Get("Retry-After")), newAPIError(res.StatusCode, body)
+	}
+
+	if err := json.Unmarshal(body, dst); err != nil {
+		return 0, fmt.Errorf("tmdb: decoding response: %w", err)
+	}
+	return 0, nil
+}
+
+func retryable(err error) bool {
+	var tmp *temporaryError
+	if errors.As(err, &tmp) {
+		return true
+	}
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode == http.StatusTooManyRequests || apiErr.StatusCode >= 500
+	}
+	return false
+}
+
+// backoff doubles from 250ms with up to 50% jitter, capped at 8s
+func backoff(attempt int) time.Duration {
+	d := 250 * time.Millisecond << attempt
+	if d > 8*time.Second || d <= 0 {
+		d = 8 * time.Second
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+func retryAfter(header string) time.Duration {
+	if header == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(header); err == nil {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(header); err == nil {
+		return time.Until(t)
+	}
+	return 0
+}
+
+// limiter spaces requests evenly so bursts never exceed the configured rate
+type limiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+func newLimiter(perSecond float64) *limiter {
+	return &limiter{interval: time.Duration(float64(time.Second) / perSecond)}
+}
+
+func (l *limiter) wait(ctx context.Context) error {
+	l.mu.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	delay := l.next.Sub(now)
+	l.next = l.next.Add(l.interval)
+	l.mu.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+	t := time.NewTimer(delay)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
@@ -0,0 +1,181 @@
+package tmdb
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTestClient points a client at handler, with a rate high enough not to
+// slow the tests down
+func newTestClient(t *testing.T, handler http.HandlerFunc, retries int) *Client {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	c, err := New(Config{
+		APIKey:            "key",
+		BaseURL:           srv.URL,
+		MaxRetries:        retries,
+		RequestsPerSecond: 1000,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestGetRetriesServerErrors(t *testing.T) {
+	var calls atomic.Int32
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 3 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		if got := r.URL.Query().Get("api_key"); got != "key" {
+			t.Errorf("api_key = %q, want %q", got, "key")
+		}
+		w.Write([]byte(`{"id": 603, "title": "The Matrix"}`))
+	}, 2)
+
+	movie, err := c.GetMovie(context.Background(), 603)
+	if err != nil {
+		t.Fatalf("GetMovie: %v", err)
+	}
+	if movie.Title != "The Matrix" {
+		t.Errorf("title = %q, want %q", movie.Title, "The Matrix")
+	}
+	if n := calls.Load(); n != 3 {
+		t.Errorf("calls = %d, want 3", n)
+	}
+}
+
+func TestGetGivesUpAfterMaxRetries(t *testing.T) {
+	var calls atomic.Int32
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}, 1)
+
+	_, err := c.GetMovie(context.Background(), 1)
+	if !errors.Is(err, ErrUnavailable) {
+		t.Errorf("err = %v, want ErrUnavailable", err)
+	}
+	if n := calls.Load(); n != 2 {
+		t.Errorf("calls = %d, want 2", n)
+	}
+}
+
+func TestGetWaitsForRetryAfter(t *testing.T) {
+	var calls atomic.Int32
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.Write([]byte(`{"id": 1}`))
+	}, 1)
+
+	start := time.Now()
+	if _, err := c.GetMovie(context.Background(), 1); err != nil {
+		t.Fatalf("GetMovie: %v", err)
+	}
+	//backoff alone would retry within 250ms
+	if waited := time.Since(start); waited < time.Second {
+		t.Errorf("retried after %v, want at least the 1s Retry-After", waited)
+	}
+	if n := calls.Load(); n != 2 {
+		t.Errorf("calls = %d, want 2", n)
+	}
+}
+
+func TestGetRateLimitedWithoutRetries(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+	}, 0)
+
+	_, err := c.GetMovie(context.Background(), 1)
+	if !errors.Is(err, ErrRateLimited) {
+		t.Errorf("err = %v, want ErrRateLimited", err)
+	}
+}
+
+func TestTypedErrors(t *testing.T) {
+	tests := []struct {
+		status int
+		body   string
+		want   error
+	}{
+		{http.StatusNotFound, `{"status_code": 34, "status_message": "The resource you requested could not be found."}`, ErrNotFound},
+		{http.StatusUnauthorized, `{"status_code": 7, "status_message": "Invalid API key"}`, ErrUnauthorized},
+		{http.StatusInternalServerError, ``, ErrUnavailable},
+	}
+
+	for _, tt := range tests {
+		var calls atomic.Int32
+		c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+			calls.Add(1)
+			w.WriteHeader(tt.status)
+			w.Write([]byte(tt.body))
+		}, 0)
+
+		_, err := c.GetMovie(context.Background(), 1)
+		if !errors.Is(err, tt.want) {
+			t.Errorf("%d: err = %v, want %v", tt.status, err, tt.want)
+		}
+
+		var apiErr *APIError
+		if !errors.As(err, &apiErr) {
+			t.Fatalf("%d: err = %T, want *APIError", tt.status, err)
+		}
+		if apiErr.StatusCode != tt.status {
+			t.Errorf("%d: StatusCode = %d", tt.status, apiErr.StatusCode)
+		}
+		if tt.body != "" && apiErr.Message == "" {
+			t.Errorf("%d: status_message not decoded", tt.status)
+		}
+		if n := calls.Load(); n != 1 {
+			t.Errorf("%d: calls = %d, want 1", tt.status, n)
+		}
+	}
+}
+
+func TestNotConfigured(t *testing.T) {
+	c, err := New(Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Configured() {
+		t.Error("client without an api key reports configured")
+	}
+	if _, err := c.GetMovie(context.Background(), 1); !errors.Is(err, ErrNotConfigured) {
+		t.Errorf("err = %v, want ErrNotConfigured", err)
+	}
+}
+
+func TestBearerToken(t *testing.T) {
+	const token = "header.payload.signature"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Authorization"); got != "Bearer "+token {
+			t.Errorf("Authorization = %q", got)
+		}
+		if r.URL.Query().Has("api_key") {
+			t.Error("api_key sent along with a bearer token")
+		}
+		w.Write([]byte(`{"id": 1}`))
+	}))
+	defer srv.Close()
+
+	c, err := New(Config{APIKey: token, BaseURL: srv.URL, RequestsPerSecond: 1000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.GetMovie(context.Background(), 1); err != nil {
+		t.Fatalf("GetMovie: %v", err)
+	}
+}
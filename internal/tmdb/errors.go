@@ -0,0 +1,68 @@
+package tmdb
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Kinds of failure. Callers match them with errors.Is.
+var (
+	ErrNotConfigured = errors.New("tmdb: no api key configured")
+	ErrNotFound      = errors.New("tmdb: not found")
+	ErrUnauthorized  = errors.New("tmdb: api key rejected")
+	ErrRateLimited   = errors.New("tmdb: rate limited")
+	ErrUnavailable   = errors.New("tmdb: service unavailable")
+)
+
+// APIError is a non 200 answer from TMDB
+type APIError struct {
+	StatusCode int
+	// Code and Message are TMDB's own status_code and status_message
+	Code    int
+	Message string
+}
+
+func newAPIError(status int, body []byte) *APIError {
+	e := &APIError{StatusCode: status}
+	var payload struct {
+		StatusCode    int    `json:"status_code"`
+		StatusMessage string `json:"status_message"`
+	}
+	if json.Unmarshal(body, &payload) == nil {
+		e.Code = payload.StatusCode
+		e.Message = payload.StatusMessage
+	}
+	return e
+}
+
+func (e *APIError) Error() string {
+	if e.Message != "" {
+		return fmt.Sprintf("tmdb: %d %s", e.StatusCode, e.Message)
+	}
+	return fmt.Sprintf("tmdb: %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+}
+
+func (e *APIError) Unwrap() error {
+	switch {
+	case e.StatusCode == http.StatusNotFound:
+		return ErrNotFound
+	case e.StatusCode == http.StatusUnauthorized:
+		return ErrUnauthorized
+	case e.StatusCode == http.StatusTooManyRequests:
+		return ErrRateLimited
+	case e.StatusCode >= 500:
+		return ErrUnavailable
+	}
+	return nil
+}
+
+// temporaryError wraps a transport failure worth retrying
+type temporaryError struct {
+	err error
+}
+
+func (e *temporaryError) Error() string { return "tmdb: " + e.err.Error() }
+
+func (e *temporaryError) Unwrap() []error { return []error{ErrUnavailable, e.err} }
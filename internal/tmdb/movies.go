@@ -0,0 +1,193 @@
+package tmdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// MovieResult is a movie as it appears in search and find results
+type MovieResult struct {
+	ID            int     `json:"id"`
+	Title         string  `json:"title"`
+	OriginalTitle string  `json:"original_title"`
+	ReleaseDate   string  `json:"release_date"`
+	Overview      string  `json:"overview"`
+	PosterPath    string  `json:"poster_path"`
+	BackdropPath  string  `json:"backdrop_path"`
+	Popularity    float64 `json:"popularity"`
+	VoteCount     int     `json:"vote_count"`
+}
+
+// Year is the release year, or 0 when TMDB has no date
+func (m MovieResult) Year() int {
+	if len(m.ReleaseDate) < 4 {
+		return 0
+	}
+	year, _ := strconv.Atoi(m.ReleaseDate[:4])
+	return year
+}
+
+type Genre struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+// MovieDetails is the full record returned by /movie/{id}
+type MovieDetails struct {
+	MovieResult
+	IMDbID           string  `json:"imdb_id"`
+	Runtime          int     `json:"runtime"`
+	OriginalLanguage string  `json:"original_language"`
+	Tagline          string  `json:"tagline"`
+	Genres           []Genre `json:"genres"`
+}
+
+type searchResponse struct {
+	Page         int           `json:"page"`
+	Results      []MovieResult `json:"results"`
+	TotalPages   int           `json:"total_pages"`
+	TotalResults int           `json:"total_results"`
+}
+
+// SearchMovies returns the first page of results for title. A non zero year
+// restricts the search to movies first released that year.
+func (c *Client) SearchMovies(ctx context.Context, title string, year int) ([]MovieResult, error) {
+	params := url.Values{}
+	params.Set("query", title)
+	params.Set("include_adult", "false")
+	if year > 0 {
+		params.Set("primary_release_year", strconv.Itoa(year))
+	}
+
+	var res searchResponse
+	if err := c.get(ctx, "/search/movie", params, &res); err != nil {
+		return nil, err
+	}
+	return res.Results, nil
+}
+
+// FindMovie picks the result that best matches title and year. It searches
+// the given year first, since titles alone are often shared by remakes, and
+// falls back to an open search ranked by how close the year is.
+func (c *Client) FindMovie(ctx context.Context, title string, year int) (*MovieResult, error) {
+	var results []MovieResult
+	var err error
+	if year > 0 {
+		results, err = c.SearchMovies(ctx, title, year)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(results) == 0 {
+		results, err = c.SearchMovies(ctx, title, 0)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	best := bestMatch(results, title, year)
+	if best == nil {
+		return nil, ErrNotFound
+	}
+	return best, nil
+}
+
+// minMatchScore is the least score a result needs to count as a match: a
+// matching title. A close year alone is not enough, since it would pick
+// whatever TMDB happened to list first for an unrelated title.
+const minMatchScore = 4
+
+// bestMatch scores results on title equality and year distance, keeping
+// TMDB's own ordering, which favours popular movies, as the tie breaker.
+// It returns nil when no result reaches minMatchScore.
+func bestMatch(results []MovieResult, title string, year int) *MovieResult {
+	var best *MovieResult
+	bestScore := 0
+	for i := range results {
+		r := &results[i]
+
+		score := 0
+		if strings.EqualFold(r.Title, title) || strings.EqualFold(r.OriginalTitle, title) {
+			score += 4
+		}
+		if year > 0 && r.Year() > 0 {
+			switch d := abs(r.Year() - year); {
+			case d == 0:
+				score += 3
+			case d == 1:
+				//festival premieres often land a year before the release
+				score += 2
+			}
+		}
+
+		if score >= minMatchScore && score > bestScore {
+			best, bestScore = r, score
+		}
+	}
+	return best
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// GetMovie fetches a movie by its TMDB id
+func (c *Client) GetMovie(ctx context.Context, id int) (*MovieDetails, error) {
+	var movie MovieDetails
+	if err := c.get(ctx, "/movie/"+strconv.Itoa(id), nil, &movie); err != nil {
+		return nil, err
+	}
+	return &movie, nil
+}
+
+// FindByIMDbID looks a movie up by its IMDb tconst
+func (c *Client) FindByIMDbID(ctx context.Context, imdbID string) (*MovieResult, error) {
+	params := url.Values{}
+	params.Set("external_source", "imdb_id")
+
+	var res struct {
+		MovieResults []MovieResult `json:"movie_results"`
+	}
+	if err := c.get(ctx, "/find/"+url.PathEscape(imdbID), params, &res); err != nil {
+		return nil, err
+	}
+	if len(res.MovieResults) == 0 {
+		return nil, fmt.Errorf("%w: imdb id %s", ErrNotFound, imdbID)
+	}
+	return &res.MovieResults[0], nil
+}
+
+// Poster finds the poster path of a movie, preferring known ids over a
+// title search. A matched movie without a poster gives "" and no error.
+func (c *Client) Poster(ctx context.Context, title string, year int, externalIDs map[string]string) (string, error) {
+	if id, err := strconv.Atoi(externalIDs["tmdb"]); err == nil {
+		movie, err := c.GetMovie(ctx, id)
+		if err != nil {
+			return "", err
+		}
+		return movie.PosterPath, nil
+	}
+
+	if imdbID := externalIDs["imdb"]; imdbID != "" {
+		movie, err := c.FindByIMDbID(ctx, imdbID)
+		if err == nil {
+			return movie.PosterPath, nil
+		}
+		if !errors.Is(err, ErrNotFound) {
+			return "", err
+		}
+	}
+
+	movie, err := c.FindMovie(ctx, title, year)
+	if err != nil {
+		return "", err
+	}
+	return movie.PosterPath, nil
+}
@@ -0,0 +1,104 @@
+package tmdb
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestBestMatch(t *testing.T) {
+	results := []MovieResult{
+		{ID: 1, Title: "Dune", ReleaseDate: "1984-12-14"},
+		{ID: 2, Title: "Dune", ReleaseDate: "2021-09-15"},
+		{ID: 3, Title: "Dune: Part Two", ReleaseDate: "2024-02-27"},
+		{ID: 4, Title: "Les Misérables", OriginalTitle: "Les Misérables", ReleaseDate: "2012-12-18"},
+	}
+
+	tests := []struct {
+		name  string
+		title string
+		year  int
+		want  int
+	}{
+		{"year picks the remake", "Dune", 2021, 2},
+		{"year picks the original", "dune", 1984, 1},
+		{"festival premiere a year early", "Dune", 2022, 2},
+		{"no year keeps tmdb order", "Dune", 0, 1},
+		{"original title", "les misérables", 2012, 4},
+		{"year alone is not a match", "Arrival", 2024, 0},
+		{"nothing close", "Arrival", 0, 0},
+	}
+
+	for _, tt := range tests {
+		got := bestMatch(results, tt.title, tt.year)
+		switch {
+		case tt.want == 0 && got != nil:
+			t.Errorf("%s: got %d, want no match", tt.name, got.ID)
+		case tt.want != 0 && got == nil:
+			t.Errorf("%s: got no match, want %d", tt.name, tt.want)
+		case tt.want != 0 && got.ID != tt.want:
+			t.Errorf("%s: got %d, want %d", tt.name, got.ID, tt.want)
+		}
+	}
+}
+
+func TestFindMovieFallsBackToOpenSearch(t *testing.T) {
+	var years []string
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/search/movie" {
+			t.Errorf("path = %q", r.URL.Path)
+		}
+		year := r.URL.Query().Get("primary_release_year")
+		years = append(years, year)
+
+		res := searchResponse{}
+		if year == "" {
+			//the release date on TMDB is a year off the one asked for
+			res.Results = []MovieResult{
+				{ID: 1, Title: "Dune", ReleaseDate: "1984-12-14"},
+				{ID: 2, Title: "Dune", ReleaseDate: "2021-09-15"},
+			}
+		}
+		json.NewEncoder(w).Encode(res)
+	}, 0)
+
+	movie, err := c.FindMovie(context.Background(), "Dune", 2020)
+	if err != nil {
+		t.Fatalf("FindMovie: %v", err)
+	}
+	if movie.ID != 2 {
+		t.Errorf("got %d, want 2", movie.ID)
+	}
+	if len(years) != 2 || years[0] != "2020" || years[1] != "" {
+		t.Errorf("searched years %q, want [2020 \"\"]", years)
+	}
+}
+
+func TestFindMovieWithoutMatch(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(searchResponse{Results: []MovieResult{
+			{ID: 1, Title: "Something Else", ReleaseDate: "2016-11-11"},
+		}})
+	}, 0)
+
+	_, err := c.FindMovie(context.Background(), "Arrival", 2016)
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("err = %v, want ErrNotFound", err)
+	}
+}
+
+func TestFindByIMDbIDNotFound(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if got := r.URL.Query().Get("external_source"); got != "imdb_id" {
+			t.Errorf("external_source = %q", got)
+		}
+		w.Write([]byte(`{"movie_results": []}`))
+	}, 0)
+
+	_, err := c.FindByIMDbID(context.Background(), "tt0000000")
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("err = %v, want ErrNotFound", err)
+	}
+}
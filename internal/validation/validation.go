@@ -0,0 +1,150 @@
+// Package validation checks input against the validate struct tags of the
+// models, so the API and the admin CLI hold data to the same rules.
+package validation
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/iamYole/go-movies/internal/models"
+)
+
+var validate = validator.New(validator.WithRequiredStructEnabled())
+
+func init() {
+	registerValidations(validate)
+}
+
+// earliestReleaseDate is the year of the first surviving motion picture
+var earliestReleaseDate = time.Date(1888, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// FieldError is a rule a field failed, with a message fit for clients
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// registerValidations teaches v to report JSON field names and the
+// movie specific rules
+func registerValidations(v *validator.Validate) {
+	v.RegisterTagNameFunc(func(f reflect.StructField) string {
+		name := strings.SplitN(f.Tag.Get("json"), ",", 2)[0]
+		if name == "-" {
+			return ""
+		}
+		return name
+	})
+
+	v.RegisterValidation("mpaa", func(fl validator.FieldLevel) bool {
+		return models.IsMPAARating(fl.Field().String())
+	})
+
+	v.RegisterValidation("release_date", func(fl validator.FieldLevel) bool {
+		date, ok := fl.Field().Interface().(time.Time)
+		if !ok {
+			return false
+		}
+		return !date.Before(earliestReleaseDate) && date.Before(latestReleaseDate())
+	})
+
+	v.RegisterValidation("synced_field", func(fl validator.FieldLevel) bool {
+		return models.IsSyncedField(fl.Field().String())
+	})
+
+	v.RegisterValidation("credit_role", func(fl validator.FieldLevel) bool {
+		return models.IsCreditRole(fl.Field().String())
+	})
+
+	v.RegisterValidation("report_reason", func(fl validator.FieldLevel) bool {
+		return models.IsReportReason(fl.Field().String())
+	})
+
+	v.RegisterValidation("list_visibility", func(fl validator.FieldLevel) bool {
+		return models.IsListVisibility(fl.Field().String())
+	})
+}
+
+// latestReleaseDate allows announced movies up to ten years ahead
+func latestReleaseDate() time.Time {
+	return time.Now().AddDate(10, 0, 0)
+}
+
+// Struct runs the struct tags of data and converts any failures to field
+// errors. Only a misuse of the validator itself is returned as an error.
+func Struct(data any) ([]FieldError, error) {
+	err := validate.Struct(data)
+	if err == nil {
+		return nil, nil
+	}
+
+	var verrs validator.ValidationErrors
+	if !errors.As(err, &verrs) {
+		return nil, err
+	}
+
+	fieldErrors := make([]FieldError, 0, len(verrs))
+	for _, fe := range verrs {
+		fieldErrors = append(fieldErrors, FieldError{
+			Field:   fe.Field(),
+			Rule:    fe.Tag(),
+			Message: validationMessage(fe),
+		})
+	}
+	return fieldErrors, nil
+}
+
+func validationMessage(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required":
+		return "is required"
+	case "email":
+		return "must be a valid email address"
+	case "min":
+		return fmt.Sprintf("must be at least %s%s", fe.Param(), sizeUnit(fe.Kind()))
+	case "max":
+		return fmt.Sprintf("must be at most %s%s", fe.Param(), sizeUnit(fe.Kind()))
+	case "len":
+		return fmt.Sprintf("must be exactly %s%s", fe.Param(), sizeUnit(fe.Kind()))
+	case "lowercase":
+		return "must be lowercase"
+	case "gt":
+		return fmt.Sprintf("must be greater than %s", fe.Param())
+	case "gte":
+		return fmt.Sprintf("must be at least %s", fe.Param())
+	case "lte":
+		return fmt.Sprintf("must be at most %s", fe.Param())
+	case "oneof":
+		return fmt.Sprintf("must be one of %s", strings.ReplaceAll(fe.Param(), " ", ", "))
+	case "mpaa":
+		return fmt.Sprintf("must be one of %s", strings.Join(models.MPAARatings, ", "))
+	case "synced_field":
+		return fmt.Sprintf("must be one of %s", strings.Join(models.SyncedFields, ", "))
+	case "credit_role":
+		return fmt.Sprintf("must be one of %s", strings.Join(models.CreditRoles, ", "))
+	case "report_reason":
+		return fmt.Sprintf("must be one of %s", strings.Join(models.ReportReasons, ", "))
+	case "list_visibility":
+		return fmt.Sprintf("must be one of %s", strings.Join(models.ListVisibilities, ", "))
+	case "release_date":
+		return fmt.Sprintf("must be between %s and %s",
+			earliestReleaseDate.Format(time.DateOnly), latestReleaseDate().Format(time.DateOnly))
+	}
+	return fmt.Sprintf("failed the %s rule", fe.Tag())
+}
+
+// sizeUnit is what min, max and len count for a field of kind k: the
+// characters of a string, the items of a list, and the value of a number
+func sizeUnit(k reflect.Kind) string {
+	switch k {
+	case reflect.String:
+		return " characters"
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return " items"
+	}
+	return ""
+}